@@ -1,37 +1,51 @@
 package main
 
 import (
+	"context"
 	"log"
+	"log/slog"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/AlexGuo43/clans/api-gateway/config"
 	"github.com/AlexGuo43/clans/api-gateway/internal/middleware"
-	"github.com/AlexGuo43/clans/api-gateway/internal/proxy"
-	"github.com/AlexGuo43/clans/api-gateway/internal/services"
-	"github.com/gorilla/mux"
+	"github.com/AlexGuo43/clans/api-gateway/internal/ratelimit"
+	"github.com/AlexGuo43/clans/api-gateway/internal/server"
+	"github.com/AlexGuo43/clans/api-gateway/internal/tracing"
 )
 
+// configPollInterval is how often the config files are checked for changes.
+const configPollInterval = 5 * time.Second
+
 func main() {
-	cfg := config.LoadConfig()
-	authService := services.NewAuthService(cfg.JWTSecret)
-	gateway := proxy.NewGateway(cfg)
+	reloader, err := server.NewReloader(config.LoadConfig, ratelimit.NewMemoryStore())
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	cfg := reloader.Config()
+	slog.SetDefault(middleware.NewLogger(cfg.LogLevel))
 
-	r := mux.NewRouter()
+	shutdownTracing, err := tracing.Setup(context.Background(), "api-gateway", cfg.TraceExporter, cfg.TraceFile)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
 
-	r.HandleFunc("/health", gateway.HealthCheck).Methods("GET")
-	
-	api := r.PathPrefix("/api").Subrouter()
-	api.Use(middleware.LoggingMiddleware)
-	api.Use(middleware.CorsMiddleware)
-	api.Use(middleware.AuthMiddleware(authService))
-	
-	api.PathPrefix("/").HandlerFunc(gateway.RouteRequest)
+	reloader.WatchSignals(context.Background())
+	reloader.WatchFiles(context.Background(), configPollInterval, config.Files)
 
 	log.Printf("API Gateway starting on port %s...", cfg.Port)
 	log.Printf("Routing to services:")
 	for _, service := range cfg.Services {
-		log.Printf("  - %s: %s", service.Name, service.URL)
+		log.Printf("  - %s (%s): %s", service.Name, service.LoadBalancer, strings.Join(service.URLs, ", "))
 	}
+	log.Printf("Loaded %d routes", len(cfg.Routes))
+
+	go func() {
+		log.Printf("Internal endpoints on port %s", cfg.InternalPort)
+		log.Fatal(http.ListenAndServe(":"+cfg.InternalPort, reloader.Internal()))
+	}()
 
-	log.Fatal(http.ListenAndServe(":"+cfg.Port, r))
-}
\ No newline at end of file
+	log.Fatal(http.ListenAndServe(":"+cfg.Port, reloader))
+}
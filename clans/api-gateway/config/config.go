@@ -1,71 +1,664 @@
 package config
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/netip"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
 )
 
+// ServiceConfig is an upstream service. URL is shorthand for a single entry
+// in URLs; after loading, URLs holds every backend instance.
 type ServiceConfig struct {
-	Name string
-	URL  string
+	Name           string                `yaml:"name"`
+	URL            string                `yaml:"url"`
+	URLs           []string              `yaml:"urls"`
+	LoadBalancer   string                `yaml:"load_balancer"`
+	CircuitBreaker *CircuitBreakerConfig `yaml:"circuit_breaker"`
+}
+
+// HealthCheckConfig controls active probing of every backend instance.
+type HealthCheckConfig struct {
+	Path               string        `yaml:"path"`
+	Interval           time.Duration `yaml:"interval"`
+	Timeout            time.Duration `yaml:"timeout"`
+	UnhealthyThreshold int           `yaml:"unhealthy_threshold"`
+	HealthyThreshold   int           `yaml:"healthy_threshold"`
+}
+
+type CircuitBreakerConfig struct {
+	FailureThreshold int           `yaml:"failure_threshold"`
+	OpenTimeout      time.Duration `yaml:"open_timeout"`
+	HalfOpenRequests int           `yaml:"half_open_requests"`
+}
+
+// UpstreamConfig holds the defaults for calls to upstream services. Retries
+// only apply to idempotent methods without a request body. A zero
+// MaxResponseSize means responses are not limited, but a zero MaxBodySize is
+// taken as unset and becomes 1MB; only a route can lift the body limit.
+type UpstreamConfig struct {
+	Timeout         time.Duration `yaml:"timeout"`
+	Retries         int           `yaml:"retries"`
+	RetryBackoff    time.Duration `yaml:"retry_backoff"`
+	MaxBodySize     ByteSize      `yaml:"max_body_size"`
+	MaxResponseSize ByteSize      `yaml:"max_response_size"`
+}
+
+// StreamingConfig applies to WebSocket upgrades and Server-Sent Events.
+// The upstream timeout only covers the wait for response headers; after that
+// a stream stays open until either side closes it or no data has flowed for
+// IdleTimeout. MaxConnectionsPerClient caps the open streams per user (or IP
+// for anonymous clients).
+type StreamingConfig struct {
+	IdleTimeout             time.Duration `yaml:"idle_timeout"`
+	MaxConnectionsPerClient int           `yaml:"max_connections_per_client"`
+}
+
+// CompressionConfig controls compression of responses to clients. Encodings
+// lists the supported ones ("br", "gzip") in order of preference; an empty
+// list turns compression off. Responses known to be smaller than MinSize are
+// sent as they are.
+type CompressionConfig struct {
+	Encodings []string `yaml:"encodings"`
+	MinSize   ByteSize `yaml:"min_size"`
+}
+
+// IdempotencyConfig applies to POST, PUT, PATCH and DELETE requests sent
+// with an Idempotency-Key header. The first response for a caller's key is
+// kept for TTL, 24 hours by default, and replayed for retries.
+type IdempotencyConfig struct {
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// AuthConfig controls access token checks. The user service's public
+// signing keys are fetched every JWKSRefreshInterval, and the revocation
+// list of logged out and revoked sessions every RevocationSyncInterval;
+// zero turns either off.
+type AuthConfig struct {
+	JWKSRefreshInterval    time.Duration `yaml:"jwks_refresh_interval"`
+	RevocationSyncInterval time.Duration `yaml:"revocation_sync_interval"`
+}
+
+// CacheConfig bounds the response cache shared by routes with a cache
+// block. Responses larger than MaxEntrySize are not cached. Zero means no
+// bound. The cache is created at startup, so changes only apply on restart.
+type CacheConfig struct {
+	MaxEntries   int      `yaml:"max_entries"`
+	MaxSize      ByteSize `yaml:"max_size"`
+	MaxEntrySize ByteSize `yaml:"max_entry_size"`
+}
+
+// RouteCacheConfig caches a route's anonymous GET responses for TTL, unless
+// the service sets Cache-Control, which takes precedence. Stale responses
+// are served for StaleWhileRevalidate more while they are refreshed in the
+// background. Vary lists request headers that select a different response.
+// Tags may use the route's path parameters ("clan:{id}") and are what
+// entries are purged by.
+type RouteCacheConfig struct {
+	TTL                  time.Duration `yaml:"ttl"`
+	StaleWhileRevalidate time.Duration `yaml:"stale_while_revalidate"`
+	Vary                 []string      `yaml:"vary"`
+	Tags                 []string      `yaml:"tags"`
+}
+
+// ByteSize is a size in bytes that can be written as a plain number or with
+// a KB, MB or GB suffix.
+type ByteSize int64
+
+func (b *ByteSize) UnmarshalYAML(value *yaml.Node) error {
+	size, err := parseByteSize(value.Value)
+	if err != nil {
+		return err
+	}
+	*b = size
+	return nil
+}
+
+func parseByteSize(raw string) (ByteSize, error) {
+	value := strings.ToUpper(strings.TrimSpace(raw))
+	multiplier := int64(1)
+	for suffix, m := range map[string]int64{"KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30} {
+		if strings.HasSuffix(value, suffix) {
+			multiplier = m
+			value = strings.TrimSpace(strings.TrimSuffix(value, suffix))
+			break
+		}
+	}
+	value = strings.TrimSuffix(value, "B")
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", raw)
+	}
+	return ByteSize(n * multiplier), nil
+}
+
+// RouteConfig describes one entry of the gateway route table. Path is a
+// pattern where "{name}" matches a single segment and a trailing "*" matches
+// any remainder of the path. A route is either proxied to Service or served
+// by the gateway view named by View. VerifiedEmail refuses callers who have
+// not verified their email address.
+type RouteConfig struct {
+	Path          string           `yaml:"path"`
+	Methods       []string         `yaml:"methods"`
+	Service       string           `yaml:"service"`
+	View          string           `yaml:"view"`
+	StripPrefix   string           `yaml:"strip_prefix"`
+	RewritePrefix string           `yaml:"rewrite_prefix"`
+	Public        bool             `yaml:"public"`
+	VerifiedEmail bool             `yaml:"verified_email"`
+	RateLimit     *RateLimitConfig `yaml:"rate_limit"`
+	Timeout       time.Duration    `yaml:"timeout"`
+	Retries       *int             `yaml:"retries"`
+	// MaxBodySize and MaxResponseSize override the upstream defaults.
+	MaxBodySize     *ByteSize `yaml:"max_body_size"`
+	MaxResponseSize *ByteSize `yaml:"max_response_size"`
+	// CORS overrides the allowed methods and headers for this route.
+	CORS *RouteCORSConfig `yaml:"cors"`
+	// Versions limits the route to these API versions; without it the route
+	// serves every version. Transforms names, per version, the transformer
+	// that reshapes upstream responses for clients of that version.
+	Versions   []string          `yaml:"versions"`
+	Transforms map[string]string `yaml:"transforms"`
+	// Cache turns on response caching for the route. Purge lists the cache
+	// tags a successful write through the route removes; like cache tags
+	// they may use path parameters.
+	Cache *RouteCacheConfig `yaml:"cache"`
+	Purge []string          `yaml:"purge"`
+}
+
+// APIVersionsConfig lists the API versions clients can ask for with an
+// /api/<version>/ path prefix or the Accept-Version header. Requests with
+// neither get Default, which is the first version when unset.
+type APIVersionsConfig struct {
+	Default  string          `yaml:"default"`
+	Versions []VersionConfig `yaml:"versions"`
+}
+
+// VersionConfig is one API version. Names look like "v2". A version with
+// Deprecated or Sunset set is still served, but its responses carry
+// Deprecation, Sunset and Link (to the migration guide) headers.
+type VersionConfig struct {
+	Name       string     `yaml:"name"`
+	Deprecated *time.Time `yaml:"deprecated"`
+	Sunset     *time.Time `yaml:"sunset"`
+	Link       string     `yaml:"link"`
+}
+
+// Version returns the API version with the given name, or nil.
+func (c *APIVersionsConfig) Version(name string) *VersionConfig {
+	for i := range c.Versions {
+		if c.Versions[i].Name == name {
+			return &c.Versions[i]
+		}
+	}
+	return nil
+}
+
+// CORSConfig is the gateway-wide CORS policy. Origins are exact
+// ("https://app.example.com"), wildcard subdomains ("https://*.example.com")
+// or "*" for any origin.
+type CORSConfig struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins"`
+	AllowedMethods   []string      `yaml:"allowed_methods"`
+	AllowedHeaders   []string      `yaml:"allowed_headers"`
+	ExposedHeaders   []string      `yaml:"exposed_headers"`
+	AllowCredentials bool          `yaml:"allow_credentials"`
+	MaxAge           time.Duration `yaml:"max_age"`
+}
+
+type RouteCORSConfig struct {
+	AllowedMethods []string `yaml:"allowed_methods"`
+	AllowedHeaders []string `yaml:"allowed_headers"`
+}
+
+// RateLimitConfig is a per-client token bucket. Burst defaults to
+// RequestsPerMinute when unset.
+type RateLimitConfig struct {
+	RequestsPerMinute int `yaml:"requests_per_minute"`
+	Burst             int `yaml:"burst"`
 }
 
 type Config struct {
-	Port            string
-	JWTSecret       string
-	UserService     ServiceConfig
-	PostService     ServiceConfig
-	CommentService  ServiceConfig
-	ClanService     ServiceConfig
-	Services        []ServiceConfig
+	Port               string           `yaml:"-"`
+	InternalAuthSecret string           `yaml:"-"`
+	LogLevel           string           `yaml:"-"`
+	TraceExporter      string           `yaml:"-"`
+	TraceFile          string           `yaml:"-"`
+	Services           []ServiceConfig  `yaml:"services"`
+	Routes             []RouteConfig    `yaml:"routes"`
+	RateLimit          *RateLimitConfig `yaml:"rate_limit"`
+	// CircuitBreaker is the default for services without their own settings.
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"`
+	Upstream       UpstreamConfig       `yaml:"upstream"`
+	Streaming      StreamingConfig      `yaml:"streaming"`
+	Compression    CompressionConfig    `yaml:"compression"`
+	Idempotency    IdempotencyConfig    `yaml:"idempotency"`
+	Cache          CacheConfig          `yaml:"cache"`
+	Auth           AuthConfig           `yaml:"auth"`
+	HealthCheck    HealthCheckConfig    `yaml:"health_check"`
+	CORS           CORSConfig           `yaml:"cors"`
+	APIVersions    APIVersionsConfig    `yaml:"api_versions"`
+	// TrustedProxies lists the addresses (IPs or CIDRs) of proxies in front
+	// of the gateway whose X-Forwarded-* headers are believed.
+	TrustedProxies       []string       `yaml:"trusted_proxies"`
+	TrustedProxyPrefixes []netip.Prefix `yaml:"-"`
+	// InternalPort serves /internal/cache/purge, authenticated with
+	// CachePurgeToken. It is kept off the public port and only read at
+	// startup.
+	InternalPort    string `yaml:"-"`
+	CachePurgeToken string `yaml:"-"`
 }
 
-func LoadConfig() *Config {
-	if err := godotenv.Load("config/.env"); err != nil {
-		log.Println("Warning: No .env file found, using default values")
+// envFile holds defaults for variables not set in the environment.
+const envFile = "config/.env"
+
+// LoadConfig reads the environment, config/.env and the route table file.
+// It only reads, so it can be called again to reload the configuration.
+func LoadConfig() (*Config, error) {
+	env, err := loadEnv()
+	if err != nil {
+		return nil, err
 	}
 
-	userService := ServiceConfig{
-		Name: "user-service",
-		URL:  getEnv("USER_SERVICE_URL", "http://user-service:8080"),
+	cfg, err := loadFile(env.get("GATEWAY_CONFIG", "config/gateway.yaml"))
+	if err != nil {
+		return nil, err
 	}
 
-	postService := ServiceConfig{
-		Name: "post-service", 
-		URL:  getEnv("POST_SERVICE_URL", "http://post-service:8081"),
+	cfg.Port = env.get("PORT", "8000")
+	cfg.InternalAuthSecret = env.get("INTERNAL_AUTH_SECRET", "")
+	if cfg.InternalAuthSecret == "" {
+		return nil, fmt.Errorf("INTERNAL_AUTH_SECRET is required")
+	}
+	cfg.InternalPort = env.get("INTERNAL_PORT", "8001")
+	cfg.CachePurgeToken = env.get("CACHE_PURGE_TOKEN", "")
+	cfg.LogLevel = env.get("LOG_LEVEL", "info")
+	cfg.TraceExporter = env.get("TRACE_EXPORTER", "")
+	cfg.TraceFile = env.get("TRACE_FILE", "traces.json")
+	if origins := env.get("CORS_ALLOWED_ORIGINS", ""); origins != "" {
+		cfg.CORS.AllowedOrigins = splitList(origins)
 	}
 
-	commentService := ServiceConfig{
-		Name: "comment-service",
-		URL:  getEnv("COMMENT_SERVICE_URL", "http://comment-service:8082"),
+	for i := range cfg.Services {
+		service := &cfg.Services[i]
+		if service.URL != "" {
+			service.URLs = append([]string{service.URL}, service.URLs...)
+		}
+		if urls := env.get(serviceURLEnv(service.Name), ""); urls != "" {
+			service.URLs = splitList(urls)
+		}
+		service.URL = ""
 	}
+	cfg.applyDefaults()
 
-	clanService := ServiceConfig{
-		Name: "clan-service",
-		URL:  getEnv("CLAN_SERVICE_URL", "http://clan-service:8083"),
+	if err := cfg.validate(); err != nil {
+		return nil, err
 	}
 
-	return &Config{
-		Port:           getEnv("PORT", "8000"),
-		JWTSecret:      getEnv("JWT_SECRET", "mysecretkey"),
-		UserService:    userService,
-		PostService:    postService,
-		CommentService: commentService,
-		ClanService:    clanService,
-		Services: []ServiceConfig{
-			userService,
-			postService,
-			commentService,
-			clanService,
-		},
+	return cfg, nil
+}
+
+// Files returns the files LoadConfig reads, for watching them for changes.
+func Files() []string {
+	env, _ := loadEnv()
+	return []string{envFile, env.get("GATEWAY_CONFIG", "config/gateway.yaml")}
+}
+
+// Service returns the upstream service with the given name, or nil.
+func (c *Config) Service(name string) *ServiceConfig {
+	for i := range c.Services {
+		if c.Services[i].Name == name {
+			return &c.Services[i]
+		}
+	}
+	return nil
+}
+
+// BodyLimit returns the largest request body route accepts: its own
+// max_body_size or the upstream default. Zero, which only a route's
+// max_body_size can set, means bodies are not limited.
+func (c *Config) BodyLimit(route *RouteConfig) ByteSize {
+	if route.MaxBodySize != nil {
+		return *route.MaxBodySize
+	}
+	return c.Upstream.MaxBodySize
+}
+
+func loadFile(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open gateway config: %w", err)
+	}
+	defer f.Close()
+
+	// YAML is a superset of JSON, so the same decoder accepts both formats.
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+
+	var cfg Config
+	if err := decoder.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse gateway config %s: %w", path, err)
 	}
+
+	return &cfg, nil
 }
 
-func getEnv(key, defaultValue string) string {
+func (c *Config) applyDefaults() {
+	if c.Upstream.Timeout == 0 {
+		c.Upstream.Timeout = 10 * time.Second
+	}
+	if c.Upstream.RetryBackoff == 0 {
+		c.Upstream.RetryBackoff = 100 * time.Millisecond
+	}
+	if c.Upstream.MaxBodySize == 0 {
+		c.Upstream.MaxBodySize = 1 << 20
+	}
+
+	if c.Streaming.IdleTimeout == 0 {
+		c.Streaming.IdleTimeout = 5 * time.Minute
+	}
+	if c.Streaming.MaxConnectionsPerClient == 0 {
+		c.Streaming.MaxConnectionsPerClient = 10
+	}
+
+	if c.Compression.Encodings == nil {
+		c.Compression.Encodings = []string{"br", "gzip"}
+	}
+	if c.Compression.MinSize == 0 {
+		c.Compression.MinSize = 1 << 10
+	}
+
+	if c.Idempotency.TTL == 0 {
+		c.Idempotency.TTL = 24 * time.Hour
+	}
+
+	if c.Auth.JWKSRefreshInterval == 0 {
+		c.Auth.JWKSRefreshInterval = 5 * time.Minute
+	}
+	if c.Auth.RevocationSyncInterval == 0 {
+		c.Auth.RevocationSyncInterval = 5 * time.Second
+	}
+
+	if c.Cache.MaxEntries == 0 {
+		c.Cache.MaxEntries = 10000
+	}
+	if c.Cache.MaxSize == 0 {
+		c.Cache.MaxSize = 64 << 20
+	}
+	if c.Cache.MaxEntrySize == 0 {
+		c.Cache.MaxEntrySize = 1 << 20
+	}
+
+	if c.CircuitBreaker.FailureThreshold == 0 {
+		c.CircuitBreaker.FailureThreshold = 5
+	}
+	if c.CircuitBreaker.OpenTimeout == 0 {
+		c.CircuitBreaker.OpenTimeout = 30 * time.Second
+	}
+	if c.CircuitBreaker.HalfOpenRequests == 0 {
+		c.CircuitBreaker.HalfOpenRequests = 1
+	}
+
+	if len(c.CORS.AllowedMethods) == 0 {
+		c.CORS.AllowedMethods = []string{"GET", "POST", "PUT", "DELETE"}
+	}
+	if len(c.CORS.AllowedHeaders) == 0 {
+		c.CORS.AllowedHeaders = []string{"Content-Type", "Authorization"}
+	}
+
+	if c.HealthCheck.Path == "" {
+		c.HealthCheck.Path = "/readyz"
+	}
+	if c.HealthCheck.Interval == 0 {
+		c.HealthCheck.Interval = 10 * time.Second
+	}
+	if c.HealthCheck.Timeout == 0 {
+		c.HealthCheck.Timeout = 2 * time.Second
+	}
+	if c.HealthCheck.UnhealthyThreshold == 0 {
+		c.HealthCheck.UnhealthyThreshold = 3
+	}
+	if c.HealthCheck.HealthyThreshold == 0 {
+		c.HealthCheck.HealthyThreshold = 2
+	}
+
+	if c.APIVersions.Default == "" && len(c.APIVersions.Versions) > 0 {
+		c.APIVersions.Default = c.APIVersions.Versions[0].Name
+	}
+
+	for i := range c.Services {
+		if c.Services[i].LoadBalancer == "" {
+			c.Services[i].LoadBalancer = "round_robin"
+		}
+		if c.Services[i].CircuitBreaker == nil {
+			cb := c.CircuitBreaker
+			c.Services[i].CircuitBreaker = &cb
+		}
+	}
+}
+
+func (c *Config) validate() error {
+	seen := make(map[string]bool)
+	for _, service := range c.Services {
+		if service.Name == "" {
+			return fmt.Errorf("service name is required")
+		}
+		if seen[service.Name] {
+			return fmt.Errorf("duplicate service %q", service.Name)
+		}
+		if len(service.URLs) == 0 {
+			return fmt.Errorf("service %q has no url", service.Name)
+		}
+		if cb := service.CircuitBreaker; cb.FailureThreshold <= 0 || cb.OpenTimeout <= 0 || cb.HalfOpenRequests <= 0 {
+			return fmt.Errorf("service %q: circuit_breaker values must be positive", service.Name)
+		}
+		seen[service.Name] = true
+	}
+
+	if err := c.RateLimit.validate(); err != nil {
+		return fmt.Errorf("rate_limit: %w", err)
+	}
+	if c.Upstream.Retries < 0 {
+		return fmt.Errorf("upstream retries must not be negative")
+	}
+	// Zero durations were replaced by defaults, so only negative ones get
+	// here; they would time out every call or stop the health checks.
+	if c.Upstream.Timeout <= 0 {
+		return fmt.Errorf("upstream timeout must be positive")
+	}
+	if c.HealthCheck.Interval <= 0 || c.HealthCheck.Timeout <= 0 {
+		return fmt.Errorf("health_check interval and timeout must be positive")
+	}
+	if c.Streaming.IdleTimeout < 0 || c.Streaming.MaxConnectionsPerClient < 0 {
+		return fmt.Errorf("streaming values must not be negative")
+	}
+	for _, encoding := range c.Compression.Encodings {
+		if encoding != "br" && encoding != "gzip" {
+			return fmt.Errorf("compression: unsupported encoding %q", encoding)
+		}
+	}
+	if c.Auth.JWKSRefreshInterval < 0 {
+		return fmt.Errorf("auth jwks_refresh_interval must not be negative")
+	}
+	if c.Auth.RevocationSyncInterval < 0 {
+		return fmt.Errorf("auth revocation_sync_interval must not be negative")
+	}
+	if c.Cache.MaxEntries < 0 {
+		return fmt.Errorf("cache max_entries must not be negative")
+	}
+	if c.CORS.MaxAge < 0 {
+		return fmt.Errorf("cors max_age must not be negative")
+	}
+
+	if err := c.APIVersions.validate(); err != nil {
+		return fmt.Errorf("api_versions: %w", err)
+	}
+
+	c.TrustedProxyPrefixes = nil
+	for _, proxy := range c.TrustedProxies {
+		prefix, err := parsePrefix(proxy)
+		if err != nil {
+			return fmt.Errorf("trusted_proxies: %w", err)
+		}
+		c.TrustedProxyPrefixes = append(c.TrustedProxyPrefixes, prefix)
+	}
+
+	for _, route := range c.Routes {
+		if !strings.HasPrefix(route.Path, "/") {
+			return fmt.Errorf("route path %q must start with /", route.Path)
+		}
+		if route.View != "" {
+			if route.Service != "" {
+				return fmt.Errorf("route %s: service and view are mutually exclusive", route.Path)
+			}
+		} else if !seen[route.Service] {
+			return fmt.Errorf("route %s references unknown service %q", route.Path, route.Service)
+		}
+		if err := route.RateLimit.validate(); err != nil {
+			return fmt.Errorf("route %s rate_limit: %w", route.Path, err)
+		}
+		if route.Public && route.VerifiedEmail {
+			return fmt.Errorf("route %s: public and verified_email are mutually exclusive", route.Path)
+		}
+		if route.Timeout < 0 || (route.Retries != nil && *route.Retries < 0) {
+			return fmt.Errorf("route %s: timeout and retries must not be negative", route.Path)
+		}
+		for _, version := range route.Versions {
+			if c.APIVersions.Version(version) == nil {
+				return fmt.Errorf("route %s references unknown API version %q", route.Path, version)
+			}
+		}
+		for version := range route.Transforms {
+			if c.APIVersions.Version(version) == nil {
+				return fmt.Errorf("route %s transforms unknown API version %q", route.Path, version)
+			}
+		}
+		if err := route.Cache.validate(route.Path); err != nil {
+			return fmt.Errorf("route %s cache: %w", route.Path, err)
+		}
+		if err := validateTags(route.Path, route.Purge); err != nil {
+			return fmt.Errorf("route %s purge: %w", route.Path, err)
+		}
+	}
+
+	return nil
+}
+
+var pathParameter = regexp.MustCompile(`\{([^{}]*)\}`)
+
+func (c *RouteCacheConfig) validate(path string) error {
+	if c == nil {
+		return nil
+	}
+	if c.TTL < 0 || c.StaleWhileRevalidate < 0 {
+		return fmt.Errorf("ttl and stale_while_revalidate must not be negative")
+	}
+	return validateTags(path, c.Tags)
+}
+
+// validateTags checks that tags only use path parameters of path.
+func validateTags(path string, tags []string) error {
+	for _, tag := range tags {
+		for _, match := range pathParameter.FindAllStringSubmatch(tag, -1) {
+			if !strings.Contains(path, match[0]) {
+				return fmt.Errorf("tag %q uses %s, which is not in the path", tag, match[0])
+			}
+		}
+	}
+	return nil
+}
+
+var versionName = regexp.MustCompile(`^v[0-9]+$`)
+
+func (c *APIVersionsConfig) validate() error {
+	seen := make(map[string]bool)
+	for _, version := range c.Versions {
+		if !versionName.MatchString(version.Name) {
+			return fmt.Errorf("version name %q must look like v1", version.Name)
+		}
+		if seen[version.Name] {
+			return fmt.Errorf("duplicate version %q", version.Name)
+		}
+		seen[version.Name] = true
+	}
+	if c.Default != "" && !seen[c.Default] {
+		return fmt.Errorf("unknown default version %q", c.Default)
+	}
+	return nil
+}
+
+func (rl *RateLimitConfig) validate() error {
+	if rl == nil {
+		return nil
+	}
+	if rl.RequestsPerMinute <= 0 {
+		return fmt.Errorf("requests_per_minute must be positive")
+	}
+	if rl.Burst < 0 {
+		return fmt.Errorf("burst must not be negative")
+	}
+	return nil
+}
+
+// serviceURLEnv maps a service name to the environment variable that
+// overrides its URLs, e.g. post-service -> POST_SERVICE_URL. The variable may
+// hold a comma-separated list of backends.
+func serviceURLEnv(name string) string {
+	return strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_URL"
+}
+
+// parsePrefix accepts a CIDR or a single IP address.
+func parsePrefix(value string) (netip.Prefix, error) {
+	if strings.Contains(value, "/") {
+		return netip.ParsePrefix(value)
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// environment looks variables up in the process environment first and in
+// config/.env second.
+type environment map[string]string
+
+func loadEnv() (environment, error) {
+	env, err := godotenv.Read(envFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return environment{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", envFile, err)
+	}
+	return env, nil
+}
+
+func (e environment) get(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
+	if value := e[key]; value != "" {
+		return value
+	}
 	return defaultValue
-}
\ No newline at end of file
+}
@@ -0,0 +1,239 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+var ErrNoHealthyBackend = errors.New("no healthy backend")
+
+const (
+	RoundRobin       = "round_robin"
+	LeastConnections = "least_connections"
+	ConsistentHash   = "consistent_hash"
+)
+
+// virtualNodes is the number of points each backend gets on the hash ring.
+const virtualNodes = 100
+
+type Backend struct {
+	URL       string
+	healthy   atomic.Bool
+	active    atomic.Int64
+	lastProbe atomic.Pointer[ProbeResult]
+}
+
+// ProbeResult is the outcome of one health probe of a backend.
+type ProbeResult struct {
+	At      time.Time
+	Latency time.Duration
+	Err     error
+}
+
+func (b *Backend) Healthy() bool {
+	return b.healthy.Load()
+}
+
+func (b *Backend) ActiveConnections() int64 {
+	return b.active.Load()
+}
+
+// LastProbe returns the result of the most recent health probe, or nil if
+// the backend has not been probed yet.
+func (b *Backend) LastProbe() *ProbeResult {
+	return b.lastProbe.Load()
+}
+
+// Acquire marks a request as in flight on the backend and returns the func
+// that releases it.
+func (b *Backend) Acquire() func() {
+	b.active.Add(1)
+	return func() { b.active.Add(-1) }
+}
+
+type HealthCheckSettings struct {
+	Path               string
+	Interval           time.Duration
+	Timeout            time.Duration
+	UnhealthyThreshold int
+	HealthyThreshold   int
+}
+
+type ringPoint struct {
+	hash    uint32
+	backend *Backend
+}
+
+// Pool is the set of backends serving one upstream service.
+type Pool struct {
+	Name     string
+	strategy string
+	backends []*Backend
+	ring     []ringPoint
+	next     atomic.Uint64
+}
+
+func NewPool(name string, urls []string, strategy string) (*Pool, error) {
+	if strategy == "" {
+		strategy = RoundRobin
+	}
+	if strategy != RoundRobin && strategy != LeastConnections && strategy != ConsistentHash {
+		return nil, fmt.Errorf("unknown load balancer %q", strategy)
+	}
+
+	pool := &Pool{Name: name, strategy: strategy}
+	for _, url := range urls {
+		backend := &Backend{URL: url}
+		// Backends start healthy so the gateway can serve before the first probe.
+		backend.healthy.Store(true)
+		pool.backends = append(pool.backends, backend)
+
+		for i := 0; i < virtualNodes; i++ {
+			hash := crc32.ChecksumIEEE([]byte(url + "#" + strconv.Itoa(i)))
+			pool.ring = append(pool.ring, ringPoint{hash: hash, backend: backend})
+		}
+	}
+	sort.Slice(pool.ring, func(i, j int) bool { return pool.ring[i].hash < pool.ring[j].hash })
+
+	return pool, nil
+}
+
+func (p *Pool) Backends() []*Backend {
+	return p.backends
+}
+
+// Pick selects a healthy backend. key is only used by consistent hashing,
+// where the same key keeps landing on the same backend while it is healthy.
+func (p *Pool) Pick(key string) (*Backend, error) {
+	switch p.strategy {
+	case LeastConnections:
+		return p.pickLeastConnections()
+	case ConsistentHash:
+		return p.pickConsistentHash(key)
+	default:
+		return p.pickRoundRobin()
+	}
+}
+
+func (p *Pool) pickRoundRobin() (*Backend, error) {
+	n := uint64(len(p.backends))
+	start := p.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		backend := p.backends[(start+i)%n]
+		if backend.Healthy() {
+			return backend, nil
+		}
+	}
+	return nil, ErrNoHealthyBackend
+}
+
+func (p *Pool) pickLeastConnections() (*Backend, error) {
+	var best *Backend
+	for _, backend := range p.backends {
+		if !backend.Healthy() {
+			continue
+		}
+		if best == nil || backend.ActiveConnections() < best.ActiveConnections() {
+			best = backend
+		}
+	}
+	if best == nil {
+		return nil, ErrNoHealthyBackend
+	}
+	return best, nil
+}
+
+func (p *Pool) pickConsistentHash(key string) (*Backend, error) {
+	if len(p.ring) == 0 {
+		return nil, ErrNoHealthyBackend
+	}
+
+	hash := crc32.ChecksumIEEE([]byte(key))
+	start := sort.Search(len(p.ring), func(i int) bool { return p.ring[i].hash >= hash })
+	for i := 0; i < len(p.ring); i++ {
+		point := p.ring[(start+i)%len(p.ring)]
+		if point.backend.Healthy() {
+			return point.backend, nil
+		}
+	}
+	return nil, ErrNoHealthyBackend
+}
+
+// RunHealthChecks starts probing every backend in the background until ctx
+// is cancelled. A backend is taken out of rotation after UnhealthyThreshold
+// consecutive failed probes and put back after HealthyThreshold consecutive
+// successful ones.
+func (p *Pool) RunHealthChecks(ctx context.Context, client *http.Client, settings HealthCheckSettings) {
+	for _, backend := range p.backends {
+		go p.probeLoop(ctx, client, settings, backend)
+	}
+}
+
+func (p *Pool) probeLoop(ctx context.Context, client *http.Client, settings HealthCheckSettings, backend *Backend) {
+	ticker := time.NewTicker(settings.Interval)
+	defer ticker.Stop()
+
+	failures, successes := 0, 0
+	for {
+		result := probe(ctx, client, settings, backend)
+		backend.lastProbe.Store(result)
+		if result.Err == nil {
+			failures = 0
+			successes++
+			if !backend.Healthy() && successes >= settings.HealthyThreshold {
+				backend.healthy.Store(true)
+				log.Printf("Backend %s of %s is healthy again", backend.URL, p.Name)
+			}
+		} else {
+			successes = 0
+			failures++
+			if backend.Healthy() && failures >= settings.UnhealthyThreshold {
+				backend.healthy.Store(false)
+				log.Printf("Backend %s of %s is unhealthy, removing from rotation", backend.URL, p.Name)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+var errProbeStatus = errors.New("unexpected health status")
+
+func probe(ctx context.Context, client *http.Client, settings HealthCheckSettings, backend *Backend) *ProbeResult {
+	ctx, cancel := context.WithTimeout(ctx, settings.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	result := &ProbeResult{At: start}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, backend.URL+settings.Path, nil)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	resp, err := client.Do(req)
+	result.Latency = time.Since(start)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		result.Err = fmt.Errorf("%w %d", errProbeStatus, resp.StatusCode)
+	}
+	return result
+}
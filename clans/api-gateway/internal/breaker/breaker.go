@@ -0,0 +1,125 @@
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrOpen = errors.New("circuit breaker is open")
+
+type State int
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+type Settings struct {
+	// FailureThreshold is the number of consecutive failures that opens the
+	// breaker.
+	FailureThreshold int
+	// OpenTimeout is how long the breaker stays open before letting probe
+	// requests through.
+	OpenTimeout time.Duration
+	// HalfOpenRequests is the number of concurrent probes allowed while
+	// half-open.
+	HalfOpenRequests int
+}
+
+// Breaker is a consecutive-failure circuit breaker for one upstream.
+type Breaker struct {
+	mu       sync.Mutex
+	settings Settings
+	state    State
+	failures int
+	openedAt time.Time
+	probes   int
+}
+
+func New(settings Settings) *Breaker {
+	return &Breaker{settings: settings}
+}
+
+// Allow reports whether a request may be sent. It returns ErrOpen while the
+// breaker is open or all half-open probe slots are taken.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open && time.Since(b.openedAt) >= b.settings.OpenTimeout {
+		b.state = HalfOpen
+		b.probes = 0
+	}
+
+	switch b.state {
+	case Open:
+		return ErrOpen
+	case HalfOpen:
+		if b.probes >= b.settings.HalfOpenRequests {
+			return ErrOpen
+		}
+		b.probes++
+	}
+
+	return nil
+}
+
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = Closed
+	b.failures = 0
+	b.probes = 0
+}
+
+// Release hands back the probe slot taken by an allowed request that ended
+// without telling anything about the upstream's health, such as one the
+// client cancelled. Every allowed request must end in exactly one of
+// Success, Failure or Release, or a half-open breaker stays half-open with
+// its probe slots taken.
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == HalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == HalfOpen || b.failures >= b.settings.FailureThreshold {
+		b.state = Open
+		b.openedAt = time.Now()
+		b.probes = 0
+	}
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open && time.Since(b.openedAt) >= b.settings.OpenTimeout {
+		return HalfOpen
+	}
+	return b.state
+}
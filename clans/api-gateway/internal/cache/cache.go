@@ -0,0 +1,161 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Entry is a cached response. It is fresh for TTL after StoredAt and may be
+// served stale, while it is refreshed, for StaleWhileRevalidate after that.
+type Entry struct {
+	Status int
+	Header http.Header
+	Body   []byte
+	// Tags name the data in the response, such as "clan:12", so that it can
+	// be purged when that data changes.
+	Tags []string
+	// Vary holds the request headers the response varies on, with the
+	// values it was stored for.
+	Vary                 map[string]string
+	StoredAt             time.Time
+	TTL                  time.Duration
+	StaleWhileRevalidate time.Duration
+}
+
+// Fresh reports whether the entry can be served without revalidation.
+func (e *Entry) Fresh(now time.Time) bool {
+	return now.Before(e.StoredAt.Add(e.TTL))
+}
+
+// Expired reports whether the entry can no longer be served at all.
+func (e *Entry) Expired(now time.Time) bool {
+	return !now.Before(e.StoredAt.Add(e.TTL + e.StaleWhileRevalidate))
+}
+
+func (e *Entry) size() int64 {
+	size := int64(len(e.Body))
+	for name, values := range e.Header {
+		size += int64(len(name))
+		for _, value := range values {
+			size += int64(len(value))
+		}
+	}
+	return size
+}
+
+// Store holds cached responses by key. Implementations must be safe for
+// concurrent use; a shared store lets gateway instances share one cache and
+// one purge.
+type Store interface {
+	// Get returns the entry for key, or nil when there is none or it has
+	// expired.
+	Get(ctx context.Context, key string) (*Entry, error)
+	Set(ctx context.Context, key string, entry *Entry) error
+	// Purge removes the entries with any of tags and returns how many there
+	// were.
+	Purge(ctx context.Context, tags []string) (int, error)
+}
+
+type item struct {
+	key   string
+	entry *Entry
+	size  int64
+}
+
+// MemoryStore is a least-recently-used cache in process memory, bounded by
+// the number of entries and their total size. Zero means no bound.
+type MemoryStore struct {
+	maxEntries int
+	maxSize    int64
+
+	mu    sync.Mutex
+	items map[string]*list.Element
+	lru   *list.List
+	tags  map[string]map[string]struct{}
+	size  int64
+}
+
+func NewMemoryStore(maxEntries int, maxSize int64) *MemoryStore {
+	return &MemoryStore{
+		maxEntries: maxEntries,
+		maxSize:    maxSize,
+		items:      make(map[string]*list.Element),
+		lru:        list.New(),
+		tags:       make(map[string]map[string]struct{}),
+	}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.items[key]
+	if !ok {
+		return nil, nil
+	}
+	it := element.Value.(*item)
+	if it.entry.Expired(time.Now()) {
+		s.remove(element)
+		return nil, nil
+	}
+	s.lru.MoveToFront(element)
+	return it.entry, nil
+}
+
+func (s *MemoryStore) Set(ctx context.Context, key string, entry *Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.items[key]; ok {
+		s.remove(element)
+	}
+	it := &item{key: key, entry: entry, size: entry.size()}
+	if s.maxSize > 0 && it.size > s.maxSize {
+		return nil
+	}
+
+	s.items[key] = s.lru.PushFront(it)
+	s.size += it.size
+	for _, tag := range entry.Tags {
+		if s.tags[tag] == nil {
+			s.tags[tag] = make(map[string]struct{})
+		}
+		s.tags[tag][key] = struct{}{}
+	}
+
+	for (s.maxEntries > 0 && s.lru.Len() > s.maxEntries) || (s.maxSize > 0 && s.size > s.maxSize) {
+		s.remove(s.lru.Back())
+	}
+	return nil
+}
+
+func (s *MemoryStore) Purge(ctx context.Context, tags []string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := 0
+	for _, tag := range tags {
+		for key := range s.tags[tag] {
+			if element, ok := s.items[key]; ok {
+				s.remove(element)
+				purged++
+			}
+		}
+	}
+	return purged, nil
+}
+
+func (s *MemoryStore) remove(element *list.Element) {
+	it := s.lru.Remove(element).(*item)
+	delete(s.items, it.key)
+	s.size -= it.size
+	for _, tag := range it.entry.Tags {
+		delete(s.tags[tag], it.key)
+		if len(s.tags[tag]) == 0 {
+			delete(s.tags, tag)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// PurgeRequest is the body of POST /internal/cache/purge.
+type PurgeRequest struct {
+	Tags []string `json:"tags"`
+}
+
+type PurgeResponse struct {
+	Purged int `json:"purged"`
+}
+
+// PurgeHandler removes cached responses by tag. It is meant for the services
+// and operators, not clients: it is served on the gateway's internal port
+// only and requires secret, the cache purge token, as a bearer token. With no
+// token configured every purge is refused.
+func PurgeHandler(store Store, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || secret == "" || subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req PurgeRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil || len(req.Tags) == 0 {
+			http.Error(w, "Expected a JSON body with a non-empty tags list", http.StatusBadRequest)
+			return
+		}
+
+		purged, err := store.Purge(r.Context(), req.Tags)
+		if err != nil {
+			log.Printf("Cache purge error: %v", err)
+			http.Error(w, "Failed to purge cache", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(PurgeResponse{Purged: purged})
+	}
+}
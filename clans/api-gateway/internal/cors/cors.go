@@ -0,0 +1,155 @@
+package cors
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AlexGuo43/clans/api-gateway/config"
+)
+
+// Policy decides which cross-origin requests the gateway allows.
+type Policy struct {
+	anyOrigin bool
+	origins   map[string]bool
+	wildcards []wildcardOrigin
+	methods   []string
+	headers   []string
+
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// wildcardOrigin matches "https://*.example.com" as prefix "https://" and
+// suffix ".example.com". The apex domain itself does not match.
+type wildcardOrigin struct {
+	prefix string
+	suffix string
+}
+
+func NewPolicy(cfg config.CORSConfig) (*Policy, error) {
+	p := &Policy{
+		origins:          make(map[string]bool),
+		methods:          canonicalMethods(cfg.AllowedMethods),
+		headers:          canonicalHeaders(cfg.AllowedHeaders),
+		ExposedHeaders:   canonicalHeaders(cfg.ExposedHeaders),
+		AllowCredentials: cfg.AllowCredentials,
+		MaxAge:           cfg.MaxAge,
+	}
+
+	for _, origin := range cfg.AllowedOrigins {
+		origin = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(origin), "/"))
+		if origin == "*" {
+			p.anyOrigin = true
+			continue
+		}
+
+		scheme, host, ok := strings.Cut(origin, "://")
+		if !ok || scheme == "" || host == "" || strings.Contains(host, "/") {
+			return nil, fmt.Errorf("cors: invalid origin %q", origin)
+		}
+
+		if strings.HasPrefix(host, "*.") {
+			if strings.Contains(host[2:], "*") {
+				return nil, fmt.Errorf("cors: invalid origin %q", origin)
+			}
+			p.wildcards = append(p.wildcards, wildcardOrigin{prefix: scheme + "://", suffix: host[1:]})
+			continue
+		}
+		if strings.Contains(host, "*") {
+			return nil, fmt.Errorf("cors: wildcard is only allowed as the first label in %q", origin)
+		}
+		p.origins[origin] = true
+	}
+
+	return p, nil
+}
+
+// AllowOrigin reports whether origin, as sent in the Origin header, is on the
+// allowlist.
+func (p *Policy) AllowOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if p.anyOrigin {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	if p.origins[origin] {
+		return true
+	}
+	for _, w := range p.wildcards {
+		if !strings.HasPrefix(origin, w.prefix) || !strings.HasSuffix(origin, w.suffix) {
+			continue
+		}
+		sub := origin[len(w.prefix) : len(origin)-len(w.suffix)]
+		if sub != "" && !strings.ContainsAny(sub, "/:@") {
+			return true
+		}
+	}
+	return false
+}
+
+// Methods returns the methods allowed for route, which may be nil when the
+// request does not match any route.
+func (p *Policy) Methods(route *config.RouteConfig) []string {
+	if route != nil && route.CORS != nil && len(route.CORS.AllowedMethods) > 0 {
+		return canonicalMethods(route.CORS.AllowedMethods)
+	}
+	return p.methods
+}
+
+// Headers returns the request headers allowed for route.
+func (p *Policy) Headers(route *config.RouteConfig) []string {
+	if route != nil && route.CORS != nil && len(route.CORS.AllowedHeaders) > 0 {
+		return canonicalHeaders(route.CORS.AllowedHeaders)
+	}
+	return p.headers
+}
+
+// AllowsMethod reports whether method is in allowed.
+func AllowsMethod(allowed []string, method string) bool {
+	for _, m := range allowed {
+		if m == method || m == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsHeaders reports whether every requested header is in allowed.
+func AllowsHeaders(allowed, requested []string) bool {
+	for _, header := range requested {
+		header = http.CanonicalHeaderKey(header)
+		ok := false
+		for _, a := range allowed {
+			if a == header || a == "*" {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func canonicalMethods(methods []string) []string {
+	result := make([]string, len(methods))
+	for i, m := range methods {
+		result[i] = strings.ToUpper(strings.TrimSpace(m))
+	}
+	return result
+}
+
+func canonicalHeaders(headers []string) []string {
+	result := make([]string, len(headers))
+	for i, h := range headers {
+		result[i] = http.CanonicalHeaderKey(strings.TrimSpace(h))
+	}
+	return result
+}
@@ -0,0 +1,160 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AlexGuo43/clans/api-gateway/internal/proxy"
+)
+
+// Upstream sends requests to the gateway's services on behalf of the inbound
+// request in ctx.
+type Upstream interface {
+	Call(ctx context.Context, service, method, path string, body io.Reader) (*http.Response, error)
+}
+
+// Purger drops the cached responses that a write to path changed.
+type Purger func(ctx context.Context, method, path string)
+
+// The service models as they appear on the wire.
+
+type user struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+type clan struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	DisplayName string    `json:"display_name"`
+	Description string    `json:"description"`
+	OwnerID     int       `json:"owner_id"`
+	OwnerName   string    `json:"owner_name"`
+	MemberCount int       `json:"member_count"`
+	PostCount   int       `json:"post_count"`
+	IsPublic    bool      `json:"is_public"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type membership struct {
+	ID       int       `json:"id"`
+	ClanID   int       `json:"clan_id"`
+	UserID   int       `json:"user_id"`
+	Username string    `json:"username"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+type post struct {
+	ID        int       `json:"id"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	UserID    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	ClanID    *int      `json:"clan_id"`
+	VoteCount int       `json:"vote_count"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type comment struct {
+	ID         int       `json:"id"`
+	Content    string    `json:"content"`
+	PostID     int       `json:"post_id"`
+	UserID     int       `json:"user_id"`
+	Username   string    `json:"username"`
+	ParentID   *int      `json:"parent_id"`
+	VoteCount  int       `json:"vote_count"`
+	ReplyCount int       `json:"reply_count"`
+	Depth      int       `json:"depth"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	// Replies is set when the comment came as part of a thread.
+	Replies []*comment `json:"replies"`
+}
+
+// upstreamError is a failed call to a service. It is reported to the client
+// with the service's status code.
+type upstreamError struct {
+	service string
+	status  int
+	message string
+}
+
+func (e *upstreamError) Error() string {
+	return e.message
+}
+
+func (e *upstreamError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"service": e.service, "status": e.status}
+}
+
+// client makes the upstream calls behind the resolvers.
+type client struct {
+	upstream Upstream
+	purge    Purger
+}
+
+// get decodes the response to a GET for path into v. A 404 is reported as
+// found == false rather than as an error.
+func (c *client) get(ctx context.Context, service, path string, v interface{}) (found bool, err error) {
+	err = c.do(ctx, service, http.MethodGet, path, nil, v)
+	var upstreamErr *upstreamError
+	if errors.As(err, &upstreamErr) && upstreamErr.status == http.StatusNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (c *client) post(ctx context.Context, service, path string, body, v interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, service, http.MethodPost, path, bytes.NewReader(payload), v)
+}
+
+func (c *client) do(ctx context.Context, service, method, path string, body io.Reader, v interface{}) error {
+	resp, err := c.upstream.Call(ctx, service, method, path, body)
+	if err != nil {
+		status, message := proxy.ErrorStatus(err)
+		return &upstreamError{service: service, status: status, message: message}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// The services answer errors with http.Error, so the body is a
+		// short plain-text message. Server errors may describe internals
+		// and are replaced by the status text.
+		message := http.StatusText(resp.StatusCode)
+		if resp.StatusCode < http.StatusInternalServerError {
+			text, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			if trimmed := strings.TrimSpace(string(text)); trimmed != "" {
+				message = trimmed
+			}
+		}
+		return &upstreamError{service: service, status: resp.StatusCode, message: message}
+	}
+
+	if method != http.MethodGet && c.purge != nil {
+		c.purge(ctx, method, path)
+	}
+
+	if v == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return &upstreamError{service: service, status: http.StatusBadGateway, message: fmt.Sprintf("invalid response from %s", service)}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package graph
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/graph-gophers/graphql-go"
+	graphqlotel "github.com/graph-gophers/graphql-go/trace/otel"
+	"go.opentelemetry.io/otel"
+)
+
+//go:embed schema.graphql
+var schema string
+
+// maxDepth bounds how deeply a query may nest, and with it how many upstream
+// calls a single query can fan out to.
+const maxDepth = 8
+
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+type handler struct {
+	schema *graphql.Schema
+	client *client
+}
+
+// NewHandler serves GraphQL queries and mutations, sent as JSON over POST,
+// by calling the REST services through upstream. purge, which may be nil, is
+// told about every successful write so that cached responses it changed are
+// dropped.
+func NewHandler(upstream Upstream, purge Purger) http.Handler {
+	return &handler{
+		schema: graphql.MustParseSchema(schema, &resolver{},
+			graphql.MaxDepth(maxDepth),
+			graphql.Tracer(&graphqlotel.Tracer{Tracer: otel.Tracer("github.com/AlexGuo43/clans/api-gateway/internal/graph")}),
+		),
+		client: &client{upstream: upstream, purge: purge},
+	}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	// Loaders are per request: they cache what the caller is allowed to see.
+	ctx := withLoaders(r.Context(), newLoaders(h.client))
+	resp := h.schema.Exec(ctx, req.Query, req.OperationName, req.Variables)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,144 @@
+package graph
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	batchWait     = 2 * time.Millisecond
+	maxBatch      = 50
+	maxConcurrent = 8
+)
+
+// loader batches and caches loads of one kind of value for a single GraphQL
+// request. Keys requested within batchWait of each other are passed to fetch
+// together, and each key is fetched at most once per request no matter how
+// many fields ask for it.
+type loader[K comparable, V any] struct {
+	fetch func(ctx context.Context, keys []K) ([]V, []error)
+
+	mu      sync.Mutex
+	cache   map[K]*thunk[V]
+	pending *batch[K, V]
+}
+
+type thunk[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+type batch[K comparable, V any] struct {
+	keys   []K
+	thunks []*thunk[V]
+}
+
+// newLoader returns a loader that resolves batches with fetch, which must
+// return one value and one error per key, in order.
+func newLoader[K comparable, V any](fetch func(ctx context.Context, keys []K) ([]V, []error)) *loader[K, V] {
+	return &loader[K, V]{fetch: fetch, cache: make(map[K]*thunk[V])}
+}
+
+// Load returns the value for key, waiting for the batch it joins.
+func (l *loader[K, V]) Load(ctx context.Context, key K) (V, error) {
+	l.mu.Lock()
+	t, ok := l.cache[key]
+	if !ok {
+		t = &thunk[V]{done: make(chan struct{})}
+		l.cache[key] = t
+		l.enqueue(ctx, key, t)
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-t.done:
+		return t.value, t.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+// Prime stores a value that was loaded some other way, for example as part
+// of a list, so that later loads of key do not fetch it again.
+func (l *loader[K, V]) Prime(key K, value V) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.cache[key]; ok {
+		return
+	}
+	t := &thunk[V]{done: make(chan struct{}), value: value}
+	close(t.done)
+	l.cache[key] = t
+}
+
+// Clear drops key from the cache, for values changed by a mutation.
+func (l *loader[K, V]) Clear(key K) {
+	l.mu.Lock()
+	delete(l.cache, key)
+	l.mu.Unlock()
+}
+
+// enqueue adds key to the pending batch, starting a new one if needed. The
+// caller holds l.mu.
+func (l *loader[K, V]) enqueue(ctx context.Context, key K, t *thunk[V]) {
+	if l.pending == nil {
+		b := &batch[K, V]{}
+		l.pending = b
+		time.AfterFunc(batchWait, func() {
+			l.mu.Lock()
+			if l.pending != b {
+				// Already dispatched because it filled up.
+				l.mu.Unlock()
+				return
+			}
+			l.pending = nil
+			l.mu.Unlock()
+			l.run(ctx, b)
+		})
+	}
+
+	b := l.pending
+	b.keys = append(b.keys, key)
+	b.thunks = append(b.thunks, t)
+	if len(b.keys) >= maxBatch {
+		l.pending = nil
+		go l.run(ctx, b)
+	}
+}
+
+func (l *loader[K, V]) run(ctx context.Context, b *batch[K, V]) {
+	values, errs := l.fetch(ctx, b.keys)
+	for i, t := range b.thunks {
+		t.value, t.err = values[i], errs[i]
+		close(t.done)
+	}
+}
+
+// fetchEach adapts a single-key fetch to a batch function. The services have
+// no batch endpoints, so the keys of a batch are fetched concurrently, at
+// most maxConcurrent at a time.
+func fetchEach[K comparable, V any](fetch func(ctx context.Context, key K) (V, error)) func(context.Context, []K) ([]V, []error) {
+	return func(ctx context.Context, keys []K) ([]V, []error) {
+		values := make([]V, len(keys))
+		errs := make([]error, len(keys))
+
+		sem := make(chan struct{}, maxConcurrent)
+		var wg sync.WaitGroup
+		for i, key := range keys {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				values[i], errs[i] = fetch(ctx, key)
+			}()
+		}
+		wg.Wait()
+
+		return values, errs
+	}
+}
@@ -0,0 +1,113 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+)
+
+// page identifies one page of a list that belongs to a parent entity.
+type page struct {
+	id, page, limit int
+}
+
+// loaders holds the per-request loaders behind the resolvers. Every entity
+// and list is fetched through one of them, so a query never asks a service
+// for the same thing twice.
+type loaders struct {
+	client *client
+
+	users        *loader[int, *user]
+	clans        *loader[int, *clan]
+	posts        *loader[int, *post]
+	comments     *loader[int, *comment]
+	replies      *loader[int, []*comment]
+	postComments *loader[page, []*comment]
+	clanPosts    *loader[page, []*post]
+	clanMembers  *loader[int, []*membership]
+	// memberships holds the caller's membership by clan ID.
+	memberships *loader[int, *membership]
+}
+
+func newLoaders(c *client) *loaders {
+	l := &loaders{client: c}
+
+	l.users = newLoader(fetchEach(func(ctx context.Context, id int) (*user, error) {
+		return getOne[user](ctx, c, "user-service", fmt.Sprintf("/%d", id))
+	}))
+	l.clans = newLoader(fetchEach(func(ctx context.Context, id int) (*clan, error) {
+		return getOne[clan](ctx, c, "clan-service", fmt.Sprintf("/api/clans/%d", id))
+	}))
+	l.posts = newLoader(fetchEach(func(ctx context.Context, id int) (*post, error) {
+		return getOne[post](ctx, c, "post-service", fmt.Sprintf("/api/posts/%d", id))
+	}))
+	l.comments = newLoader(fetchEach(func(ctx context.Context, id int) (*comment, error) {
+		return getOne[comment](ctx, c, "comment-service", fmt.Sprintf("/api/comments/%d", id))
+	}))
+	l.memberships = newLoader(fetchEach(func(ctx context.Context, clanID int) (*membership, error) {
+		// The clan service answers 404 for non-members.
+		return getOne[membership](ctx, c, "clan-service", fmt.Sprintf("/api/clans/%d/membership", clanID))
+	}))
+
+	l.replies = newLoader(fetchEach(func(ctx context.Context, id int) ([]*comment, error) {
+		return getList[comment](ctx, c, "comment-service", fmt.Sprintf("/api/comments/%d/replies", id))
+	}))
+	l.postComments = newLoader(fetchEach(func(ctx context.Context, p page) ([]*comment, error) {
+		comments, err := getList[comment](ctx, c, "comment-service", fmt.Sprintf("/api/comments/post/%d?page=%d&limit=%d", p.id, p.page, p.limit))
+		l.primeComments(comments)
+		return comments, err
+	}))
+	l.clanPosts = newLoader(fetchEach(func(ctx context.Context, p page) ([]*post, error) {
+		posts, err := getList[post](ctx, c, "post-service", fmt.Sprintf("/api/posts/clan/%d?page=%d&limit=%d", p.id, p.page, p.limit))
+		l.primePosts(posts)
+		return posts, err
+	}))
+	l.clanMembers = newLoader(fetchEach(func(ctx context.Context, id int) ([]*membership, error) {
+		return getList[membership](ctx, c, "clan-service", fmt.Sprintf("/api/clans/%d/members", id))
+	}))
+
+	return l
+}
+
+func (l *loaders) primePosts(posts []*post) {
+	for _, p := range posts {
+		l.posts.Prime(p.ID, p)
+	}
+}
+
+func (l *loaders) primeComments(comments []*comment) {
+	for _, c := range comments {
+		l.comments.Prime(c.ID, c)
+		if c.Replies != nil {
+			l.replies.Prime(c.ID, c.Replies)
+			l.primeComments(c.Replies)
+		}
+	}
+}
+
+// getOne fetches a single entity, returning nil when it does not exist.
+func getOne[T any](ctx context.Context, c *client, service, path string) (*T, error) {
+	var v T
+	found, err := c.get(ctx, service, path, &v)
+	if !found {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func getList[T any](ctx context.Context, c *client, service, path string) ([]*T, error) {
+	var v []*T
+	if _, err := c.get(ctx, service, path, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+type loadersKey struct{}
+
+func withLoaders(ctx context.Context, l *loaders) context.Context {
+	return context.WithValue(ctx, loadersKey{}, l)
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
@@ -0,0 +1,270 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/AlexGuo43/clans/api-gateway/internal/middleware"
+	"github.com/graph-gophers/graphql-go"
+)
+
+var (
+	errUnauthenticated = errors.New("authentication required")
+	errUnverified      = errors.New("email address not verified")
+)
+
+// resolver is the root of both queries and mutations.
+type resolver struct{}
+
+type pageArgs struct {
+	Page  int32
+	Limit int32
+}
+
+// normalize clamps the arguments to what the services accept.
+func (a pageArgs) normalize() (int, int) {
+	p, limit := int(a.Page), int(a.Limit)
+	if p < 1 {
+		p = 1
+	}
+	limit = min(max(limit, 1), 100)
+	return p, limit
+}
+
+func parseID(id graphql.ID) (int, error) {
+	n, err := strconv.Atoi(string(id))
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid ID %q", id)
+	}
+	return n, nil
+}
+
+// parseOptionalID parses an optional ID argument.
+func parseOptionalID(id *graphql.ID) (*int, error) {
+	if id == nil {
+		return nil, nil
+	}
+	n, err := parseID(*id)
+	return &n, err
+}
+
+func (r *resolver) Me(ctx context.Context) (*userResolver, error) {
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		return nil, nil
+	}
+	return loadUser(ctx, userID)
+}
+
+func (r *resolver) User(ctx context.Context, args struct{ ID graphql.ID }) (*userResolver, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	return loadUser(ctx, id)
+}
+
+func (r *resolver) Clan(ctx context.Context, args struct{ ID graphql.ID }) (*clanResolver, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	return loadClan(ctx, id)
+}
+
+func (r *resolver) ClanByName(ctx context.Context, args struct{ Name string }) (*clanResolver, error) {
+	l := loadersFrom(ctx)
+	c, err := getOne[clan](ctx, l.client, "clan-service", "/api/clans/name/"+url.PathEscape(args.Name))
+	if c == nil {
+		return nil, err
+	}
+	l.clans.Prime(c.ID, c)
+	return &clanResolver{c}, nil
+}
+
+func (r *resolver) Clans(ctx context.Context, args struct{ Limit, Offset int32 }) ([]*clanResolver, error) {
+	_, limit := pageArgs{Limit: args.Limit}.normalize()
+	offset := max(int(args.Offset), 0)
+
+	l := loadersFrom(ctx)
+	clans, err := getList[clan](ctx, l.client, "clan-service", fmt.Sprintf("/api/clans?limit=%d&offset=%d", limit, offset))
+	if err != nil {
+		return nil, err
+	}
+	resolvers := make([]*clanResolver, len(clans))
+	for i, c := range clans {
+		l.clans.Prime(c.ID, c)
+		resolvers[i] = &clanResolver{c}
+	}
+	return resolvers, nil
+}
+
+func (r *resolver) Post(ctx context.Context, args struct{ ID graphql.ID }) (*postResolver, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	return loadPost(ctx, id)
+}
+
+func (r *resolver) Posts(ctx context.Context, args pageArgs) ([]*postResolver, error) {
+	p, limit := args.normalize()
+
+	l := loadersFrom(ctx)
+	posts, err := getList[post](ctx, l.client, "post-service", fmt.Sprintf("/api/posts?page=%d&limit=%d", p, limit))
+	if err != nil {
+		return nil, err
+	}
+	l.primePosts(posts)
+	return postResolvers(posts), nil
+}
+
+func (r *resolver) Comment(ctx context.Context, args struct{ ID graphql.ID }) (*commentResolver, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	return loadComment(ctx, id)
+}
+
+func (r *resolver) CreatePost(ctx context.Context, args struct {
+	Title   string
+	Content string
+	ClanID  *graphql.ID
+}) (*postResolver, error) {
+	if _, ok := middleware.UserIDFromContext(ctx); !ok {
+		return nil, errUnauthenticated
+	}
+	if !middleware.EmailVerifiedFromContext(ctx) {
+		return nil, errUnverified
+	}
+	clanID, err := parseOptionalID(args.ClanID)
+	if err != nil {
+		return nil, err
+	}
+
+	body := map[string]interface{}{"title": args.Title, "content": args.Content, "clan_id": clanID}
+	var created post
+	if err := loadersFrom(ctx).client.post(ctx, "post-service", "/api/posts", body, &created); err != nil {
+		return nil, err
+	}
+	// The create response lacks joined fields such as the username.
+	return reloadPost(ctx, created.ID)
+}
+
+func (r *resolver) CreateComment(ctx context.Context, args struct {
+	PostID   graphql.ID
+	Content  string
+	ParentID *graphql.ID
+}) (*commentResolver, error) {
+	if _, ok := middleware.UserIDFromContext(ctx); !ok {
+		return nil, errUnauthenticated
+	}
+	if !middleware.EmailVerifiedFromContext(ctx) {
+		return nil, errUnverified
+	}
+	postID, err := parseID(args.PostID)
+	if err != nil {
+		return nil, err
+	}
+	parentID, err := parseOptionalID(args.ParentID)
+	if err != nil {
+		return nil, err
+	}
+
+	body := map[string]interface{}{"content": args.Content, "post_id": postID, "parent_id": parentID}
+	var created comment
+	if err := loadersFrom(ctx).client.post(ctx, "comment-service", "/api/comments", body, &created); err != nil {
+		return nil, err
+	}
+	return reloadComment(ctx, created.ID)
+}
+
+func (r *resolver) VotePost(ctx context.Context, args struct {
+	PostID graphql.ID
+	Upvote *bool
+}) (*postResolver, error) {
+	if _, ok := middleware.UserIDFromContext(ctx); !ok {
+		return nil, errUnauthenticated
+	}
+	id, err := parseID(args.PostID)
+	if err != nil {
+		return nil, err
+	}
+
+	body := map[string]interface{}{"is_upvote": args.Upvote}
+	if err := loadersFrom(ctx).client.post(ctx, "post-service", fmt.Sprintf("/api/posts/%d/vote", id), body, nil); err != nil {
+		return nil, err
+	}
+	return reloadPost(ctx, id)
+}
+
+func (r *resolver) VoteComment(ctx context.Context, args struct {
+	CommentID graphql.ID
+	Upvote    *bool
+}) (*commentResolver, error) {
+	if _, ok := middleware.UserIDFromContext(ctx); !ok {
+		return nil, errUnauthenticated
+	}
+	id, err := parseID(args.CommentID)
+	if err != nil {
+		return nil, err
+	}
+
+	body := map[string]interface{}{"is_upvote": args.Upvote}
+	if err := loadersFrom(ctx).client.post(ctx, "comment-service", fmt.Sprintf("/api/comments/%d/vote", id), body, nil); err != nil {
+		return nil, err
+	}
+	return reloadComment(ctx, id)
+}
+
+func (r *resolver) JoinClan(ctx context.Context, args struct{ ClanID graphql.ID }) (*membershipResolver, error) {
+	if _, ok := middleware.UserIDFromContext(ctx); !ok {
+		return nil, errUnauthenticated
+	}
+	id, err := parseID(args.ClanID)
+	if err != nil {
+		return nil, err
+	}
+
+	l := loadersFrom(ctx)
+	if err := l.client.post(ctx, "clan-service", fmt.Sprintf("/api/clans/%d/join", id), struct{}{}, nil); err != nil {
+		return nil, err
+	}
+
+	// The member count changed along with the membership.
+	l.clans.Clear(id)
+	l.clanMembers.Clear(id)
+	l.memberships.Clear(id)
+	m, err := l.memberships.Load(ctx, id)
+	if m == nil {
+		if err == nil {
+			err = fmt.Errorf("membership of clan %d not found after joining", id)
+		}
+		return nil, err
+	}
+	return &membershipResolver{m}, nil
+}
+
+// reloadPost fetches a post that a mutation just changed.
+func reloadPost(ctx context.Context, id int) (*postResolver, error) {
+	loadersFrom(ctx).posts.Clear(id)
+	p, err := loadPost(ctx, id)
+	if p == nil && err == nil {
+		err = fmt.Errorf("post %d not found", id)
+	}
+	return p, err
+}
+
+// reloadComment fetches a comment that a mutation just changed.
+func reloadComment(ctx context.Context, id int) (*commentResolver, error) {
+	loadersFrom(ctx).comments.Clear(id)
+	c, err := loadComment(ctx, id)
+	if c == nil && err == nil {
+		err = fmt.Errorf("comment %d not found", id)
+	}
+	return c, err
+}
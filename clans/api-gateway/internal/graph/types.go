@@ -0,0 +1,218 @@
+package graph
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/AlexGuo43/clans/api-gateway/internal/middleware"
+	"github.com/graph-gophers/graphql-go"
+)
+
+func toID(id int) graphql.ID {
+	return graphql.ID(strconv.Itoa(id))
+}
+
+func loadUser(ctx context.Context, id int) (*userResolver, error) {
+	u, err := loadersFrom(ctx).users.Load(ctx, id)
+	if u == nil {
+		return nil, err
+	}
+	return &userResolver{u}, nil
+}
+
+func loadClan(ctx context.Context, id int) (*clanResolver, error) {
+	c, err := loadersFrom(ctx).clans.Load(ctx, id)
+	if c == nil {
+		return nil, err
+	}
+	return &clanResolver{c}, nil
+}
+
+func loadPost(ctx context.Context, id int) (*postResolver, error) {
+	p, err := loadersFrom(ctx).posts.Load(ctx, id)
+	if p == nil {
+		return nil, err
+	}
+	return &postResolver{p}, nil
+}
+
+func loadComment(ctx context.Context, id int) (*commentResolver, error) {
+	c, err := loadersFrom(ctx).comments.Load(ctx, id)
+	if c == nil {
+		return nil, err
+	}
+	return &commentResolver{c}, nil
+}
+
+func postResolvers(posts []*post) []*postResolver {
+	resolvers := make([]*postResolver, len(posts))
+	for i, p := range posts {
+		resolvers[i] = &postResolver{p}
+	}
+	return resolvers
+}
+
+func commentResolvers(comments []*comment) []*commentResolver {
+	resolvers := make([]*commentResolver, len(comments))
+	for i, c := range comments {
+		resolvers[i] = &commentResolver{c}
+	}
+	return resolvers
+}
+
+// userResolver is often built from the username that posts, comments and
+// clans carry inline, so that authors cost no extra upstream call.
+type userResolver struct {
+	u *user
+}
+
+func (r *userResolver) ID() graphql.ID   { return toID(r.u.ID) }
+func (r *userResolver) Username() string { return r.u.Username }
+
+func (r *userResolver) Email(ctx context.Context) (*string, error) {
+	if userID, ok := middleware.UserIDFromContext(ctx); !ok || userID != r.u.ID {
+		return nil, nil
+	}
+	u, err := loadersFrom(ctx).users.Load(ctx, r.u.ID)
+	if u == nil {
+		return nil, err
+	}
+	return &u.Email, nil
+}
+
+type clanResolver struct {
+	c *clan
+}
+
+func (r *clanResolver) ID() graphql.ID      { return toID(r.c.ID) }
+func (r *clanResolver) Name() string        { return r.c.Name }
+func (r *clanResolver) DisplayName() string { return r.c.DisplayName }
+func (r *clanResolver) Description() string { return r.c.Description }
+func (r *clanResolver) MemberCount() int32  { return int32(r.c.MemberCount) }
+func (r *clanResolver) PostCount() int32    { return int32(r.c.PostCount) }
+func (r *clanResolver) IsPublic() bool      { return r.c.IsPublic }
+
+func (r *clanResolver) CreatedAt() graphql.Time { return graphql.Time{Time: r.c.CreatedAt} }
+func (r *clanResolver) UpdatedAt() graphql.Time { return graphql.Time{Time: r.c.UpdatedAt} }
+
+func (r *clanResolver) Owner() *userResolver {
+	return &userResolver{&user{ID: r.c.OwnerID, Username: r.c.OwnerName}}
+}
+
+func (r *clanResolver) Posts(ctx context.Context, args pageArgs) ([]*postResolver, error) {
+	p, limit := args.normalize()
+	posts, err := loadersFrom(ctx).clanPosts.Load(ctx, page{id: r.c.ID, page: p, limit: limit})
+	if err != nil {
+		return nil, err
+	}
+	return postResolvers(posts), nil
+}
+
+func (r *clanResolver) Members(ctx context.Context) ([]*membershipResolver, error) {
+	members, err := loadersFrom(ctx).clanMembers.Load(ctx, r.c.ID)
+	if err != nil {
+		return nil, err
+	}
+	resolvers := make([]*membershipResolver, len(members))
+	for i, m := range members {
+		resolvers[i] = &membershipResolver{m}
+	}
+	return resolvers, nil
+}
+
+func (r *clanResolver) ViewerMembership(ctx context.Context) (*membershipResolver, error) {
+	if _, ok := middleware.UserIDFromContext(ctx); !ok {
+		return nil, nil
+	}
+	m, err := loadersFrom(ctx).memberships.Load(ctx, r.c.ID)
+	if m == nil {
+		return nil, err
+	}
+	return &membershipResolver{m}, nil
+}
+
+type membershipResolver struct {
+	m *membership
+}
+
+func (r *membershipResolver) ID() graphql.ID         { return toID(r.m.ID) }
+func (r *membershipResolver) Role() string           { return strings.ToUpper(r.m.Role) }
+func (r *membershipResolver) JoinedAt() graphql.Time { return graphql.Time{Time: r.m.JoinedAt} }
+
+func (r *membershipResolver) Clan(ctx context.Context) (*clanResolver, error) {
+	return loadClan(ctx, r.m.ClanID)
+}
+
+func (r *membershipResolver) User() *userResolver {
+	return &userResolver{&user{ID: r.m.UserID, Username: r.m.Username}}
+}
+
+type postResolver struct {
+	p *post
+}
+
+func (r *postResolver) ID() graphql.ID          { return toID(r.p.ID) }
+func (r *postResolver) Title() string           { return r.p.Title }
+func (r *postResolver) Content() string         { return r.p.Content }
+func (r *postResolver) VoteCount() int32        { return int32(r.p.VoteCount) }
+func (r *postResolver) CreatedAt() graphql.Time { return graphql.Time{Time: r.p.CreatedAt} }
+func (r *postResolver) UpdatedAt() graphql.Time { return graphql.Time{Time: r.p.UpdatedAt} }
+
+func (r *postResolver) Author() *userResolver {
+	return &userResolver{&user{ID: r.p.UserID, Username: r.p.Username}}
+}
+
+func (r *postResolver) Clan(ctx context.Context) (*clanResolver, error) {
+	if r.p.ClanID == nil {
+		return nil, nil
+	}
+	return loadClan(ctx, *r.p.ClanID)
+}
+
+func (r *postResolver) Comments(ctx context.Context, args pageArgs) ([]*commentResolver, error) {
+	p, limit := args.normalize()
+	comments, err := loadersFrom(ctx).postComments.Load(ctx, page{id: r.p.ID, page: p, limit: limit})
+	if err != nil {
+		return nil, err
+	}
+	return commentResolvers(comments), nil
+}
+
+type commentResolver struct {
+	c *comment
+}
+
+func (r *commentResolver) ID() graphql.ID          { return toID(r.c.ID) }
+func (r *commentResolver) Content() string         { return r.c.Content }
+func (r *commentResolver) VoteCount() int32        { return int32(r.c.VoteCount) }
+func (r *commentResolver) ReplyCount() int32       { return int32(r.c.ReplyCount) }
+func (r *commentResolver) Depth() int32            { return int32(r.c.Depth) }
+func (r *commentResolver) CreatedAt() graphql.Time { return graphql.Time{Time: r.c.CreatedAt} }
+func (r *commentResolver) UpdatedAt() graphql.Time { return graphql.Time{Time: r.c.UpdatedAt} }
+
+func (r *commentResolver) Author() *userResolver {
+	return &userResolver{&user{ID: r.c.UserID, Username: r.c.Username}}
+}
+
+func (r *commentResolver) Post(ctx context.Context) (*postResolver, error) {
+	return loadPost(ctx, r.c.PostID)
+}
+
+func (r *commentResolver) Parent(ctx context.Context) (*commentResolver, error) {
+	if r.c.ParentID == nil {
+		return nil, nil
+	}
+	return loadComment(ctx, *r.c.ParentID)
+}
+
+func (r *commentResolver) Replies(ctx context.Context) ([]*commentResolver, error) {
+	if r.c.Replies != nil {
+		return commentResolvers(r.c.Replies), nil
+	}
+	replies, err := loadersFrom(ctx).replies.Load(ctx, r.c.ID)
+	if err != nil {
+		return nil, err
+	}
+	return commentResolvers(replies), nil
+}
@@ -0,0 +1,120 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrMismatch means the key was first used for a different request.
+	ErrMismatch = errors.New("idempotency key was used for a different request")
+	// ErrInProgress means the first request with the key has not finished.
+	ErrInProgress = errors.New("a request with this idempotency key is in progress")
+)
+
+// Response is a stored response, replayed for retries.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Store remembers the first response for each key. Fingerprint identifies
+// the request the key was first used for, so that reusing a key for another
+// request can be refused. Implementations must be safe for concurrent use;
+// a shared store lets retries land on any gateway instance.
+type Store interface {
+	// Start claims key for a request. It returns the stored response when
+	// there is one, nil when the caller should go ahead and then call Finish
+	// or Cancel, ErrMismatch when the key belongs to another request and
+	// ErrInProgress while the first request is still running.
+	Start(ctx context.Context, key, fingerprint string, ttl time.Duration) (*Response, error)
+	// Finish stores the response for a claimed key until ttl has passed.
+	Finish(ctx context.Context, key string, response *Response, ttl time.Duration) error
+	// Cancel releases a claimed key without storing a response, so the
+	// request can be retried.
+	Cancel(ctx context.Context, key string) error
+}
+
+type entry struct {
+	fingerprint string
+	response    *Response
+	expiresAt   time.Time
+}
+
+// MemoryStore keeps responses in process memory.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]*entry
+	lastSweep time.Time
+}
+
+const sweepInterval = time.Minute
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries:   make(map[string]*entry),
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *MemoryStore) Start(ctx context.Context, key, fingerprint string, ttl time.Duration) (*Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	e, ok := s.entries[key]
+	switch {
+	case !ok || now.After(e.expiresAt):
+		// A request that never finished holds the key no longer than a
+		// stored response would.
+		s.entries[key] = &entry{fingerprint: fingerprint, expiresAt: now.Add(ttl)}
+		return nil, nil
+	case e.fingerprint != fingerprint:
+		return nil, ErrMismatch
+	case e.response == nil:
+		return nil, ErrInProgress
+	default:
+		return e.response, nil
+	}
+}
+
+func (s *MemoryStore) Finish(ctx context.Context, key string, response *Response, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok {
+		e.response = response
+		e.expiresAt = time.Now().Add(ttl)
+	}
+	return nil
+}
+
+func (s *MemoryStore) Cancel(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok && e.response == nil {
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+// sweep drops expired entries.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, e := range s.entries {
+		if now.After(e.expiresAt) {
+			delete(s.entries, key)
+		}
+	}
+}
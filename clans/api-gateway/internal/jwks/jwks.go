@@ -0,0 +1,203 @@
+package jwks
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AlexGuo43/clans/api-gateway/internal/identity"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Methods are the signing algorithms access tokens may use.
+var Methods = []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}
+
+// Service and Path locate the user service's public signing keys.
+const (
+	Service = "user-service"
+	Path    = "/.well-known/jwks.json"
+)
+
+// minRefresh spaces out the refreshes triggered by tokens signed with an
+// unknown key, so a flood of forged kids cannot flood the user service.
+const minRefresh = 10 * time.Second
+
+// JWK is a public key in JSON Web Key form. Only the RSA and Ed25519 members
+// the user service publishes are read.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+}
+
+type key struct {
+	alg    string
+	public interface{}
+}
+
+// Keys is the gateway's copy of the keys access tokens are signed with. The
+// nil Keys knows no key, so every token is refused.
+type Keys struct {
+	mu          sync.RWMutex
+	keys        map[string]key
+	lastRefresh time.Time
+	refresh     chan struct{}
+}
+
+func NewKeys() *Keys {
+	return &Keys{keys: make(map[string]key), refresh: make(chan struct{}, 1)}
+}
+
+// Keyfunc finds the key a token was signed with, for jwt.Parse. A token
+// signed with an unknown key is refused, and the keys are fetched again in
+// case it is a newly published one.
+func (k *Keys) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if k == nil {
+		return nil, errors.New("no signing keys")
+	}
+	kid, _ := token.Header["kid"].(string)
+
+	k.mu.RLock()
+	found, ok := k.keys[kid]
+	k.mu.RUnlock()
+	if !ok {
+		select {
+		case k.refresh <- struct{}{}:
+		default:
+		}
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != found.alg {
+		return nil, fmt.Errorf("key %q does not sign %s", kid, token.Method.Alg())
+	}
+	return found.public, nil
+}
+
+// Replace swaps in a fresh set of keys. Keys that are not for signing or
+// cannot be decoded are skipped.
+func (k *Keys) Replace(jwks []JWK) {
+	keys := make(map[string]key, len(jwks))
+	for _, jwk := range jwks {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		decoded, err := jwk.decode()
+		if err != nil {
+			log.Printf("Skipping signing key %q: %v", jwk.KeyID, err)
+			continue
+		}
+		keys[jwk.KeyID] = decoded
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.mu.Unlock()
+}
+
+func (jwk JWK) decode() (key, error) {
+	switch {
+	case jwk.KeyType == "RSA" && (jwk.Algorithm == "" || jwk.Algorithm == jwt.SigningMethodRS256.Alg()):
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return key{}, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return key{}, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 || exponent.Int64() < 3 {
+			return key{}, errors.New("invalid RSA exponent")
+		}
+		public := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+		if public.N.BitLen() < 2048 {
+			return key{}, errors.New("RSA keys must have at least 2048 bits")
+		}
+		return key{alg: jwt.SigningMethodRS256.Alg(), public: public}, nil
+	case jwk.KeyType == "OKP" && jwk.Curve == "Ed25519" && (jwk.Algorithm == "" || jwk.Algorithm == jwt.SigningMethodEdDSA.Alg()):
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return key{}, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return key{}, errors.New("invalid Ed25519 key")
+		}
+		return key{alg: jwt.SigningMethodEdDSA.Alg(), public: ed25519.PublicKey(x)}, nil
+	default:
+		return key{}, fmt.Errorf("unsupported key type %q with algorithm %q", jwk.KeyType, jwk.Algorithm)
+	}
+}
+
+// Upstream is how the keys are fetched; *proxy.Gateway implements it.
+type Upstream interface {
+	Fetch(ctx context.Context, service, path string) (*http.Response, error)
+}
+
+// Sync fetches the keys from upstream now, then every interval and when a
+// token names an unknown key, until ctx is cancelled. When a fetch fails the
+// previous keys are kept.
+func (k *Keys) Sync(ctx context.Context, upstream Upstream, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := k.fetch(ctx, upstream); err != nil && ctx.Err() == nil {
+				log.Printf("Failed to fetch token signing keys: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-k.refresh:
+				k.mu.RLock()
+				wait := minRefresh - time.Since(k.lastRefresh)
+				k.mu.RUnlock()
+				if wait > 0 {
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(wait):
+					}
+				}
+			}
+		}
+	}()
+}
+
+func (k *Keys) fetch(ctx context.Context, upstream Upstream) error {
+	k.mu.Lock()
+	k.lastRefresh = time.Now()
+	k.mu.Unlock()
+
+	resp, err := upstream.Fetch(identity.AsGateway(ctx), Service, Path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", Service, resp.StatusCode)
+	}
+	var body struct {
+		Keys []JWK `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return err
+	}
+	k.Replace(body.Keys)
+	return nil
+}
@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Requests served by the gateway by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "End-to-end gateway latency by route and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	// UpstreamRequestDuration covers a single attempt against one backend,
+	// so retries show up as separate observations.
+	UpstreamRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "upstream_request_duration_seconds",
+		Help:    "Latency of upstream attempts by service and status (\"error\" when no response).",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"service", "status"})
+
+	UpstreamRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "upstream_retries_total",
+		Help: "Upstream attempts that were retried, by service.",
+	}, []string{"service"})
+
+	OpenStreams = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "open_streams",
+		Help: "Open WebSocket and Server-Sent Events streams by service and kind.",
+	}, []string{"service", "kind"})
+
+	RateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rate_limited_requests_total",
+		Help: "Requests rejected with 429 by route.",
+	}, []string{"route"})
+
+	InvalidRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "invalid_requests_total",
+		Help: "Requests rejected with 400 for not matching the OpenAPI spec, by route.",
+	}, []string{"route"})
+
+	IdempotentReplays = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "idempotent_replays_total",
+		Help: "Stored responses replayed for retries with an Idempotency-Key, by route.",
+	}, []string{"route"})
+
+	CacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_requests_total",
+		Help: "Requests to cached routes by route and result (\"hit\", \"stale\", \"miss\" or \"bypass\").",
+	}, []string{"route", "result"})
+
+	APIVersionRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "api_version_requests_total",
+		Help: "Requests by the API version they were served as.",
+	}, []string{"version"})
+
+	ConfigReloads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "config_reloads_total",
+		Help: "Config reloads by result (\"success\" or \"failure\").",
+	}, []string{"result"})
+)
@@ -6,69 +6,102 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/AlexGuo43/clans/api-gateway/internal/identity"
+	"github.com/AlexGuo43/clans/api-gateway/internal/routing"
 	"github.com/AlexGuo43/clans/api-gateway/internal/services"
 )
 
+type contextKey string
+
+const (
+	userIDKey        contextKey = "userID"
+	emailVerifiedKey contextKey = "emailVerified"
+)
+
+// identityHeaders are only ever set by the gateway. Whatever the client sent
+// under these names is dropped before routing to a service.
+var identityHeaders = []string{"X-User-ID", "X-User-Roles", identity.Header}
+
+// UserIDFromContext returns the authenticated user ID set by AuthMiddleware.
+func UserIDFromContext(ctx context.Context) (int, bool) {
+	userID, ok := ctx.Value(userIDKey).(int)
+	return userID, ok
+}
+
+// EmailVerifiedFromContext reports whether the authenticated user has
+// verified their email address.
+func EmailVerifiedFromContext(ctx context.Context) bool {
+	verified, _ := ctx.Value(emailVerifiedKey).(bool)
+	return verified
+}
+
 func AuthMiddleware(authService *services.AuthService) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if isPublicEndpoint(r.URL.Path, r.Method) {
+			for _, header := range identityHeaders {
+				r.Header.Del(header)
+			}
+
+			if match := routing.FromContext(r.Context()); match != nil && match.Route.Public {
+				// A token is optional on public routes, but a valid one still
+				// identifies the caller to the service.
+				if user, err := authService.ValidateJWT(bearerToken(r)); err == nil {
+					r = withUser(r, user)
+				}
 				next.ServeHTTP(w, r)
 				return
 			}
 
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
+			token := bearerToken(r)
+			if token == "" {
 				http.Error(w, "Missing authorization header", http.StatusUnauthorized)
 				return
 			}
 
-			token := strings.TrimPrefix(authHeader, "Bearer ")
-			userID, err := authService.ValidateJWT(token)
+			user, err := authService.ValidateJWT(token)
 			if err != nil {
 				http.Error(w, "Invalid token", http.StatusUnauthorized)
 				return
 			}
+			if match := routing.FromContext(r.Context()); match != nil && match.Route.VerifiedEmail && !user.EmailVerified {
+				http.Error(w, "Email address not verified", http.StatusForbidden)
+				return
+			}
 
-			ctx := context.WithValue(r.Context(), "userID", userID)
-			r.Header.Set("X-User-ID", fmt.Sprintf("%d", userID))
-			
-			next.ServeHTTP(w, r.WithContext(ctx))
+			next.ServeHTTP(w, withUser(r, user))
 		})
 	}
 }
 
-func isPublicEndpoint(path, method string) bool {
-	publicEndpoints := map[string][]string{
-		"/api/auth/signup":     {"POST"},
-		"/api/auth/login":      {"POST"},
-		"/api/posts":           {"GET"},
-		"/api/clans":           {"GET"},
-		"/health":              {"GET"},
-	}
-
-	if strings.HasPrefix(path, "/api/posts/") && method == "GET" {
-		return true
-	}
+// AccessTokenParam carries the token for streaming requests, because
+// browsers cannot set headers on WebSocket and EventSource connections.
+const AccessTokenParam = "access_token"
 
-	if strings.HasPrefix(path, "/api/comments/") && method == "GET" {
-		return true
+func bearerToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		return strings.TrimPrefix(header, "Bearer ")
 	}
-
-	if strings.HasPrefix(path, "/api/clans/") && method == "GET" {
-		return true
+	if StreamKind(r) != "" {
+		return r.URL.Query().Get(AccessTokenParam)
 	}
+	return ""
+}
 
-	allowedMethods, exists := publicEndpoints[path]
-	if !exists {
-		return false
+// StreamKind reports whether r opens a long-lived stream: "websocket" for
+// WebSocket upgrades, "sse" for Server-Sent Events and "" otherwise.
+func StreamKind(r *http.Request) string {
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return "websocket"
 	}
-
-	for _, allowedMethod := range allowedMethods {
-		if method == allowedMethod {
-			return true
-		}
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		return "sse"
 	}
+	return ""
+}
 
-	return false
-}
\ No newline at end of file
+func withUser(r *http.Request, user *services.User) *http.Request {
+	setLogUserID(r.Context(), user.ID)
+	r.Header.Set("X-User-ID", fmt.Sprintf("%d", user.ID))
+	ctx := context.WithValue(r.Context(), userIDKey, user.ID)
+	return r.WithContext(context.WithValue(ctx, emailVerifiedKey, user.EmailVerified))
+}
@@ -0,0 +1,441 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AlexGuo43/clans/api-gateway/config"
+	"github.com/AlexGuo43/clans/api-gateway/internal/cache"
+	"github.com/AlexGuo43/clans/api-gateway/internal/metrics"
+	"github.com/AlexGuo43/clans/api-gateway/internal/routing"
+	"github.com/AlexGuo43/clans/api-gateway/internal/versioning"
+)
+
+const (
+	// CacheStatusHeader tells clients whether a response came from the
+	// cache: HIT, STALE or MISS.
+	CacheStatusHeader = "X-Cache"
+	// CacheTagHeader lets a service tag its response with the data in it,
+	// as a comma-separated list. It is not passed on to clients.
+	CacheTagHeader = "Cache-Tag"
+)
+
+// CacheMiddleware serves anonymous GETs on routes with a cache block from
+// store. Responses are keyed by version, path, query and the route's vary
+// headers, and kept for the route's ttl unless the service's Cache-Control
+// says otherwise (max-age, s-maxage, stale-while-revalidate, or no-store,
+// no-cache and private, which are not cached). A stale response is served
+// while one request refreshes it in the background. Only 200 responses
+// without cookies are cached. It must run after AuthMiddleware, since
+// requests from signed-in users are never cached. A successful write on a
+// route with purge tags removes the entries with those tags.
+func CacheMiddleware(store cache.Store, cfg config.CacheConfig) func(http.Handler) http.Handler {
+	var refreshing sync.Map
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			match := routing.FromContext(r.Context())
+			if match != nil && len(match.Route.Purge) > 0 && !isRead(r.Method) {
+				next.ServeHTTP(&purgeWriter{ResponseWriter: w, purge: func() {
+					purgeRoute(context.WithoutCancel(r.Context()), store, match)
+				}}, r)
+				return
+			}
+			if match == nil || match.Route.Cache == nil || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			route := match.Route
+
+			requestDirectives := cacheControl(r.Header)
+			if _, signedIn := UserIDFromContext(r.Context()); signedIn || r.Header.Get("Authorization") != "" ||
+				StreamKind(r) != "" || requestDirectives.has("no-store") {
+				metrics.CacheRequests.WithLabelValues(route.ID, "bypass").Inc()
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := cacheKey(r, route.Cache.Vary)
+			ctx := context.WithoutCancel(r.Context())
+
+			// no-cache and max-age=0 from the client skip the lookup, but the
+			// fresh response is still stored.
+			if !requestDirectives.has("no-cache") && requestDirectives["max-age"] != "0" {
+				entry, err := store.Get(ctx, key)
+				if err != nil {
+					log.Printf("Cache store error: %v", err)
+				}
+				if entry != nil && varyMatches(entry, r) {
+					now := time.Now()
+					if entry.Fresh(now) {
+						metrics.CacheRequests.WithLabelValues(route.ID, "hit").Inc()
+						serveEntry(w, r, entry, "HIT", now)
+						return
+					}
+					metrics.CacheRequests.WithLabelValues(route.ID, "stale").Inc()
+					if _, busy := refreshing.LoadOrStore(key, struct{}{}); !busy {
+						refresh := upstreamRequest(r, ctx)
+						go func() {
+							defer refreshing.Delete(key)
+							fill(next, refresh, discardWriter{header: make(http.Header)}, store, key, match, cfg)
+						}()
+					}
+					serveEntry(w, r, entry, "STALE", now)
+					return
+				}
+			}
+
+			metrics.CacheRequests.WithLabelValues(route.ID, "miss").Inc()
+			w.Header().Set(CacheStatusHeader, "MISS")
+			// The handlers behind this one have set the response headers
+			// already; only the body is held back.
+			if entry := fill(next, upstreamRequest(r, ctx), w, store, key, match, cfg); entry != nil {
+				writeEntry(w, r, entry)
+			}
+		})
+	}
+}
+
+// CachePurger purges the tags of the route a write to method and path
+// matches in table, as CacheMiddleware does for writes from clients. Views
+// that write to the services call it after each successful write.
+func CachePurger(store cache.Store, table *routing.Table) func(ctx context.Context, method, path string) {
+	return func(ctx context.Context, method, path string) {
+		if match := table.Match(method, path); match != nil && len(match.Route.Purge) > 0 && !isRead(method) {
+			purgeRoute(ctx, store, match)
+		}
+	}
+}
+
+func isRead(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+func purgeRoute(ctx context.Context, store cache.Store, match *routing.Match) {
+	if _, err := store.Purge(ctx, cacheTags(match.Route.Purge, match.Params, nil)); err != nil {
+		log.Printf("Cache purge error: %v", err)
+	}
+}
+
+// purgeWriter purges once the service has answered a write with a 2xx,
+// before the response reaches the client, so that the client's next read
+// is not served from the cache.
+type purgeWriter struct {
+	http.ResponseWriter
+	purge       func()
+	wroteHeader bool
+}
+
+func (pw *purgeWriter) WriteHeader(code int) {
+	if !pw.wroteHeader && code >= 200 {
+		pw.wroteHeader = true
+		if code < 300 {
+			pw.purge()
+		}
+	}
+	pw.ResponseWriter.WriteHeader(code)
+}
+
+func (pw *purgeWriter) Write(b []byte) (int, error) {
+	if !pw.wroteHeader {
+		pw.WriteHeader(http.StatusOK)
+	}
+	return pw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (pw *purgeWriter) Unwrap() http.ResponseWriter {
+	return pw.ResponseWriter
+}
+
+// upstreamRequest copies r for filling the cache. Conditional headers are
+// dropped so that the service sends the whole response; they are answered
+// from the stored one.
+func upstreamRequest(r *http.Request, ctx context.Context) *http.Request {
+	upstream := r.Clone(ctx)
+	upstream.Method = http.MethodGet
+	upstream.Header.Del("If-None-Match")
+	upstream.Header.Del("If-Modified-Since")
+	return upstream
+}
+
+// fill runs r and stores the response if it can be cached. It returns the
+// response for the caller to send, or nil when it was already written to w
+// because it could not be cached.
+func fill(next http.Handler, r *http.Request, w http.ResponseWriter, store cache.Store, key string, match *routing.Match, cfg config.CacheConfig) *cache.Entry {
+	before := w.Header().Clone()
+	recorder := &cacheRecorder{ResponseWriter: w, status: http.StatusOK, limit: int(cfg.MaxEntrySize)}
+	next.ServeHTTP(recorder, r)
+	if recorder.passthrough {
+		return nil
+	}
+
+	header := addedHeaders(before, w.Header())
+	serviceTags := header.Values(CacheTagHeader)
+	header.Del(CacheTagHeader)
+	w.Header().Del(CacheTagHeader)
+	entry := &cache.Entry{
+		Status:   recorder.status,
+		Header:   header,
+		Body:     recorder.body.Bytes(),
+		StoredAt: time.Now(),
+	}
+
+	route := match.Route.Cache
+	entry.TTL, entry.StaleWhileRevalidate = route.TTL, route.StaleWhileRevalidate
+	if storable(entry, r) {
+		entry.Tags = cacheTags(route.Tags, match.Params, serviceTags)
+		if err := store.Set(r.Context(), key, entry); err != nil {
+			log.Printf("Cache store error: %v", err)
+		}
+	}
+	return entry
+}
+
+// storable applies the service's Cache-Control and Vary to entry.
+func storable(entry *cache.Entry, r *http.Request) bool {
+	if entry.Status != http.StatusOK || entry.Header.Get("Set-Cookie") != "" {
+		return false
+	}
+
+	directives := cacheControl(entry.Header)
+	if directives.has("no-store") || directives.has("no-cache") || directives.has("private") {
+		return false
+	}
+	if seconds, ok := directives.seconds("s-maxage"); ok {
+		entry.TTL = seconds
+	} else if seconds, ok := directives.seconds("max-age"); ok {
+		entry.TTL = seconds
+	}
+	if seconds, ok := directives.seconds("stale-while-revalidate"); ok {
+		entry.StaleWhileRevalidate = seconds
+	}
+	if entry.TTL <= 0 {
+		return false
+	}
+
+	for _, value := range entry.Header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(name))
+			switch name {
+			case "*":
+				return false
+			case "", "Accept-Encoding":
+				// The cache holds uncompressed responses.
+			default:
+				if entry.Vary == nil {
+					entry.Vary = make(map[string]string)
+				}
+				entry.Vary[name] = r.Header.Get(name)
+			}
+		}
+	}
+	return true
+}
+
+func varyMatches(entry *cache.Entry, r *http.Request) bool {
+	for name, value := range entry.Vary {
+		if r.Header.Get(name) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// serveEntry writes a stored response. Headers this request already has,
+// such as its own X-Request-ID, are kept.
+func serveEntry(w http.ResponseWriter, r *http.Request, entry *cache.Entry, status string, now time.Time) {
+	header := w.Header()
+	for name, values := range entry.Header {
+		if _, ok := header[name]; !ok || name == "Vary" {
+			header[name] = append(header[name], values...)
+		}
+	}
+	header.Set(CacheStatusHeader, status)
+	header.Set("Age", strconv.Itoa(int(now.Sub(entry.StoredAt).Seconds())))
+	writeEntry(w, r, entry)
+}
+
+// writeEntry writes the status and body of entry, answering If-None-Match
+// from its ETag.
+func writeEntry(w http.ResponseWriter, r *http.Request, entry *cache.Entry) {
+	header := w.Header()
+	if tag := entry.Header.Get("ETag"); entry.Status == http.StatusOK && tag != "" && etagMatches(r.Header.Get("If-None-Match"), tag) {
+		header.Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(entry.Status)
+	if r.Method != http.MethodHead {
+		w.Write(entry.Body)
+	}
+}
+
+// etagMatches compares weakly, as If-None-Match does.
+func etagMatches(ifNoneMatch, tag string) bool {
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	tag = strings.TrimPrefix(tag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func cacheKey(r *http.Request, vary []string) string {
+	var key strings.Builder
+	key.WriteString(versioning.Name(r.Context()))
+	key.WriteString(" ")
+	key.WriteString(r.URL.Path)
+	if query := r.URL.Query(); len(query) > 0 {
+		// Encode sorts by name, so the order of parameters does not matter.
+		key.WriteString("?" + query.Encode())
+	}
+	for _, name := range vary {
+		key.WriteString("\x00" + name + "=" + r.Header.Get(name))
+	}
+	return key.String()
+}
+
+// cacheTags expands the route's tags with the path parameters and adds the
+// ones the service sent.
+func cacheTags(templates []string, params map[string]string, serviceTags []string) []string {
+	var tags []string
+	for _, template := range templates {
+		for name, value := range params {
+			template = strings.ReplaceAll(template, "{"+name+"}", value)
+		}
+		tags = append(tags, template)
+	}
+	for _, value := range serviceTags {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" && !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// addedHeaders returns the header values in after that are not in before,
+// which are the ones the handlers behind this middleware set.
+func addedHeaders(before, after http.Header) http.Header {
+	added := make(http.Header)
+	for name, values := range after {
+		if len(values) > len(before[name]) {
+			added[name] = slices.Clone(values[len(before[name]):])
+		}
+	}
+	return added
+}
+
+type directives map[string]string
+
+func cacheControl(header http.Header) directives {
+	d := make(directives)
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			d[strings.ToLower(name)] = strings.Trim(arg, `"`)
+		}
+	}
+	return d
+}
+
+func (d directives) has(name string) bool {
+	_, ok := d[name]
+	return ok
+}
+
+func (d directives) seconds(name string) (time.Duration, bool) {
+	n, err := strconv.Atoi(d[name])
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// cacheRecorder holds a response back so that it can be stored and then
+// served. A response that grows past limit, or an event stream, is written
+// through instead and not cached.
+type cacheRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+	limit       int
+	passthrough bool
+}
+
+func (cr *cacheRecorder) WriteHeader(code int) {
+	if cr.passthrough {
+		cr.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if !cr.wroteHeader && code >= 200 {
+		cr.status = code
+		cr.wroteHeader = true
+	}
+}
+
+func (cr *cacheRecorder) Write(b []byte) (int, error) {
+	if !cr.wroteHeader {
+		cr.WriteHeader(http.StatusOK)
+	}
+	if !cr.passthrough && cr.limit > 0 && cr.body.Len()+len(b) > cr.limit {
+		cr.writeThrough()
+	}
+	if cr.passthrough {
+		return cr.ResponseWriter.Write(b)
+	}
+	return cr.body.Write(b)
+}
+
+// Flush is ignored while the response is held back, since ReverseProxy
+// flushes every write of a response without a Content-Length. Event streams
+// are written through.
+func (cr *cacheRecorder) Flush() {
+	if !cr.passthrough {
+		if !strings.HasPrefix(cr.Header().Get("Content-Type"), "text/event-stream") {
+			return
+		}
+		if !cr.wroteHeader {
+			cr.WriteHeader(http.StatusOK)
+		}
+		cr.writeThrough()
+	}
+	http.NewResponseController(cr.ResponseWriter).Flush()
+}
+
+func (cr *cacheRecorder) writeThrough() {
+	cr.passthrough = true
+	cr.ResponseWriter.Header().Del(CacheTagHeader)
+	cr.ResponseWriter.WriteHeader(cr.status)
+	cr.ResponseWriter.Write(cr.body.Bytes())
+	cr.body.Reset()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (cr *cacheRecorder) Unwrap() http.ResponseWriter {
+	return cr.ResponseWriter
+}
+
+// discardWriter takes the response to a background refresh.
+type discardWriter struct {
+	header http.Header
+}
+
+func (d discardWriter) Header() http.Header         { return d.header }
+func (d discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (d discardWriter) WriteHeader(int)             {}
@@ -0,0 +1,187 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/AlexGuo43/clans/api-gateway/config"
+	"github.com/andybalholm/brotli"
+)
+
+// encoder is implemented by *gzip.Writer and *brotli.Writer.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// brotliLevel trades some compression for speed, which suits responses
+// compressed on the fly.
+const brotliLevel = 4
+
+var encoders = map[string]*sync.Pool{
+	"gzip": {New: func() any { return gzip.NewWriter(nil) }},
+	"br":   {New: func() any { return brotli.NewWriterLevel(nil, brotliLevel) }},
+}
+
+// CompressionMiddleware compresses responses with the first of the
+// configured encodings the client accepts. Only text and JSON are
+// compressed; streams, responses the service already encoded and responses
+// known to be smaller than the minimum size pass through. A compressed
+// response is no longer byte for byte what a strong ETag promised, so its
+// tag is marked weak; If-None-Match still matches it.
+func CompressionMiddleware(cfg config.CompressionConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(cfg.Encodings) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cw := &compressWriter{
+				ResponseWriter: w,
+				encoding:       negotiateEncoding(r.Header.Get("Accept-Encoding"), cfg.Encodings),
+				minSize:        int64(cfg.MinSize),
+				head:           r.Method == http.MethodHead,
+			}
+			defer cw.close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiateEncoding picks the first of supported that Accept-Encoding
+// allows. "gzip;q=0" refuses gzip, and "*" stands for encodings not listed.
+func negotiateEncoding(header string, supported []string) string {
+	if header == "" {
+		return ""
+	}
+
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				quality = parsed
+			}
+		}
+		qualities[strings.ToLower(strings.TrimSpace(name))] = quality
+	}
+
+	best, bestQuality := "", 0.0
+	for _, encoding := range supported {
+		quality, ok := qualities[encoding]
+		if !ok {
+			quality, ok = qualities["*"]
+		}
+		if ok && quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+	return best
+}
+
+func compressibleType(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "text/event-stream":
+		return false
+	case strings.HasPrefix(mediaType, "text/"),
+		mediaType == "application/json", strings.HasSuffix(mediaType, "+json"),
+		mediaType == "application/xml", strings.HasSuffix(mediaType, "+xml"),
+		mediaType == "application/javascript":
+		return true
+	}
+	return false
+}
+
+// compressWriter decides whether to compress when the status is written,
+// from the headers set by then.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int64
+	head     bool
+
+	wroteHeader bool
+	encoder     encoder
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	// Informational responses, such as 101 for a WebSocket upgrade, come
+	// before the real one.
+	if cw.wroteHeader || code < 200 {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	cw.wroteHeader = true
+
+	if cw.shouldCompress(code) {
+		header := cw.Header()
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length")
+		if tag := header.Get("ETag"); strings.HasPrefix(tag, `"`) {
+			header.Set("ETag", "W/"+tag)
+		}
+		cw.encoder = encoders[cw.encoding].Get().(encoder)
+		cw.encoder.Reset(cw.ResponseWriter)
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *compressWriter) shouldCompress(code int) bool {
+	header := cw.Header()
+	if !compressibleType(header.Get("Content-Type")) || header.Get("Content-Encoding") != "" {
+		return false
+	}
+	// The response could have been compressed, so caches must keep the
+	// variants apart even when this one is not.
+	header.Add("Vary", "Accept-Encoding")
+
+	if cw.encoding == "" || cw.head || code == http.StatusNoContent || code == http.StatusNotModified {
+		return false
+	}
+	if length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64); err == nil && length < cw.minSize {
+		return false
+	}
+	return true
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.encoder != nil {
+		return cw.encoder.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush sends what has been compressed so far.
+func (cw *compressWriter) Flush() {
+	if cw.encoder != nil {
+		cw.encoder.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, such as
+// to hijack the connection for a WebSocket.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// close finishes the compressed stream.
+func (cw *compressWriter) close() {
+	if cw.encoder == nil {
+		return
+	}
+	cw.encoder.Close()
+	cw.encoder.Reset(nil)
+	encoders[cw.encoding].Put(cw.encoder)
+	cw.encoder = nil
+}
@@ -1,19 +1,96 @@
 package middleware
 
-import "net/http"
+import (
+	"net/http"
+	"strconv"
+	"strings"
 
-func CorsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "https://clans-frontend.vercel.app")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	"github.com/AlexGuo43/clans/api-gateway/config"
+	"github.com/AlexGuo43/clans/api-gateway/internal/cors"
+	"github.com/AlexGuo43/clans/api-gateway/internal/routing"
+	"github.com/AlexGuo43/clans/api-gateway/internal/versioning"
+)
+
+// CorsMiddleware applies the CORS policy. Preflight requests are answered
+// here, before authentication, using the rules of the route that the actual
+// request would match.
+func CorsMiddleware(policy *cors.Policy, table *routing.Table) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Origin")
+
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !policy.AllowOrigin(origin) {
+				if preflight {
+					http.Error(w, "CORS origin not allowed", http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if preflight {
+				handlePreflight(w, r, policy, table, origin)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if policy.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+			if len(policy.ExposedHeaders) > 0 {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(policy.ExposedHeaders, ", "))
+			}
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func handlePreflight(w http.ResponseWriter, r *http.Request, policy *cors.Policy, table *routing.Table, origin string) {
+	w.Header().Add("Vary", "Access-Control-Request-Method")
+	w.Header().Add("Vary", "Access-Control-Request-Headers")
+
+	method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+	var route *config.RouteConfig
+	if match := table.MatchVersion(method, r.URL.Path, versioning.Name(r.Context())); match != nil {
+		route = &match.Route.RouteConfig
+	}
+
+	methods := policy.Methods(route)
+	headers := policy.Headers(route)
+
+	var requested []string
+	for _, value := range r.Header.Values("Access-Control-Request-Headers") {
+		for _, header := range strings.Split(value, ",") {
+			if header = strings.TrimSpace(header); header != "" {
+				requested = append(requested, header)
+			}
 		}
+	}
+
+	if !cors.AllowsMethod(methods, method) || !cors.AllowsHeaders(headers, requested) {
+		http.Error(w, "CORS request not allowed", http.StatusForbidden)
+		return
+	}
 
-		next.ServeHTTP(w, r)
-	})
-}
\ No newline at end of file
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	if len(requested) > 0 {
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+	}
+	if policy.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+	if policy.MaxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge.Seconds())))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ForwardedInfo describes where a request came from once trusted proxies in
+// front of the gateway have been accounted for.
+type ForwardedInfo struct {
+	ClientIP string
+	// TrustedPeer is true when the direct peer is a trusted proxy, in which
+	// case its X-Forwarded-* headers are kept and extended.
+	TrustedPeer bool
+}
+
+const forwardedKey contextKey = "forwarded"
+
+func ForwardedFromContext(ctx context.Context) (ForwardedInfo, bool) {
+	info, ok := ctx.Value(forwardedKey).(ForwardedInfo)
+	return info, ok
+}
+
+// ForwardedMiddleware resolves the real client IP. X-Forwarded-For is only
+// honoured when the peer is a trusted proxy, and then the chain is walked
+// from the right until the first untrusted address.
+func ForwardedMiddleware(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	isTrusted := func(ip string) bool {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			return false
+		}
+		for _, prefix := range trusted {
+			if prefix.Contains(addr.Unmap()) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			peer, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				peer = r.RemoteAddr
+			}
+
+			info := ForwardedInfo{ClientIP: peer}
+			if isTrusted(peer) {
+				info.TrustedPeer = true
+
+				var chain []string
+				for _, value := range r.Header.Values("X-Forwarded-For") {
+					chain = append(chain, strings.Split(value, ",")...)
+				}
+				for i := len(chain) - 1; i >= 0; i-- {
+					info.ClientIP = strings.TrimSpace(chain[i])
+					if !isTrusted(info.ClientIP) {
+						break
+					}
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), forwardedKey, info)))
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/AlexGuo43/clans/api-gateway/config"
+	"github.com/AlexGuo43/clans/api-gateway/internal/idempotency"
+	"github.com/AlexGuo43/clans/api-gateway/internal/metrics"
+	"github.com/AlexGuo43/clans/api-gateway/internal/versioning"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader marks responses replayed from the store.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength   = 255
+	maxIdempotentResponseSize = 1 << 20
+)
+
+// IdempotencyMiddleware runs writes sent with an Idempotency-Key header at
+// most once per caller and key. The first response is stored and replayed
+// for retries of the same request; reusing the key for a different method,
+// path or body is refused with 409. Server errors, and responses too large
+// to keep, are not stored, so the request can be retried with the same key.
+// It must run after AuthMiddleware, since keys are scoped to the caller.
+func IdempotencyMiddleware(store idempotency.Store, cfg config.IdempotencyConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" || cfg.TTL <= 0 || !isWrite(r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				http.Error(w, "Idempotency-Key is too long", http.StatusBadRequest)
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				} else {
+					http.Error(w, "Failed to read request body", http.StatusBadRequest)
+				}
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			key = ClientKey(r) + "|" + key
+			// The store outlives the request, so a client hanging up must not
+			// leave its key claimed.
+			ctx := context.WithoutCancel(r.Context())
+
+			stored, err := store.Start(ctx, key, fingerprint(r, body), cfg.TTL)
+			switch {
+			case errors.Is(err, idempotency.ErrMismatch):
+				http.Error(w, "Idempotency-Key was already used for a different request", http.StatusConflict)
+				return
+			case errors.Is(err, idempotency.ErrInProgress):
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "A request with this Idempotency-Key is in progress", http.StatusConflict)
+				return
+			case err != nil:
+				// Fail open, like the rate limiter.
+				log.Printf("Idempotency store error: %v", err)
+				next.ServeHTTP(w, r)
+				return
+			case stored != nil:
+				metrics.IdempotentReplays.WithLabelValues(routeID(r)).Inc()
+				replay(w, stored)
+				return
+			}
+
+			recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			finished := false
+			defer func() {
+				if !finished {
+					if err := store.Cancel(ctx, key); err != nil {
+						log.Printf("Idempotency store error: %v", err)
+					}
+				}
+			}()
+
+			next.ServeHTTP(recorder, r)
+
+			if recorder.status >= http.StatusInternalServerError || recorder.overflow {
+				return
+			}
+			if recorder.header == nil {
+				recorder.header = w.Header().Clone()
+			}
+			response := &idempotency.Response{Status: recorder.status, Header: recorder.header, Body: recorder.body.Bytes()}
+			if err := store.Finish(ctx, key, response, cfg.TTL); err != nil {
+				log.Printf("Idempotency store error: %v", err)
+				return
+			}
+			finished = true
+		})
+	}
+}
+
+func isWrite(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// fingerprint identifies the request a key is used for. The API version is
+// part of it because it changes the shape of the response.
+func fingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	for _, part := range []string{r.Method, r.URL.Path, r.URL.RawQuery, versioning.Name(r.Context())} {
+		io.WriteString(hash, part)
+		hash.Write([]byte{0})
+	}
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// replay writes a stored response. Headers this request already has, such
+// as its own X-Request-ID, are kept.
+func replay(w http.ResponseWriter, response *idempotency.Response) {
+	header := w.Header()
+	for name, values := range response.Header {
+		if _, ok := header[name]; !ok {
+			header[name] = values
+		}
+	}
+	header.Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(response.Status)
+	w.Write(response.Body)
+}
+
+// responseRecorder passes a response through while keeping a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status   int
+	header   http.Header
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (rr *responseRecorder) WriteHeader(code int) {
+	if rr.header == nil {
+		rr.status = code
+		rr.header = rr.ResponseWriter.Header().Clone()
+	}
+	rr.ResponseWriter.WriteHeader(code)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.header == nil {
+		rr.WriteHeader(http.StatusOK)
+	}
+	if rr.body.Len()+len(b) > maxIdempotentResponseSize {
+		rr.overflow = true
+		rr.body.Reset()
+	}
+	if !rr.overflow {
+		rr.body.Write(b)
+	}
+	return rr.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
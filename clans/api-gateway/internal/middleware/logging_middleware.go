@@ -1,9 +1,16 @@
 package middleware
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"net/http"
+	"os"
+	"strconv"
 	"time"
+
+	"github.com/AlexGuo43/clans/api-gateway/internal/routing"
+	"github.com/AlexGuo43/clans/api-gateway/internal/versioning"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type responseWriter struct {
@@ -16,6 +23,36 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap lets http.ResponseController reach the underlying writer so that
+// streamed responses can still be flushed.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// NewLogger returns a JSON logger at the given level ("debug", "info", "warn"
+// or "error"; anything else means info).
+func NewLogger(level string) *slog.Logger {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		lvl = slog.LevelInfo
+	}
+	return slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: lvl}))
+}
+
+// requestLog collects fields that are only known further down the chain,
+// such as the authenticated user.
+type requestLog struct {
+	userID int
+}
+
+const requestLogKey contextKey = "requestLog"
+
+func setLogUserID(ctx context.Context, userID int) {
+	if entry, ok := ctx.Value(requestLogKey).(*requestLog); ok {
+		entry.userID = userID
+	}
+}
+
 func LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -24,16 +61,49 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 			ResponseWriter: w,
 			statusCode:     http.StatusOK,
 		}
+		entry := &requestLog{}
 
-		next.ServeHTTP(wrapped, r)
+		next.ServeHTTP(wrapped, r.WithContext(context.WithValue(r.Context(), requestLogKey, entry)))
 
-		duration := time.Since(start)
-		log.Printf("[%s] %s %s - %d (%v)",
-			r.Method,
-			r.RequestURI,
-			r.RemoteAddr,
-			wrapped.statusCode,
-			duration,
-		)
+		attrs := []slog.Attr{
+			slog.String("request_id", RequestIDFromContext(r.Context())),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", wrapped.statusCode),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("client_ip", clientIP(r)),
+		}
+		if match := routing.FromContext(r.Context()); match != nil {
+			attrs = append(attrs, slog.String("route", match.Route.ID))
+		}
+		if version := versioning.Name(r.Context()); version != "" {
+			attrs = append(attrs, slog.String("api_version", version))
+		}
+		if spanContext := trace.SpanContextFromContext(r.Context()); spanContext.IsValid() {
+			attrs = append(attrs, slog.String("trace_id", spanContext.TraceID().String()))
+		}
+		if entry.userID != 0 {
+			attrs = append(attrs, slog.String("user_id", strconv.Itoa(entry.userID)))
+		}
+
+		slog.LogAttrs(r.Context(), levelForStatus(wrapped.statusCode), "request completed", attrs...)
 	})
-}
\ No newline at end of file
+}
+
+func levelForStatus(status int) slog.Level {
+	switch {
+	case status >= 500:
+		return slog.LevelError
+	case status >= 400:
+		return slog.LevelWarn
+	default:
+		return slog.LevelInfo
+	}
+}
+
+func clientIP(r *http.Request) string {
+	if info, ok := ForwardedFromContext(r.Context()); ok {
+		return info.ClientIP
+	}
+	return r.RemoteAddr
+}
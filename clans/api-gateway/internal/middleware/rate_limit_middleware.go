@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/AlexGuo43/clans/api-gateway/config"
+	"github.com/AlexGuo43/clans/api-gateway/internal/metrics"
+	"github.com/AlexGuo43/clans/api-gateway/internal/ratelimit"
+	"github.com/AlexGuo43/clans/api-gateway/internal/routing"
+)
+
+// RateLimitMiddleware throttles clients with a token bucket per client and
+// route. Clients are identified by user ID when authenticated and by IP
+// otherwise. Routes without their own limit share the default bucket.
+func RateLimitMiddleware(store ratelimit.Store, defaultLimit *config.RateLimitConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limitConfig := defaultLimit
+			scope := "default"
+			if match := routing.FromContext(r.Context()); match != nil && match.Route.RateLimit != nil {
+				limitConfig = match.Route.RateLimit
+				scope = match.Route.ID
+			}
+
+			if limitConfig == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			limit := ratelimit.PerMinute(limitConfig.RequestsPerMinute, limitConfig.Burst)
+			key := fmt.Sprintf("%s|%s", scope, ClientKey(r))
+
+			result, err := store.Take(r.Context(), key, limit)
+			if err != nil {
+				// Fail open: a broken limiter backend should not take the API down.
+				log.Printf("Rate limiter error: %v", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter.Seconds())))
+
+			if !result.Allowed {
+				metrics.RateLimited.WithLabelValues(routeID(r)).Inc()
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter.Seconds())))
+				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientKey identifies the caller: "user:<id>" when authenticated and
+// "ip:<addr>" otherwise.
+func ClientKey(r *http.Request) string {
+	if userID, ok := UserIDFromContext(r.Context()); ok {
+		return fmt.Sprintf("user:%d", userID)
+	}
+
+	if info, ok := ForwardedFromContext(r.Context()); ok {
+		return "ip:" + info.ClientIP
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+func ceilSeconds(seconds float64) int {
+	return int(math.Ceil(seconds))
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/AlexGuo43/clans/api-gateway/internal/routing"
+	"github.com/AlexGuo43/clans/api-gateway/internal/versioning"
+)
+
+// RouteMiddleware resolves the request against the route table once so that
+// auth and proxying always agree on which route is being served.
+func RouteMiddleware(table *routing.Table) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			match := table.MatchVersion(r.Method, r.URL.Path, versioning.Name(r.Context()))
+			next.ServeHTTP(w, r.WithContext(routing.WithMatch(r.Context(), match)))
+		})
+	}
+}
+
+// routeID labels the request by its route for logs and metrics.
+func routeID(r *http.Request) string {
+	if match := routing.FromContext(r.Context()); match != nil {
+		return match.Route.ID
+	}
+	return "unmatched"
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/AlexGuo43/clans/api-gateway/internal/routing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracingMiddleware starts the server span for a gateway request, continuing
+// the caller's trace when a traceparent header is present. It must run after
+// RouteMiddleware so the span can be named after the route; the proxy
+// propagates the trace to upstream services.
+func TracingMiddleware(next http.Handler) http.Handler {
+	tracer := otel.Tracer("github.com/AlexGuo43/clans/api-gateway/internal/middleware")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		name := r.Method
+		attrs := []attribute.KeyValue{
+			attribute.String("http.request.method", r.Method),
+			attribute.String("url.path", r.URL.Path),
+			attribute.String("request.id", RequestIDFromContext(r.Context())),
+		}
+		if match := routing.FromContext(r.Context()); match != nil {
+			name += " " + match.Route.Path
+			attrs = append(attrs,
+				attribute.String("http.route", match.Route.Path),
+				attribute.String("gateway.service", match.Route.Service),
+			)
+		}
+
+		ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+		defer span.End()
+
+		wrapped := &responseWriter{
+			ResponseWriter: w,
+			statusCode:     http.StatusOK,
+		}
+
+		next.ServeHTTP(wrapped, r.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.response.status_code", wrapped.statusCode))
+		if wrapped.statusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(wrapped.statusCode))
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/AlexGuo43/clans/api-gateway/config"
+	"github.com/AlexGuo43/clans/api-gateway/internal/metrics"
+	"github.com/AlexGuo43/clans/api-gateway/internal/openapi"
+	"github.com/AlexGuo43/clans/api-gateway/internal/routing"
+)
+
+// ValidationError is the body of a 400 for a request that does not match
+// the OpenAPI spec.
+type ValidationError struct {
+	Error   string               `json:"error"`
+	Message string               `json:"message"`
+	Errors  []openapi.FieldError `json:"errors"`
+}
+
+// ValidationMiddleware rejects requests that do not match the OpenAPI spec
+// before they reach a service. It runs last so that unauthenticated and
+// throttled requests are turned away first. The body limit of the route
+// applies while the body is read for validation.
+func ValidationMiddleware(spec *openapi.Spec, cfg *config.Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			match := routing.FromContext(r.Context())
+			if match == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if limit := cfg.BodyLimit(&match.Route.RouteConfig); limit > 0 {
+				if r.ContentLength > int64(limit) {
+					http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+					return
+				}
+				r.Body = http.MaxBytesReader(w, r.Body, int64(limit))
+			}
+
+			fields, err := spec.Validate(r)
+			if err != nil {
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			if len(fields) > 0 {
+				metrics.InvalidRequests.WithLabelValues(routeID(r)).Inc()
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(ValidationError{
+					Error:   "invalid_request",
+					Message: "The request does not match the API specification",
+					Errors:  fields,
+				})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/AlexGuo43/clans/api-gateway/internal/metrics"
+	"github.com/AlexGuo43/clans/api-gateway/internal/versioning"
+)
+
+// VersionMiddleware resolves the API version of the request and strips the
+// version from the path, so /api/v2/posts is routed like /api/posts. It must
+// run before RouteMiddleware. Responses name the version they were served
+// as, and deprecated versions get Deprecation (RFC 9745), Sunset (RFC 8594)
+// and Link headers.
+func VersionMiddleware(resolver *versioning.Resolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			version, path, err := resolver.Resolve(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if version == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			metrics.APIVersionRequests.WithLabelValues(version.Name).Inc()
+
+			header := w.Header()
+			header.Set("API-Version", version.Name)
+			header.Add("Vary", versioning.AcceptVersionHeader)
+			if version.Deprecated != nil {
+				header.Set("Deprecation", fmt.Sprintf("@%d", version.Deprecated.Unix()))
+			}
+			if version.Sunset != nil {
+				header.Set("Sunset", version.Sunset.UTC().Format(http.TimeFormat))
+			}
+			if version.Link != "" {
+				header.Add("Link", fmt.Sprintf(`<%s>; rel="deprecation"; type="text/html"`, version.Link))
+			}
+
+			r = r.WithContext(versioning.WithVersion(r.Context(), version))
+			if path != r.URL.Path {
+				url := *r.URL
+				url.Path = path
+				url.RawPath = ""
+				r.URL = &url
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package openapi
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+//go:embed openapi.yaml
+var document []byte
+
+// Spec is the OpenAPI description of every route the gateway serves, from
+// the services behind it and from the gateway itself.
+type Spec struct {
+	doc    *openapi3.T
+	router routers.Router
+	json   []byte
+}
+
+// FieldError is one way in which a request does not match the spec.
+// Location is "path", "query", "header" or "body"; Field is the parameter
+// name or the dotted path of a body field.
+type FieldError struct {
+	Location string `json:"location"`
+	Field    string `json:"field,omitempty"`
+	Message  string `json:"message"`
+}
+
+var options = &openapi3filter.Options{
+	// AuthMiddleware has already checked the token by the time requests
+	// are validated.
+	AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+	// Services apply their own defaults; requests are forwarded as sent.
+	SkipSettingDefaults: true,
+	MultiError:          true,
+}
+
+// Load parses and checks the embedded spec.
+func Load() (*Spec, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(document)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI spec: %w", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI spec: %w", err)
+	}
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI spec: %w", err)
+	}
+	json, err := doc.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode OpenAPI spec: %w", err)
+	}
+	return &Spec{doc: doc, router: router, json: json}, nil
+}
+
+// Operations lists the operations in the spec as "METHOD /path".
+func (s *Spec) Operations() []string {
+	var operations []string
+	for _, path := range s.doc.Paths.InMatchingOrder() {
+		for method := range s.doc.Paths.Value(path).Operations() {
+			operations = append(operations, method+" "+path)
+		}
+	}
+	slices.Sort(operations)
+	return operations
+}
+
+// Validate checks r against the operation the spec describes for it. It
+// returns nothing for requests the spec does not describe; those are left
+// to the route table. The body is read and replaced so it can still be
+// forwarded. The only error is an *http.MaxBytesError, for bodies over the
+// limit set on r.Body.
+func (s *Spec) Validate(r *http.Request) ([]FieldError, error) {
+	route, params, err := s.router.FindRoute(r)
+	if err != nil {
+		return nil, nil
+	}
+
+	// Services decode bodies as JSON whatever their type, so clients have
+	// never had to send one.
+	if r.ContentLength != 0 && r.Header.Get("Content-Type") == "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+
+	err = openapi3filter.ValidateRequest(r.Context(), &openapi3filter.RequestValidationInput{
+		Request:    r,
+		PathParams: params,
+		Route:      route,
+		Options:    options,
+	})
+	if err == nil {
+		return nil, nil
+	}
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return nil, maxBytesErr
+	}
+	return fieldErrors(err), nil
+}
+
+// fieldErrors flattens the errors from openapi3filter into one FieldError
+// per problem.
+func fieldErrors(err error) []FieldError {
+	var fields []FieldError
+	var walk func(err error, location, field string)
+	walk = func(err error, location, field string) {
+		switch err := err.(type) {
+		case openapi3.MultiError:
+			for _, err := range err {
+				walk(err, location, field)
+			}
+		case *openapi3filter.RequestError:
+			switch {
+			case err.Parameter != nil:
+				location, field = err.Parameter.In, err.Parameter.Name
+			case err.RequestBody != nil:
+				location = "body"
+			}
+			switch err.Err.(type) {
+			case openapi3.MultiError, *openapi3.SchemaError:
+				walk(err.Err, location, field)
+				return
+			}
+			message := err.Reason
+			if err.Err != nil {
+				if message == "" || message == err.Err.Error() {
+					message = err.Err.Error()
+				} else {
+					message += ": " + err.Err.Error()
+				}
+			}
+			fields = append(fields, FieldError{Location: location, Field: field, Message: message})
+		case *openapi3.SchemaError:
+			path := err.JSONPointer()
+			if field != "" {
+				path = append([]string{field}, path...)
+			}
+			message := err.Reason
+			switch {
+			case message != "":
+			case err.Origin != nil:
+				message = err.Origin.Error()
+			default:
+				message = fmt.Sprintf("does not match %q", err.SchemaField)
+			}
+			fields = append(fields, FieldError{Location: location, Field: strings.Join(path, "."), Message: message})
+		default:
+			fields = append(fields, FieldError{Location: location, Field: field, Message: err.Error()})
+		}
+	}
+	walk(err, "", "")
+	return fields
+}
+
+// ServeYAML serves the spec as written.
+func (s *Spec) ServeYAML(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(document)
+}
+
+// ServeJSON serves the spec as JSON.
+func (s *Spec) ServeJSON(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(s.json)
+}
+
+// docsPage renders /openapi.json with Swagger UI.
+const docsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Clans API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});
+  </script>
+</body>
+</html>
+`
+
+// ServeDocs serves a page for browsing and trying out the API.
+func ServeDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(docsPage))
+}
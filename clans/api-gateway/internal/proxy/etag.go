@@ -0,0 +1,41 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Services tag responses by the data in them, which is the same whichever
+// API version it is shaped for. Transformed responses have the version
+// added to their tag so that each version's representation has its own, and
+// it is taken off If-None-Match again on the way to the service.
+
+// versionETag turns the tag "abc" into "abc-v2".
+func versionETag(header http.Header, version string) {
+	if tag := header.Get("ETag"); len(tag) >= 2 && strings.HasSuffix(tag, `"`) {
+		header.Set("ETag", strings.TrimSuffix(tag, `"`)+"-"+version+`"`)
+	}
+}
+
+// unversionETags takes the version off the tags in If-None-Match. Tags
+// without it are for another version's representation and are dropped, so
+// they cannot match.
+func unversionETags(header http.Header, version string) {
+	value := header.Get("If-None-Match")
+	if value == "" || strings.TrimSpace(value) == "*" {
+		return
+	}
+
+	suffix := "-" + version + `"`
+	var tags []string
+	for _, tag := range strings.Split(value, ",") {
+		if tag, ok := strings.CutSuffix(strings.TrimSpace(tag), suffix); ok {
+			tags = append(tags, tag+`"`)
+		}
+	}
+	if len(tags) == 0 {
+		header.Del("If-None-Match")
+		return
+	}
+	header.Set("If-None-Match", strings.Join(tags, ", "))
+}
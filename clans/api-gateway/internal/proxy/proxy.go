@@ -1,157 +1,367 @@
 package proxy
 
 import (
-	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"log/slog"
 	"net/http"
-	"net/url"
-	"strings"
+	"net/http/httputil"
+	"slices"
 	"time"
 
 	"github.com/AlexGuo43/clans/api-gateway/config"
+	"github.com/AlexGuo43/clans/api-gateway/internal/balancer"
+	"github.com/AlexGuo43/clans/api-gateway/internal/breaker"
+	"github.com/AlexGuo43/clans/api-gateway/internal/identity"
+	"github.com/AlexGuo43/clans/api-gateway/internal/metrics"
+	"github.com/AlexGuo43/clans/api-gateway/internal/middleware"
+	"github.com/AlexGuo43/clans/api-gateway/internal/routing"
+	"github.com/AlexGuo43/clans/api-gateway/internal/versioning"
 )
 
 type Gateway struct {
-	config *config.Config
-	client *http.Client
+	config     *config.Config
+	client     *http.Client
+	transport  http.RoundTripper
+	proxy      *httputil.ReverseProxy
+	pools      map[string]*balancer.Pool
+	breakers   map[string]*breaker.Breaker
+	signer     *identity.Signer
+	views      map[string]http.Handler
+	transforms map[string]versioning.Transformer
+	streams    *streamLimiter
 }
 
-func NewGateway(cfg *config.Config) *Gateway {
-	return &Gateway{
+func NewGateway(cfg *config.Config) (*Gateway, error) {
+	pools := make(map[string]*balancer.Pool)
+	breakers := make(map[string]*breaker.Breaker)
+	for _, service := range cfg.Services {
+		pool, err := balancer.NewPool(service.Name, service.URLs, service.LoadBalancer)
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %w", service.Name, err)
+		}
+		pools[service.Name] = pool
+
+		breakers[service.Name] = breaker.New(breaker.Settings{
+			FailureThreshold: service.CircuitBreaker.FailureThreshold,
+			OpenTimeout:      service.CircuitBreaker.OpenTimeout,
+			HalfOpenRequests: service.CircuitBreaker.HalfOpenRequests,
+		})
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	g := &Gateway{
 		config: cfg,
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		// Timeouts are applied per route through the request context.
+		client:     &http.Client{Transport: transport},
+		transport:  transport,
+		pools:      pools,
+		breakers:   breakers,
+		signer:     identity.NewSigner(cfg.InternalAuthSecret),
+		views:      make(map[string]http.Handler),
+		transforms: make(map[string]versioning.Transformer),
+		streams:    newStreamLimiter(cfg.Streaming.MaxConnectionsPerClient),
 	}
-}
 
-func (g *Gateway) RouteRequest(w http.ResponseWriter, r *http.Request) {
-	service := g.getServiceForPath(r.URL.Path)
-	if service == nil {
-		http.Error(w, "Service not found", http.StatusNotFound)
-		return
+	// ReverseProxy streams bodies in both directions, strips hop-by-hop
+	// headers and flushes streaming responses as they arrive. Backend
+	// selection, retries and circuit breaking happen in roundTrip.
+	g.proxy = &httputil.ReverseProxy{
+		Rewrite:        g.rewrite,
+		Transport:      roundTripperFunc(g.roundTrip),
+		ModifyResponse: g.transformResponse,
+		ErrorHandler:   g.handleError,
 	}
 
-	targetURL := g.buildTargetURL(service, r)
-	g.forwardRequest(w, r, targetURL)
+	return g, nil
 }
 
-func (g *Gateway) getServiceForPath(path string) *config.ServiceConfig {
-	switch {
-	case strings.HasPrefix(path, "/api/auth/"):
-		return &g.config.UserService
-	case strings.HasPrefix(path, "/api/users/clans"):
-		return &g.config.ClanService
-	case strings.HasPrefix(path, "/api/users/"):
-		return &g.config.UserService
-	case strings.HasPrefix(path, "/api/posts"):
-		return &g.config.PostService
-	case strings.HasPrefix(path, "/api/comments"):
-		return &g.config.CommentService
-	case strings.HasPrefix(path, "/api/clans"):
-		return &g.config.ClanService
-	default:
-		return nil
+// Inherit carries state over from the gateway this one replaces on a config
+// reload. Services whose backends did not change keep their pool, so backend
+// health survives, and their breaker if its settings did not change either.
+// Open streams stay counted against the new per-client limit.
+func (g *Gateway) Inherit(prev *Gateway) {
+	for _, service := range g.config.Services {
+		old := prev.config.Service(service.Name)
+		if old == nil || !slices.Equal(old.URLs, service.URLs) || old.LoadBalancer != service.LoadBalancer {
+			continue
+		}
+		g.pools[service.Name] = prev.pools[service.Name]
+		if *old.CircuitBreaker == *service.CircuitBreaker {
+			g.breakers[service.Name] = prev.breakers[service.Name]
+		}
 	}
+
+	prev.streams.setMax(g.config.Streaming.MaxConnectionsPerClient)
+	g.streams = prev.streams
 }
 
-func (g *Gateway) buildTargetURL(service *config.ServiceConfig, r *http.Request) string {
-	targetPath := r.URL.Path
-	
-	switch service.Name {
-	case "user-service":
-		if strings.HasPrefix(targetPath, "/api/auth/") {
-			targetPath = strings.TrimPrefix(targetPath, "/api/auth")
-		} else if strings.HasPrefix(targetPath, "/api/users/") {
-			targetPath = strings.TrimPrefix(targetPath, "/api/users")
-		}
-	case "post-service":
-		// Keep the full path for post-service as it expects /api/posts
-		// targetPath = strings.TrimPrefix(targetPath, "/api")
-	case "comment-service":
-		// Keep the full path for comment-service as it expects /api/comments
-		// targetPath = strings.TrimPrefix(targetPath, "/api")
-	case "clan-service":
-		// Keep the full path for clan-service as it expects /api/clans
-		// targetPath = strings.TrimPrefix(targetPath, "/api")
+// Close releases the idle upstream connections of a replaced gateway.
+// Requests still in flight are not affected.
+func (g *Gateway) Close() {
+	g.client.CloseIdleConnections()
+}
+
+// StartHealthChecks probes every backend of every service in the background
+// until ctx is cancelled.
+func (g *Gateway) StartHealthChecks(ctx context.Context) {
+	settings := balancer.HealthCheckSettings{
+		Path:               g.config.HealthCheck.Path,
+		Interval:           g.config.HealthCheck.Interval,
+		Timeout:            g.config.HealthCheck.Timeout,
+		UnhealthyThreshold: g.config.HealthCheck.UnhealthyThreshold,
+		HealthyThreshold:   g.config.HealthCheck.HealthyThreshold,
+	}
+	for _, pool := range g.pools {
+		pool.RunHealthChecks(ctx, g.client, settings)
 	}
+}
+
+// HandleView registers the handler for routes whose view is name.
+func (g *Gateway) HandleView(name string, handler http.Handler) {
+	g.views[name] = handler
+}
 
-	targetURL := fmt.Sprintf("%s%s", service.URL, targetPath)
-	if r.URL.RawQuery != "" {
-		targetURL += "?" + r.URL.RawQuery
+// CheckRoutes reports routes that name a view or transformer that has not
+// been registered.
+func (g *Gateway) CheckRoutes() error {
+	for _, route := range g.config.Routes {
+		if route.View != "" && g.views[route.View] == nil {
+			return fmt.Errorf("route %s references unknown view %q", route.Path, route.View)
+		}
+		for _, name := range route.Transforms {
+			if g.transforms[name] == nil {
+				return fmt.Errorf("route %s references unknown transformer %q", route.Path, name)
+			}
+		}
 	}
-	
-	return targetURL
+	return nil
 }
 
-func (g *Gateway) forwardRequest(w http.ResponseWriter, r *http.Request, targetURL string) {
-	parsedURL, err := url.Parse(targetURL)
-	if err != nil {
-		http.Error(w, "Invalid target URL", http.StatusInternalServerError)
+func (g *Gateway) RouteRequest(w http.ResponseWriter, r *http.Request) {
+	match := routing.FromContext(r.Context())
+	var handler http.Handler
+	switch {
+	case match == nil:
+	case match.Route.View != "":
+		handler = g.views[match.Route.View]
+	case g.pools[match.Route.Service] != nil:
+		handler = g.proxy
+	}
+	if handler == nil {
+		http.Error(w, "Service not found", http.StatusNotFound)
 		return
 	}
 
-	// Read and copy the body to avoid consumption issues
-	var bodyBytes []byte
-	if r.Body != nil {
-		bodyBytes, err = io.ReadAll(r.Body)
-		if err != nil {
-			http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+	if limit := g.config.BodyLimit(&match.Route.RouteConfig); limit > 0 {
+		if r.ContentLength > int64(limit) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
 			return
 		}
+		r.Body = http.MaxBytesReader(w, r.Body, int64(limit))
 	}
 
-	proxyReq, err := http.NewRequest(r.Method, parsedURL.String(), bytes.NewReader(bodyBytes))
-	if err != nil {
-		http.Error(w, "Failed to create proxy request", http.StatusInternalServerError)
-		return
+	if kind := middleware.StreamKind(r); kind != "" && match.Route.View == "" {
+		key := middleware.ClientKey(r)
+		if !g.streams.acquire(key) {
+			http.Error(w, "Too many open streams", http.StatusTooManyRequests)
+			return
+		}
+		defer g.streams.release(key)
+
+		gauge := metrics.OpenStreams.WithLabelValues(match.Route.Service, kind)
+		gauge.Inc()
+		defer gauge.Dec()
 	}
 
-	for key, values := range r.Header {
-		for _, value := range values {
-			proxyReq.Header.Add(key, value)
-		}
+	handler.ServeHTTP(w, r)
+}
+
+// rewrite maps the inbound request onto the route's upstream path. The
+// backend host is filled in per attempt by roundTrip.
+func (g *Gateway) rewrite(pr *httputil.ProxyRequest) {
+	match := routing.FromContext(pr.In.Context())
+	pr.Out.URL.Path = match.Route.TargetPath(pr.In.URL.Path)
+	pr.Out.URL.RawPath = ""
+	pr.Out.Host = ""
+	// Responses are compressed for the client by CompressionMiddleware and
+	// must reach transformers uncompressed; the transport negotiates and
+	// undoes compression with the service on its own.
+	pr.Out.Header.Del("Accept-Encoding")
+	if _, version, ok := transformer(pr.In); ok {
+		unversionETags(pr.Out.Header, version)
+	}
+	if query := pr.Out.URL.Query(); query.Has(middleware.AccessTokenParam) {
+		// The token has been checked; services get the signed identity.
+		query.Del(middleware.AccessTokenParam)
+		pr.Out.URL.RawQuery = query.Encode()
 	}
 
-	proxyReq.Header.Set("X-Forwarded-For", r.RemoteAddr)
-	proxyReq.Header.Set("X-Forwarded-Proto", "http")
+	// X-Forwarded-* from the client are only kept when they were set by a
+	// trusted proxy in front of us; SetXForwarded then appends our peer.
+	info, _ := middleware.ForwardedFromContext(pr.In.Context())
+	if info.TrustedPeer {
+		pr.Out.Header["X-Forwarded-For"] = pr.In.Header["X-Forwarded-For"]
+	}
+	pr.SetXForwarded()
+	if info.TrustedPeer {
+		if proto := pr.In.Header.Get("X-Forwarded-Proto"); proto != "" {
+			pr.Out.Header.Set("X-Forwarded-Proto", proto)
+		}
+		if host := pr.In.Header.Get("X-Forwarded-Host"); host != "" {
+			pr.Out.Header.Set("X-Forwarded-Host", host)
+		}
+	}
+}
 
-	resp, err := g.client.Do(proxyReq)
-	if err != nil {
-		http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+func (g *Gateway) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, context.Canceled) {
+		// The client went away; there is nobody left to answer.
 		return
 	}
-	defer resp.Body.Close()
 
-	for key, values := range resp.Header {
-		for _, value := range values {
-			w.Header().Add(key, value)
-		}
+	status, message := ErrorStatus(err)
+	if status == http.StatusBadGateway {
+		slog.ErrorContext(r.Context(), "proxy error",
+			"request_id", middleware.RequestIDFromContext(r.Context()),
+			"method", r.Method,
+			"path", r.URL.Path,
+			"error", err,
+		)
 	}
+	http.Error(w, message, status)
+}
 
-	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
+// ErrorStatus maps an error from an upstream call to the status code and
+// message the gateway answers with.
+func ErrorStatus(err error) (int, string) {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge, "Request body too large"
+	case errors.Is(err, breaker.ErrOpen), errors.Is(err, balancer.ErrNoHealthyBackend):
+		return http.StatusServiceUnavailable, "Service unavailable"
+	case errors.Is(err, errResponseTooLarge):
+		return http.StatusBadGateway, "Upstream response too large"
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, "Upstream timeout"
+	default:
+		return http.StatusBadGateway, "Bad gateway"
+	}
 }
 
+const (
+	statusHealthy   = "healthy"
+	statusDegraded  = "degraded"
+	statusUnhealthy = "unhealthy"
+)
+
+type backendHealth struct {
+	URL               string     `json:"url"`
+	Healthy           bool       `json:"healthy"`
+	ActiveConnections int64      `json:"active_connections"`
+	LatencyMS         *float64   `json:"latency_ms,omitempty"`
+	LastChecked       *time.Time `json:"last_checked,omitempty"`
+	Error             string     `json:"error,omitempty"`
+}
+
+type serviceHealth struct {
+	Status         string          `json:"status"`
+	CircuitBreaker string          `json:"circuit_breaker"`
+	LatencyMS      *float64        `json:"latency_ms,omitempty"`
+	Backends       []backendHealth `json:"backends"`
+}
+
+type healthReport struct {
+	Status   string                   `json:"status"`
+	Services map[string]serviceHealth `json:"services"`
+}
+
+// HealthCheck reports the state kept by the background health checks rather
+// than probing the services on every call. A service is degraded while some
+// of its backends are down or its breaker is probing, and unhealthy once no
+// backend is left or its breaker is open. The gateway is degraded while any
+// service is, and unhealthy, with a 503, once every service is unhealthy.
 func (g *Gateway) HealthCheck(w http.ResponseWriter, r *http.Request) {
-	status := make(map[string]string)
-	
+	report := healthReport{Status: statusHealthy, Services: make(map[string]serviceHealth)}
+
+	unhealthy := 0
 	for _, service := range g.config.Services {
-		healthURL := fmt.Sprintf("%s/health", service.URL)
-		resp, err := g.client.Get(healthURL)
-		
-		if err != nil || resp.StatusCode != http.StatusOK {
-			status[service.Name] = "unhealthy"
-		} else {
-			status[service.Name] = "healthy"
+		health := g.serviceHealth(service.Name)
+		switch health.Status {
+		case statusUnhealthy:
+			unhealthy++
+			report.Status = statusDegraded
+		case statusDegraded:
+			report.Status = statusDegraded
 		}
-		
-		if resp != nil {
-			resp.Body.Close()
+		report.Services[service.Name] = health
+	}
+	if unhealthy > 0 && unhealthy == len(g.config.Services) {
+		report.Status = statusUnhealthy
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status == statusUnhealthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+func (g *Gateway) serviceHealth(name string) serviceHealth {
+	state := g.breakers[name].State()
+	health := serviceHealth{CircuitBreaker: state.String()}
+
+	healthy, probed := 0, 0
+	var total time.Duration
+	for _, backend := range g.pools[name].Backends() {
+		entry := backendHealth{
+			URL:               backend.URL,
+			Healthy:           backend.Healthy(),
+			ActiveConnections: backend.ActiveConnections(),
+		}
+		if result := backend.LastProbe(); result != nil {
+			entry.LatencyMS = milliseconds(result.Latency)
+			entry.LastChecked = &result.At
+			if result.Err != nil {
+				entry.Error = result.Err.Error()
+			}
+			total += result.Latency
+			probed++
+		}
+		if entry.Healthy {
+			healthy++
 		}
+		health.Backends = append(health.Backends, entry)
+	}
+	if probed > 0 {
+		health.LatencyMS = milliseconds(total / time.Duration(probed))
 	}
 
+	switch {
+	case healthy == 0 || state == breaker.Open:
+		health.Status = statusUnhealthy
+	case healthy < len(health.Backends) || state == breaker.HalfOpen:
+		health.Status = statusDegraded
+	default:
+		health.Status = statusHealthy
+	}
+	return health
+}
+
+func milliseconds(d time.Duration) *float64 {
+	ms := float64(d.Microseconds()) / 1000
+	return &ms
+}
+
+// Livez reports that the gateway process is up. Unlike HealthCheck it does
+// not depend on the services, so a failing dependency does not get the
+// gateway restarted.
+func Livez(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, `{"services": %v}`, status)
-}
\ No newline at end of file
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(`{"status":"alive"}` + "\n"))
+}
@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var errNotWritable = errors.New("stream is not writable")
+
+// streamLimiter counts the open streams of each client. A max of 0 means no
+// limit.
+type streamLimiter struct {
+	max int
+
+	mu   sync.Mutex
+	open map[string]int
+}
+
+func newStreamLimiter(max int) *streamLimiter {
+	return &streamLimiter{max: max, open: make(map[string]int)}
+}
+
+// acquire reserves a stream for key, reporting false when the client already
+// has the maximum open.
+func (l *streamLimiter) acquire(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.max > 0 && l.open[key] >= l.max {
+		return false
+	}
+	l.open[key]++
+	return true
+}
+
+func (l *streamLimiter) setMax(max int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.max = max
+}
+
+func (l *streamLimiter) release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.open[key]--; l.open[key] <= 0 {
+		delete(l.open, key)
+	}
+}
+
+// streamBody is the body of an SSE response or, after a WebSocket upgrade,
+// the connection to the backend. It is closed once no data has passed in
+// either direction for idle, which ends the proxied stream.
+type streamBody struct {
+	io.ReadCloser
+	idle       time.Duration
+	lastActive atomic.Int64
+	timer      *time.Timer
+	release    func()
+	once       sync.Once
+}
+
+func newStreamBody(body io.ReadCloser, idle time.Duration, release func()) *streamBody {
+	b := &streamBody{ReadCloser: body, idle: idle, release: release}
+	b.touch()
+	if idle > 0 {
+		b.timer = time.AfterFunc(idle, b.checkIdle)
+	}
+	return b
+}
+
+func (b *streamBody) touch() {
+	b.lastActive.Store(time.Now().UnixNano())
+}
+
+// checkIdle runs on the timer. Only it resets the timer, so activity itself
+// costs no more than an atomic store.
+func (b *streamBody) checkIdle() {
+	idleFor := time.Since(time.Unix(0, b.lastActive.Load()))
+	if idleFor >= b.idle {
+		b.Close()
+		return
+	}
+	b.timer.Reset(b.idle - idleFor)
+}
+
+func (b *streamBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.touch()
+	}
+	return n, err
+}
+
+// Write sends client data to the backend of an upgraded connection.
+func (b *streamBody) Write(p []byte) (int, error) {
+	w, ok := b.ReadCloser.(io.Writer)
+	if !ok {
+		return 0, errNotWritable
+	}
+	n, err := w.Write(p)
+	if n > 0 {
+		b.touch()
+	}
+	return n, err
+}
+
+func (b *streamBody) Close() error {
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/AlexGuo43/clans/api-gateway/internal/routing"
+	"github.com/AlexGuo43/clans/api-gateway/internal/versioning"
+)
+
+// HandleTransform registers the transformer that routes name in their
+// per-version transforms.
+func (g *Gateway) HandleTransform(name string, transform versioning.Transformer) {
+	g.transforms[name] = transform
+}
+
+// transformer returns the name of the transformer for the caller's API
+// version on the matched route, if it has one.
+func transformer(r *http.Request) (name, version string, ok bool) {
+	match := routing.FromContext(r.Context())
+	version = versioning.Name(r.Context())
+	if match == nil || version == "" {
+		return "", "", false
+	}
+	name, ok = match.Route.Transforms[version]
+	return name, version, ok
+}
+
+// transformResponse reshapes the response for the caller's API version when
+// the route has a transformer for it. Only successful, uncompressed JSON
+// responses are transformed, which means buffering them; errors pass through
+// as the service sent them. Successful and 304 responses get a tag for the
+// version; see versionETag.
+func (g *Gateway) transformResponse(resp *http.Response) error {
+	name, version, ok := transformer(resp.Request)
+	if !ok {
+		return nil
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		versionETag(resp.Header, version)
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 || resp.Header.Get("Content-Encoding") != "" {
+		return nil
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "application/json" {
+		return nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	body, err = g.transforms[name](body)
+	if err != nil {
+		return fmt.Errorf("transformer %s: %w", name, err)
+	}
+
+	versionETag(resp.Header, version)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
@@ -0,0 +1,334 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AlexGuo43/clans/api-gateway/internal/balancer"
+	"github.com/AlexGuo43/clans/api-gateway/internal/identity"
+	"github.com/AlexGuo43/clans/api-gateway/internal/metrics"
+	"github.com/AlexGuo43/clans/api-gateway/internal/middleware"
+	"github.com/AlexGuo43/clans/api-gateway/internal/routing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var errResponseTooLarge = errors.New("upstream response too large")
+
+var tracer = otel.Tracer("github.com/AlexGuo43/clans/api-gateway/internal/proxy")
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+type upstreamPolicy struct {
+	timeout         time.Duration
+	retries         int
+	backoff         time.Duration
+	maxResponseSize int64
+	// stream is set for WebSocket upgrades and Server-Sent Events, which
+	// are limited by idle time rather than by timeout and size.
+	stream      bool
+	idleTimeout time.Duration
+}
+
+// policyFor applies the route's overrides to the upstream defaults. route is
+// nil for calls that are not tied to a route.
+func (g *Gateway) policyFor(route *routing.Route, req *http.Request) upstreamPolicy {
+	policy := upstreamPolicy{
+		timeout:         g.config.Upstream.Timeout,
+		retries:         g.config.Upstream.Retries,
+		backoff:         g.config.Upstream.RetryBackoff,
+		maxResponseSize: int64(g.config.Upstream.MaxResponseSize),
+	}
+	if route != nil {
+		if route.Timeout > 0 {
+			policy.timeout = route.Timeout
+		}
+		if route.Retries != nil {
+			policy.retries = *route.Retries
+		}
+		if route.MaxResponseSize != nil {
+			policy.maxResponseSize = int64(*route.MaxResponseSize)
+		}
+	}
+	if middleware.StreamKind(req) != "" {
+		policy.stream = true
+		policy.idleTimeout = g.config.Streaming.IdleTimeout
+		policy.maxResponseSize = 0
+	}
+	// A streamed body cannot be replayed, so only bodiless idempotent
+	// requests are retried.
+	if !isIdempotent(req.Method) || (req.Body != nil && req.Body != http.NoBody) {
+		policy.retries = 0
+	}
+	return policy
+}
+
+// roundTrip sends a proxied request to the service of its route.
+func (g *Gateway) roundTrip(req *http.Request) (*http.Response, error) {
+	match := routing.FromContext(req.Context())
+	return g.forward(req, g.pools[match.Route.Service], g.policyFor(match.Route, req))
+}
+
+// Fetch issues a GET for path to service on behalf of the request in ctx.
+// See Call.
+func (g *Gateway) Fetch(ctx context.Context, service, path string) (*http.Response, error) {
+	return g.Call(ctx, service, http.MethodGet, path, nil)
+}
+
+// Call sends a request for path to service on behalf of the request in ctx,
+// for gateway handlers that combine several upstream calls. It goes through
+// the same balancing, circuit breaking, retries and identity signing as
+// proxied requests, using the policy of the route in ctx. A non-nil body is
+// sent as JSON. The caller must close the response body.
+func (g *Gateway) Call(ctx context.Context, service, method, path string, body io.Reader) (*http.Response, error) {
+	pool := g.pools[service]
+	if pool == nil {
+		return nil, fmt.Errorf("unknown service %q", service)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if id := middleware.RequestIDFromContext(ctx); id != "" {
+		req.Header.Set(middleware.RequestIDHeader, id)
+	}
+
+	var route *routing.Route
+	if match := routing.FromContext(ctx); match != nil {
+		route = match.Route
+	}
+	return g.forward(req, pool, g.policyFor(route, req))
+}
+
+// forward sends the outbound request to a backend of pool through the
+// service's circuit breaker, retrying with jittered exponential backoff
+// where the policy allows. Every attempt picks a backend afresh, so retries
+// can land on another instance.
+func (g *Gateway) forward(req *http.Request, pool *balancer.Pool, policy upstreamPolicy) (*http.Response, error) {
+	cb := g.breakers[pool.Name]
+	hashKey := middleware.ClientKey(req)
+
+	assertion, err := g.signIdentity(req, pool.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := cb.Allow(); err != nil {
+			return nil, err
+		}
+
+		backend, err := pool.Pick(hashKey)
+		if err != nil {
+			cb.Release()
+			return nil, err
+		}
+
+		ctx, cancel, headersReceived := attemptContext(req.Context(), policy)
+		ctx, span := tracer.Start(ctx, "upstream "+pool.Name,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("server.address", backend.URL),
+				attribute.Int("http.request.resend_count", attempt),
+			),
+		)
+		releaseBackend := backend.Acquire()
+		release := func() {
+			span.End()
+			cancel()
+			releaseBackend()
+		}
+
+		attemptStart := time.Now()
+		resp, err := g.send(ctx, req, backend, assertion)
+		if !headersReceived() && err != nil && req.Context().Err() == nil {
+			err = fmt.Errorf("no response headers within %s: %w", policy.timeout, context.DeadlineExceeded)
+		}
+		status := "error"
+		if err == nil {
+			status = strconv.Itoa(resp.StatusCode)
+			span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+			if resp.StatusCode >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, resp.Status)
+			}
+		} else {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		metrics.UpstreamRequestDuration.WithLabelValues(pool.Name, status).Observe(time.Since(attemptStart).Seconds())
+
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case err == nil && resp.StatusCode < http.StatusInternalServerError:
+			cb.Success()
+			return wrapResponse(resp, policy, release)
+		case req.Context().Err() != nil, errors.As(err, &maxBytesErr):
+			// A departed client or an oversized request body says nothing
+			// about the health of the upstream.
+			cb.Release()
+		default:
+			cb.Failure()
+		}
+
+		retryable := err != nil || isRetryableStatus(resp.StatusCode)
+		if attempt >= policy.retries || !retryable || req.Context().Err() != nil {
+			if err != nil {
+				release()
+				return nil, err
+			}
+			return wrapResponse(resp, policy, release)
+		}
+
+		if resp != nil {
+			resp.Body.Close()
+		}
+		release()
+
+		metrics.UpstreamRetries.WithLabelValues(pool.Name).Inc()
+		if err := sleepBackoff(req.Context(), policy.backoff, attempt); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// signIdentity asserts the caller's identity to service. Services only trust
+// identity from this assertion, never from plain headers.
+func (g *Gateway) signIdentity(req *http.Request, service string) (string, error) {
+	if identity.IsGateway(req.Context()) {
+		return g.signer.Sign(service, 0, []string{identity.GatewayRole}, "")
+	}
+
+	var roles []string
+	userID, ok := middleware.UserIDFromContext(req.Context())
+	if ok {
+		roles = []string{"user"}
+	}
+	return g.signer.Sign(service, userID, roles, middleware.RequestIDFromContext(req.Context()))
+}
+
+// attemptContext bounds an upstream attempt by the policy's timeout. For
+// streams the timeout only runs until headersReceived is called, which
+// reports whether the headers arrived in time.
+func attemptContext(parent context.Context, policy upstreamPolicy) (context.Context, context.CancelFunc, func() bool) {
+	if !policy.stream {
+		ctx, cancel := context.WithTimeout(parent, policy.timeout)
+		return ctx, cancel, func() bool { return true }
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+	timer := time.AfterFunc(policy.timeout, cancel)
+	return ctx, cancel, timer.Stop
+}
+
+func (g *Gateway) send(ctx context.Context, req *http.Request, backend *balancer.Backend, assertion string) (*http.Response, error) {
+	target, err := url.Parse(backend.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	out := req.Clone(ctx)
+	out.URL.Scheme = target.Scheme
+	out.URL.Host = target.Host
+	out.URL.Path = strings.TrimSuffix(target.Path, "/") + req.URL.Path
+	out.Header.Set(identity.Header, assertion)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(out.Header))
+
+	return g.transport.RoundTrip(out)
+}
+
+// wrapResponse ties the attempt's resources to the response body so they
+// are released once the proxy has finished streaming it, and enforces the
+// response size limit or, for streams, the idle timeout.
+func wrapResponse(resp *http.Response, policy upstreamPolicy, release func()) (*http.Response, error) {
+	if policy.stream {
+		resp.Body = newStreamBody(resp.Body, policy.idleTimeout, release)
+		return resp, nil
+	}
+
+	maxSize := policy.maxResponseSize
+	if maxSize > 0 && resp.ContentLength > maxSize {
+		resp.Body.Close()
+		release()
+		return nil, errResponseTooLarge
+	}
+
+	resp.Body = &upstreamBody{ReadCloser: resp.Body, limit: maxSize, release: release}
+	return resp, nil
+}
+
+type upstreamBody struct {
+	io.ReadCloser
+	limit   int64
+	read    int64
+	release func()
+	once    sync.Once
+}
+
+func (b *upstreamBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if b.limit > 0 && b.read > b.limit {
+		// The status line is already on its way to the client, so the proxy
+		// can only abort the connection.
+		return 0, errResponseTooLarge
+	}
+	return n, err
+}
+
+func (b *upstreamBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// sleepBackoff waits a random duration up to base*2^attempt ("full jitter")
+// so that retrying clients do not hit a recovering upstream in lockstep.
+func sleepBackoff(ctx context.Context, base time.Duration, attempt int) error {
+	maxDelay := base << attempt
+	if maxDelay <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(rand.N(maxDelay))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func isRetryableStatus(code int) bool {
+	return code == http.StatusBadGateway || code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+}
@@ -0,0 +1,112 @@
+package revocation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AlexGuo43/clans/api-gateway/internal/identity"
+)
+
+// Entry is a revoked access token ID (jti) or session ID (sid). Access
+// tokens it covers are refused until ExpiresAt, by which time they have
+// expired anyway.
+type Entry struct {
+	ID        string    `json:"id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// List is the gateway's copy of the user service's revocation list. The nil
+// List revokes nothing.
+type List struct {
+	mu  sync.RWMutex
+	ids map[string]time.Time
+}
+
+func NewList() *List {
+	return &List{ids: make(map[string]time.Time)}
+}
+
+// Revoked reports whether any of ids is on the list. Empty IDs are ignored.
+func (l *List) Revoked(ids ...string) bool {
+	if l == nil {
+		return false
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	now := time.Now()
+	for _, id := range ids {
+		if expiresAt, ok := l.ids[id]; ok && id != "" && now.Before(expiresAt) {
+			return true
+		}
+	}
+	return false
+}
+
+// Replace swaps in a fresh copy of the list.
+func (l *List) Replace(entries []Entry) {
+	ids := make(map[string]time.Time, len(entries))
+	for _, entry := range entries {
+		ids[entry.ID] = entry.ExpiresAt
+	}
+
+	l.mu.Lock()
+	l.ids = ids
+	l.mu.Unlock()
+}
+
+// Upstream is how the list is fetched; *proxy.Gateway implements it.
+type Upstream interface {
+	Fetch(ctx context.Context, service, path string) (*http.Response, error)
+}
+
+// Service and Path locate the revocation list.
+const (
+	Service = "user-service"
+	Path    = "/internal/revocations"
+)
+
+// Sync refreshes the list from upstream now and then every interval until
+// ctx is cancelled. When a fetch fails the previous list is kept, so tokens
+// revoked in the meantime are only refused once the service is back.
+func (l *List) Sync(ctx context.Context, upstream Upstream, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := l.fetch(ctx, upstream); err != nil && ctx.Err() == nil {
+				log.Printf("Failed to sync token revocations: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (l *List) fetch(ctx context.Context, upstream Upstream) error {
+	resp, err := upstream.Fetch(identity.AsGateway(ctx), Service, Path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", Service, resp.StatusCode)
+	}
+	var body struct {
+		Revocations []Entry `json:"revocations"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return err
+	}
+	l.Replace(body.Revocations)
+	return nil
+}
@@ -0,0 +1,168 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/AlexGuo43/clans/api-gateway/config"
+)
+
+type Route struct {
+	config.RouteConfig
+	// ID identifies the route in rate-limit keys and logs, e.g.
+	// "POST /api/posts/{id}/vote".
+	ID       string
+	segments []string
+	wildcard bool
+}
+
+// Match is the result of resolving a request against the route table.
+type Match struct {
+	Route  *Route
+	Params map[string]string
+}
+
+type Table struct {
+	routes []*Route
+}
+
+func NewTable(routes []config.RouteConfig) (*Table, error) {
+	table := &Table{}
+	for _, rc := range routes {
+		route, err := compile(rc)
+		if err != nil {
+			return nil, err
+		}
+		table.routes = append(table.routes, route)
+	}
+	return table, nil
+}
+
+func compile(rc config.RouteConfig) (*Route, error) {
+	route := &Route{RouteConfig: rc}
+	route.Methods = make([]string, len(rc.Methods))
+	for i, method := range rc.Methods {
+		route.Methods[i] = strings.ToUpper(method)
+	}
+
+	route.ID = "* " + rc.Path
+	if len(route.Methods) > 0 {
+		route.ID = strings.Join(route.Methods, ",") + " " + rc.Path
+	}
+	if len(rc.Versions) > 0 {
+		route.ID += " (" + strings.Join(rc.Versions, ",") + ")"
+	}
+
+	segments := splitPath(rc.Path)
+	for i, segment := range segments {
+		if segment == "*" {
+			if i != len(segments)-1 {
+				return nil, fmt.Errorf("route %s: * is only allowed as the last segment", rc.Path)
+			}
+			route.wildcard = true
+			segments = segments[:i]
+			break
+		}
+		if strings.HasPrefix(segment, "{") != strings.HasSuffix(segment, "}") {
+			return nil, fmt.Errorf("route %s: malformed parameter %q", rc.Path, segment)
+		}
+	}
+	route.segments = segments
+
+	return route, nil
+}
+
+// Match returns the first route matching method and path, or nil.
+func (t *Table) Match(method, path string) *Match {
+	return t.MatchVersion(method, path, "")
+}
+
+// MatchVersion is Match for a request of the given API version. Routes
+// limited to other versions are skipped.
+func (t *Table) MatchVersion(method, path, version string) *Match {
+	requestSegments := splitPath(path)
+	for _, route := range t.routes {
+		if !route.allowsMethod(method) || !route.allowsVersion(version) {
+			continue
+		}
+		if params, ok := route.matchPath(requestSegments); ok {
+			return &Match{Route: route, Params: params}
+		}
+	}
+	return nil
+}
+
+func (r *Route) allowsMethod(method string) bool {
+	if len(r.Methods) == 0 {
+		return true
+	}
+	for _, m := range r.Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Route) allowsVersion(version string) bool {
+	return len(r.Versions) == 0 || slices.Contains(r.Versions, version)
+}
+
+func (r *Route) matchPath(requestSegments []string) (map[string]string, bool) {
+	if len(requestSegments) < len(r.segments) {
+		return nil, false
+	}
+	if !r.wildcard && len(requestSegments) != len(r.segments) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, segment := range r.segments {
+		if strings.HasPrefix(segment, "{") {
+			if requestSegments[i] == "" {
+				return nil, false
+			}
+			params[strings.Trim(segment, "{}")] = requestSegments[i]
+			continue
+		}
+		if segment != requestSegments[i] {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+// TargetPath applies the route's prefix strip and rewrite to path.
+func (r *Route) TargetPath(path string) string {
+	if strings.HasPrefix(path, r.StripPrefix) {
+		path = r.RewritePrefix + strings.TrimPrefix(path, r.StripPrefix)
+	}
+	if path == "" {
+		return "/"
+	}
+	return path
+}
+
+func splitPath(path string) []string {
+	trimmed := strings.TrimPrefix(path, "/")
+	if trimmed == "" {
+		return nil
+	}
+	return strings.Split(trimmed, "/")
+}
+
+type contextKey struct{}
+
+func WithMatch(ctx context.Context, match *Match) context.Context {
+	return context.WithValue(ctx, contextKey{}, match)
+}
+
+// FromContext returns the route resolved for the request, or nil when no
+// route matched.
+func FromContext(ctx context.Context) *Match {
+	match, _ := ctx.Value(contextKey{}).(*Match)
+	return match
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/AlexGuo43/clans/api-gateway/config"
+	"github.com/AlexGuo43/clans/api-gateway/internal/metrics"
+	"github.com/AlexGuo43/clans/api-gateway/internal/ratelimit"
+)
+
+// Reloader serves requests with the current Server and replaces it when the
+// configuration changes. Requests already being served finish on the server
+// they started on.
+type Reloader struct {
+	load   func() (*config.Config, error)
+	limits ratelimit.Store
+
+	mu      sync.Mutex // serializes reloads
+	current atomic.Pointer[Server]
+}
+
+// NewReloader loads the initial configuration with load, which is called
+// again on every reload.
+func NewReloader(load func() (*config.Config, error), limits ratelimit.Store) (*Reloader, error) {
+	cfg, err := load()
+	if err != nil {
+		return nil, err
+	}
+	srv, err := New(cfg, limits, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Reloader{load: load, limits: limits}
+	r.current.Store(srv)
+	return r, nil
+}
+
+func (r *Reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.current.Load().ServeHTTP(w, req)
+}
+
+// Internal serves the internal endpoints of the current server.
+func (r *Reloader) Internal() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.current.Load().Internal.ServeHTTP(w, req)
+	})
+}
+
+// Config returns the configuration currently being served.
+func (r *Reloader) Config() *config.Config {
+	return r.current.Load().Config
+}
+
+// Reload loads the configuration again and swaps in a server built from it.
+// If the new configuration is invalid, the error is returned and the current
+// server stays in place.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := r.load()
+	if err != nil {
+		metrics.ConfigReloads.WithLabelValues("failure").Inc()
+		return err
+	}
+	prev := r.current.Load()
+	next, err := New(cfg, r.limits, prev)
+	if err != nil {
+		metrics.ConfigReloads.WithLabelValues("failure").Inc()
+		return err
+	}
+	r.current.Store(next)
+	prev.Close()
+	metrics.ConfigReloads.WithLabelValues("success").Inc()
+
+	// These are only read at startup.
+	if cfg.Port != prev.Config.Port || cfg.InternalPort != prev.Config.InternalPort || cfg.LogLevel != prev.Config.LogLevel ||
+		cfg.TraceExporter != prev.Config.TraceExporter || cfg.TraceFile != prev.Config.TraceFile {
+		log.Println("Warning: port, log level and tracing changes take effect after a restart")
+	}
+	return nil
+}
+
+func (r *Reloader) reloadAndLog(reason string) {
+	if err := r.Reload(); err != nil {
+		log.Printf("Config reload (%s) failed, keeping the previous config: %v", reason, err)
+		return
+	}
+	cfg := r.Config()
+	log.Printf("Config reloaded (%s): %d services, %d routes", reason, len(cfg.Services), len(cfg.Routes))
+}
+
+// WatchSignals reloads on every SIGHUP until ctx is cancelled.
+func (r *Reloader) WatchSignals(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signals:
+				r.reloadAndLog("SIGHUP")
+			}
+		}
+	}()
+}
+
+// WatchFiles checks the files returned by files every interval and reloads
+// when one of them was modified, created or removed. Polling, unlike file
+// system events, also sees files replaced through a symlink swap, as with
+// Kubernetes ConfigMaps.
+func (r *Reloader) WatchFiles(ctx context.Context, interval time.Duration, files func() []string) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		last := stamp(files())
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			current := stamp(files())
+			if current != last {
+				last = current
+				r.reloadAndLog("config file changed")
+			}
+		}
+	}()
+}
+
+// stamp summarizes the size and modification time of every file, so that
+// comparing two stamps tells whether any of them changed.
+func stamp(files []string) string {
+	var s string
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			s += file + ":missing;"
+			continue
+		}
+		s += fmt.Sprintf("%s:%d:%d;", file, info.Size(), info.ModTime().UnixNano())
+	}
+	return s
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/AlexGuo43/clans/api-gateway/config"
+	"github.com/AlexGuo43/clans/api-gateway/internal/cache"
+	"github.com/AlexGuo43/clans/api-gateway/internal/cors"
+	"github.com/AlexGuo43/clans/api-gateway/internal/graph"
+	"github.com/AlexGuo43/clans/api-gateway/internal/idempotency"
+	"github.com/AlexGuo43/clans/api-gateway/internal/jwks"
+	"github.com/AlexGuo43/clans/api-gateway/internal/middleware"
+	"github.com/AlexGuo43/clans/api-gateway/internal/openapi"
+	"github.com/AlexGuo43/clans/api-gateway/internal/proxy"
+	"github.com/AlexGuo43/clans/api-gateway/internal/ratelimit"
+	"github.com/AlexGuo43/clans/api-gateway/internal/revocation"
+	"github.com/AlexGuo43/clans/api-gateway/internal/routing"
+	"github.com/AlexGuo43/clans/api-gateway/internal/services"
+	"github.com/AlexGuo43/clans/api-gateway/internal/versioning"
+	"github.com/AlexGuo43/clans/api-gateway/internal/views"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Server is the gateway's HTTP handler built from one configuration: the
+// route table, CORS policy, auth, rate limits and upstreams.
+type Server struct {
+	http.Handler
+	Config *config.Config
+	// Internal serves the endpoints that must not be reachable from the
+	// public port, such as cache purges.
+	Internal http.Handler
+
+	gateway          *proxy.Gateway
+	idempotency      idempotency.Store
+	cache            cache.Store
+	keys             *jwks.Keys
+	revoked          *revocation.List
+	stopHealthChecks context.CancelFunc
+}
+
+// New builds a server for cfg and starts its health checks. limits is shared
+// between servers so rate-limit budgets survive a reload. prev is the server
+// being replaced, or nil; stored idempotent and cached responses, the token
+// signing keys and the revocation list carry over, and see
+// proxy.Gateway.Inherit for the rest.
+func New(cfg *config.Config, limits ratelimit.Store, prev *Server) (*Server, error) {
+	routes, err := routing.NewTable(cfg.Routes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid route table: %w", err)
+	}
+
+	corsPolicy, err := cors.NewPolicy(cfg.CORS)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CORS policy: %w", err)
+	}
+
+	spec, err := openapi.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	keys, revoked := jwks.NewKeys(), revocation.NewList()
+	if prev != nil {
+		keys, revoked = prev.keys, prev.revoked
+	}
+	authService := services.NewAuthService(keys, revoked)
+	gateway, err := proxy.NewGateway(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gateway: %w", err)
+	}
+	var responses idempotency.Store = idempotency.NewMemoryStore()
+	var cached cache.Store
+	if prev != nil {
+		responses = prev.idempotency
+		cached = prev.cache
+	} else {
+		cached = cache.NewMemoryStore(cfg.Cache.MaxEntries, int64(cfg.Cache.MaxSize))
+	}
+	gateway.HandleView("post-page", views.NewPostPageHandler(gateway))
+	gateway.HandleView("user-profile", views.NewUserProfileHandler(gateway))
+	gateway.HandleView("graphql", graph.NewHandler(gateway, middleware.CachePurger(cached, routes)))
+	gateway.HandleTransform("post-v2", versioning.PostV2)
+	gateway.HandleTransform("comment-v2", versioning.CommentV2)
+	if err := gateway.CheckRoutes(); err != nil {
+		return nil, fmt.Errorf("invalid route table: %w", err)
+	}
+	if prev != nil {
+		gateway.Inherit(prev.gateway)
+	}
+
+	r := mux.NewRouter()
+
+	r.HandleFunc("/health", gateway.HealthCheck).Methods("GET")
+	r.HandleFunc("/livez", proxy.Livez).Methods("GET")
+	r.HandleFunc("/readyz", gateway.HealthCheck).Methods("GET")
+	r.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	r.HandleFunc("/openapi.yaml", spec.ServeYAML).Methods("GET")
+	r.HandleFunc("/openapi.json", spec.ServeJSON).Methods("GET")
+	r.HandleFunc("/docs", openapi.ServeDocs).Methods("GET")
+
+	// Everything served from the route table, including /graphql, goes
+	// through the same middleware.
+	routed := []mux.MiddlewareFunc{
+		middleware.ForwardedMiddleware(cfg.TrustedProxyPrefixes),
+		middleware.RequestIDMiddleware,
+		middleware.VersionMiddleware(versioning.NewResolver(cfg.APIVersions)),
+		middleware.RouteMiddleware(routes),
+		middleware.TracingMiddleware,
+		middleware.LoggingMiddleware,
+		middleware.MetricsMiddleware,
+		middleware.CompressionMiddleware(cfg.Compression),
+		middleware.CorsMiddleware(corsPolicy, routes),
+		middleware.AuthMiddleware(authService),
+		middleware.RateLimitMiddleware(limits, cfg.RateLimit),
+		middleware.ValidationMiddleware(spec, cfg),
+		middleware.CacheMiddleware(cached, cfg.Cache),
+		middleware.IdempotencyMiddleware(responses, cfg.Idempotency),
+	}
+
+	api := r.PathPrefix("/api").Subrouter()
+	api.Use(routed...)
+	api.PathPrefix("/").HandlerFunc(gateway.RouteRequest)
+
+	graphql := r.Path("/graphql").Subrouter()
+	graphql.Use(routed...)
+	graphql.NewRoute().HandlerFunc(gateway.RouteRequest)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	gateway.StartHealthChecks(ctx)
+	if cfg.Auth.JWKSRefreshInterval > 0 && cfg.Service(jwks.Service) != nil {
+		keys.Sync(ctx, gateway, cfg.Auth.JWKSRefreshInterval)
+	}
+	if cfg.Auth.RevocationSyncInterval > 0 && cfg.Service(revocation.Service) != nil {
+		revoked.Sync(ctx, gateway, cfg.Auth.RevocationSyncInterval)
+	}
+
+	internal := mux.NewRouter()
+	internal.HandleFunc("/internal/cache/purge", cache.PurgeHandler(cached, cfg.CachePurgeToken)).Methods("POST")
+
+	return &Server{Handler: r, Config: cfg, Internal: internal, gateway: gateway, idempotency: responses, cache: cached, keys: keys, revoked: revoked, stopHealthChecks: cancel}, nil
+}
+
+// Close stops the health checks of a replaced server. Requests it is still
+// serving run to completion.
+func (s *Server) Close() {
+	s.stopHealthChecks()
+	s.gateway.Close()
+}
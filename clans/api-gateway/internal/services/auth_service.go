@@ -1,33 +1,62 @@
 package services
 
 import (
+	"errors"
+
+	"github.com/AlexGuo43/clans/api-gateway/internal/jwks"
+	"github.com/AlexGuo43/clans/api-gateway/internal/revocation"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// ErrTokenRevoked is returned for access tokens of a session that was
+// logged out or revoked.
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// User is the caller an access token identifies. EmailVerified is only true
+// if the token says so; tokens issued before the address was verified say
+// it is not until they are refreshed.
+type User struct {
+	ID            int
+	EmailVerified bool
+}
+
 type AuthService struct {
-	jwtSecret []byte
+	keys    *jwks.Keys
+	revoked *revocation.List
 }
 
-func NewAuthService(secret string) *AuthService {
+// NewAuthService validates tokens signed with the user service's keys.
+// Tokens whose ID (jti) or session (sid) is on revoked are refused; keys and
+// revoked may be nil.
+func NewAuthService(keys *jwks.Keys, revoked *revocation.List) *AuthService {
 	return &AuthService{
-		jwtSecret: []byte(secret),
+		keys:    keys,
+		revoked: revoked,
 	}
 }
 
-func (a *AuthService) ValidateJWT(tokenString string) (int, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return a.jwtSecret, nil
-	})
+func (a *AuthService) ValidateJWT(tokenString string) (*User, error) {
+	token, err := jwt.Parse(tokenString, a.keys.Keyfunc, jwt.WithValidMethods(jwks.Methods), jwt.WithExpirationRequired())
 
-	if err != nil || !token.Valid {
-		return 0, err
+	if err != nil {
+		return nil, err
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return 0, err
+		return nil, errors.New("invalid token claims")
 	}
 
-	userID := int(claims["user_id"].(float64))
-	return userID, nil
-}
\ No newline at end of file
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return nil, errors.New("token has no user_id")
+	}
+
+	tokenID, _ := claims["jti"].(string)
+	sessionID, _ := claims["sid"].(string)
+	if a.revoked.Revoked(tokenID, sessionID) {
+		return nil, ErrTokenRevoked
+	}
+	emailVerified, _ := claims["email_verified"].(bool)
+	return &User{ID: int(userID), EmailVerified: emailVerified}, nil
+}
@@ -0,0 +1,91 @@
+package versioning
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Transformer rewrites the JSON body of a successful upstream response into
+// the shape a given API version promises.
+type Transformer func(body []byte) ([]byte, error)
+
+// PostV2 nests the author and clan of posts:
+//
+//	{"user_id": 1, "username": "ann", "clan_id": 3, "clan_name": "gophers"}
+//
+// becomes
+//
+//	{"author": {"id": 1, "username": "ann"}, "clan": {"id": 3, "name": "gophers"}}
+//
+// Lists are transformed post by post. Other bodies, such as {"message": ...},
+// pass through.
+func PostV2(body []byte) ([]byte, error) {
+	return transformJSON(body, func(post map[string]interface{}) {
+		if !nestAuthor(post) {
+			return
+		}
+		post["clan"] = nil
+		if id, ok := post["clan_id"]; ok {
+			post["clan"] = map[string]interface{}{"id": id, "name": post["clan_name"]}
+		}
+		delete(post, "clan_id")
+		delete(post, "clan_name")
+	})
+}
+
+// CommentV2 nests the author of comments and of their replies, like PostV2.
+func CommentV2(body []byte) ([]byte, error) {
+	var nest func(comment map[string]interface{})
+	nest = func(comment map[string]interface{}) {
+		nestAuthor(comment)
+		if replies, ok := comment["replies"].([]interface{}); ok {
+			for _, reply := range replies {
+				if reply, ok := reply.(map[string]interface{}); ok {
+					nest(reply)
+				}
+			}
+		}
+	}
+	return transformJSON(body, nest)
+}
+
+// nestAuthor replaces user_id and username with an author object, reporting
+// whether the object had an author.
+func nestAuthor(object map[string]interface{}) bool {
+	id, ok := object["user_id"]
+	if !ok {
+		return false
+	}
+	object["author"] = map[string]interface{}{"id": id, "username": object["username"]}
+	delete(object, "user_id")
+	delete(object, "username")
+	return true
+}
+
+// transformJSON applies fn to the body if it is an object, or to each object
+// if it is a list.
+func transformJSON(body []byte, fn func(map[string]interface{})) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	// Keep IDs and counts exactly as the service sent them.
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		fn(value)
+	case []interface{}:
+		for _, item := range value {
+			if object, ok := item.(map[string]interface{}); ok {
+				fn(object)
+			}
+		}
+	default:
+		return body, nil
+	}
+
+	return json.Marshal(value)
+}
@@ -0,0 +1,92 @@
+package versioning
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/AlexGuo43/clans/api-gateway/config"
+)
+
+// AcceptVersionHeader selects the version of unversioned /api/ paths.
+const AcceptVersionHeader = "Accept-Version"
+
+// Resolver works out which API version a request is for.
+type Resolver struct {
+	config config.APIVersionsConfig
+}
+
+func NewResolver(cfg config.APIVersionsConfig) *Resolver {
+	return &Resolver{config: cfg}
+}
+
+// Resolve returns the version requested and the request path without the
+// version prefix, so /api/v2/posts resolves to v2 and /api/posts. A version
+// in the path wins over Accept-Version; with neither, the default applies.
+// Resolve returns a nil version when no versions are configured.
+func (r *Resolver) Resolve(req *http.Request) (*config.VersionConfig, string, error) {
+	path := req.URL.Path
+	if len(r.config.Versions) == 0 {
+		return nil, path, nil
+	}
+
+	if rest, ok := strings.CutPrefix(path, "/api/"); ok {
+		segment, remainder, _ := strings.Cut(rest, "/")
+		if isVersion(segment) {
+			version := r.config.Version(segment)
+			if version == nil {
+				return nil, path, fmt.Errorf("unsupported API version %q", segment)
+			}
+			return version, "/api/" + remainder, nil
+		}
+	}
+
+	if name := strings.TrimSpace(req.Header.Get(AcceptVersionHeader)); name != "" {
+		if !strings.HasPrefix(name, "v") {
+			name = "v" + name
+		}
+		version := r.config.Version(name)
+		if version == nil {
+			return nil, path, fmt.Errorf("unsupported API version %q", name)
+		}
+		return version, path, nil
+	}
+
+	return r.config.Version(r.config.Default), path, nil
+}
+
+// isVersion reports whether a path segment is shaped like a version, such as
+// "v2", whether or not that version exists.
+func isVersion(segment string) bool {
+	if len(segment) < 2 || segment[0] != 'v' {
+		return false
+	}
+	for _, c := range segment[1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+type contextKey struct{}
+
+func WithVersion(ctx context.Context, version *config.VersionConfig) context.Context {
+	return context.WithValue(ctx, contextKey{}, version)
+}
+
+// FromContext returns the API version of the request, or nil when versions
+// are not configured.
+func FromContext(ctx context.Context) *config.VersionConfig {
+	version, _ := ctx.Value(contextKey{}).(*config.VersionConfig)
+	return version
+}
+
+// Name returns the API version of the request, or "".
+func Name(ctx context.Context) string {
+	if version := FromContext(ctx); version != nil {
+		return version.Name
+	}
+	return ""
+}
@@ -0,0 +1,106 @@
+package views
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/AlexGuo43/clans/api-gateway/internal/middleware"
+	"github.com/AlexGuo43/clans/api-gateway/internal/routing"
+)
+
+// PostPage is everything the frontend needs to render a post. Parts that
+// could not be loaded are null and listed in Errors.
+type PostPage struct {
+	Post     json.RawMessage `json:"post"`
+	Comments json.RawMessage `json:"comments"`
+	Clan     json.RawMessage `json:"clan"`
+	// Membership is the caller's membership of the post's clan, null for
+	// anonymous callers and non-members.
+	Membership json.RawMessage `json:"membership"`
+	Errors     []Error         `json:"errors"`
+}
+
+// NewPostPageHandler serves the post page view for the route parameter "id".
+// The post and its comments are fetched concurrently; the clan and the
+// caller's membership follow in parallel once the post names its clan. Only a
+// missing post fails the whole view.
+func NewPostPageHandler(upstream Upstream) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var postID int
+		var err error
+		if match := routing.FromContext(r.Context()); match != nil {
+			postID, err = strconv.Atoi(match.Params["id"])
+		}
+		if err != nil || postID <= 0 {
+			http.Error(w, "Invalid post ID", http.StatusBadRequest)
+			return
+		}
+
+		ctx := r.Context()
+		var wg sync.WaitGroup
+		var comments, clan, membership result
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			comments = fetch(ctx, upstream, "comments", "comment-service", fmt.Sprintf("/api/comments/post/%d", postID))
+		}()
+
+		post := fetch(ctx, upstream, "post", "post-service", fmt.Sprintf("/api/posts/%d", postID))
+		if post.err != nil {
+			wg.Wait()
+			if post.err.Status == http.StatusNotFound {
+				http.Error(w, "Post not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, post.err.Message, post.err.Status)
+			return
+		}
+
+		var fields struct {
+			ClanID *int `json:"clan_id"`
+		}
+		json.Unmarshal(post.body, &fields)
+
+		if fields.ClanID != nil {
+			clanID := *fields.ClanID
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				clan = fetch(ctx, upstream, "clan", "clan-service", fmt.Sprintf("/api/clans/%d", clanID))
+			}()
+
+			if _, ok := middleware.UserIDFromContext(ctx); ok {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					membership = fetch(ctx, upstream, "membership", "clan-service", fmt.Sprintf("/api/clans/%d/membership", clanID))
+					// The clan service answers 404 for non-members.
+					if membership.err != nil && membership.err.Status == http.StatusNotFound {
+						membership.err = nil
+					}
+				}()
+			}
+		}
+		wg.Wait()
+
+		page := PostPage{
+			Post:       post.body,
+			Comments:   comments.body,
+			Clan:       clan.body,
+			Membership: membership.body,
+			Errors:     []Error{},
+		}
+		for _, part := range []result{comments, clan, membership} {
+			if part.err != nil {
+				page.Errors = append(page.Errors, *part.err)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(page)
+	})
+}
@@ -0,0 +1,112 @@
+package views
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/AlexGuo43/clans/api-gateway/internal/routing"
+)
+
+// UserProfile is a user's public profile with their activity. Counts that
+// could not be loaded are null and listed in Errors; Karma, the net votes on
+// the user's posts and comments, is null if either is missing.
+type UserProfile struct {
+	ID           int       `json:"id"`
+	Username     string    `json:"username"`
+	DisplayName  string    `json:"display_name"`
+	Bio          string    `json:"bio"`
+	AvatarURL    string    `json:"avatar_url"`
+	CreatedAt    time.Time `json:"created_at"`
+	Karma        *int      `json:"karma"`
+	PostCount    *int      `json:"post_count"`
+	CommentCount *int      `json:"comment_count"`
+	Errors       []Error   `json:"errors"`
+}
+
+// authorStats is what the post and comment services report about a user's
+// posts or comments.
+type authorStats struct {
+	Count int `json:"count"`
+	Karma int `json:"karma"`
+}
+
+// NewUserProfileHandler serves the profile of the user named by the route
+// parameter "username", which may also be a user ID. The user is loaded
+// first, then their post and comment counts in parallel. Only a missing
+// user fails the whole view.
+func NewUserProfileHandler(upstream Upstream) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var name string
+		if match := routing.FromContext(r.Context()); match != nil {
+			name = match.Params["username"]
+		}
+		if name == "" {
+			http.Error(w, "Invalid username", http.StatusBadRequest)
+			return
+		}
+
+		ctx := r.Context()
+		user := fetch(ctx, upstream, "user", "user-service", "/profiles/"+url.PathEscape(name))
+		if user.err != nil {
+			if user.err.Status == http.StatusNotFound {
+				http.Error(w, "User not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, user.err.Message, user.err.Status)
+			return
+		}
+
+		var profile UserProfile
+		if err := json.Unmarshal(user.body, &profile); err != nil {
+			http.Error(w, "Bad Gateway", http.StatusBadGateway)
+			return
+		}
+
+		var wg sync.WaitGroup
+		var posts, comments result
+		base := "/api/users/" + url.PathEscape(profile.Username)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			posts = fetch(ctx, upstream, "posts", "post-service", base+"/posts/stats")
+		}()
+		go func() {
+			defer wg.Done()
+			comments = fetch(ctx, upstream, "comments", "comment-service", base+"/comments/stats")
+		}()
+		wg.Wait()
+
+		profile.Errors = []Error{}
+		for _, part := range []result{posts, comments} {
+			if part.err != nil {
+				profile.Errors = append(profile.Errors, *part.err)
+			}
+		}
+		postStats, commentStats := decodeStats(posts), decodeStats(comments)
+		if postStats != nil {
+			profile.PostCount = &postStats.Count
+		}
+		if commentStats != nil {
+			profile.CommentCount = &commentStats.Count
+		}
+		if postStats != nil && commentStats != nil {
+			karma := postStats.Karma + commentStats.Karma
+			profile.Karma = &karma
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(profile)
+	})
+}
+
+func decodeStats(part result) *authorStats {
+	if part.err != nil {
+		return nil
+	}
+	var stats authorStats
+	json.Unmarshal(part.body, &stats)
+	return &stats
+}
@@ -0,0 +1,71 @@
+package views
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/AlexGuo43/clans/api-gateway/internal/middleware"
+	"github.com/AlexGuo43/clans/api-gateway/internal/proxy"
+)
+
+// Upstream performs GET requests against the gateway's services on behalf of
+// the inbound request in ctx.
+type Upstream interface {
+	Fetch(ctx context.Context, service, path string) (*http.Response, error)
+}
+
+// Error describes a part of a view that could not be loaded. Views answer
+// with whatever did load and list the missing parts.
+type Error struct {
+	Source  string `json:"source"`
+	Service string `json:"service"`
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+// result is the outcome of fetching one part of a view.
+type result struct {
+	body json.RawMessage
+	err  *Error
+}
+
+// fetch loads the JSON document at path from service. Non-200 answers and
+// transport errors are reported as an Error for source.
+func fetch(ctx context.Context, upstream Upstream, source, service, path string) result {
+	resp, err := upstream.Fetch(ctx, service, path)
+	if err != nil {
+		status, message := proxy.ErrorStatus(err)
+		logFailure(ctx, source, service, err)
+		return result{err: &Error{Source: source, Service: service, Status: status, Message: message}}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return result{err: &Error{Source: source, Service: service, Status: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}}
+	}
+
+	var body json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		status, message := proxy.ErrorStatus(err)
+		logFailure(ctx, source, service, err)
+		return result{err: &Error{Source: source, Service: service, Status: status, Message: message}}
+	}
+	return result{body: body}
+}
+
+func logFailure(ctx context.Context, source, service string, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	slog.WarnContext(ctx, "view fetch failed",
+		"request_id", middleware.RequestIDFromContext(ctx),
+		"source", source,
+		"service", service,
+		"error", err,
+	)
+}
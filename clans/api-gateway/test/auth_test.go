@@ -0,0 +1,192 @@
+package gateway_test
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/AlexGuo43/clans/api-gateway/config"
+	"github.com/AlexGuo43/clans/api-gateway/internal/identity"
+	"github.com/AlexGuo43/clans/api-gateway/internal/middleware"
+	"github.com/AlexGuo43/clans/api-gateway/internal/ratelimit"
+	"github.com/AlexGuo43/clans/api-gateway/internal/routing"
+	"github.com/AlexGuo43/clans/api-gateway/internal/server"
+	"github.com/AlexGuo43/clans/api-gateway/internal/services"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestAuthMiddlewareStripsClientIdentityHeaders(t *testing.T) {
+	table, err := routing.NewTable([]config.RouteConfig{
+		{Path: "/api/posts/*", Methods: []string{"GET"}, Service: "post-service", Public: true},
+	})
+	if err != nil {
+		t.Fatalf("Failed to build route table: %v", err)
+	}
+
+	var userID, assertion string
+	handler := middleware.RouteMiddleware(table)(middleware.AuthMiddleware(services.NewAuthService(nil, nil))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID = r.Header.Get("X-User-ID")
+			assertion = r.Header.Get(identity.Header)
+		})))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/posts/1", nil)
+	req.Header.Set("X-User-ID", "1")
+	req.Header.Set(identity.Header, "forged")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if userID != "" || assertion != "" {
+		t.Errorf("Expected client identity headers to be stripped, got X-User-ID %q and assertion %q", userID, assertion)
+	}
+}
+
+// userService serves signingKey's public half as the user service's JWKS
+// and revokes the session "stolen". Like the real service, it only hands the
+// revocation list to the gateway itself.
+func userService(t *testing.T, signingKey ed25519.PrivateKey) string {
+	t.Helper()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/jwks.json":
+			fmt.Fprintf(w, `{"keys": [{"kty": "OKP", "crv": "Ed25519", "kid": "current", "use": "sig", "alg": "EdDSA", "x": %q}]}`,
+				base64.RawURLEncoding.EncodeToString(signingKey.Public().(ed25519.PublicKey)))
+		case "/internal/revocations":
+			claims := &identity.Claims{}
+			_, err := jwt.ParseWithClaims(r.Header.Get(identity.Header), claims, func(*jwt.Token) (interface{}, error) {
+				return []byte("test-internal-secret"), nil
+			})
+			if err != nil || !slices.Contains(claims.Roles, identity.GatewayRole) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			fmt.Fprintf(w, `{"revocations": [{"id": "stolen", "expires_at": %q}]}`, time.Now().Add(time.Hour).Format(time.RFC3339))
+		}
+	}))
+	t.Cleanup(backend.Close)
+	return backend.URL
+}
+
+func authServer(t *testing.T, signingKey ed25519.PrivateKey) *server.Server {
+	t.Helper()
+
+	url := userService(t, signingKey)
+	cfg := reloadConfig(url,
+		config.RouteConfig{Path: "/api/private", Methods: []string{"POST"}, Service: "post-service", VerifiedEmail: true},
+		config.RouteConfig{Path: "/api/private", Service: "post-service"})
+	cfg.Services = append(cfg.Services, config.ServiceConfig{
+		Name:           "user-service",
+		URLs:           []string{url},
+		CircuitBreaker: cfg.Services[0].CircuitBreaker,
+	})
+	cfg.Auth.JWKSRefreshInterval = time.Hour
+	cfg.Auth.RevocationSyncInterval = 10 * time.Millisecond
+	srv, err := server.New(cfg, ratelimit.NewMemoryStore(), nil)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func getPrivate(srv http.Handler, token string) int {
+	req := httptest.NewRequest(http.MethodGet, "/api/private", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func accessToken(method jwt.SigningMethod, kid, sessionID string, key interface{}) string {
+	return signClaims(method, kid, key, jwt.MapClaims{
+		"user_id": 1, "sid": sessionID, "jti": sessionID + "-token", "exp": time.Now().Add(time.Minute).Unix(),
+	})
+}
+
+func signClaims(method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	signed, _ := token.SignedString(key)
+	return signed
+}
+
+func TestTokensAreVerifiedWithPublishedKeys(t *testing.T) {
+	_, signingKey, _ := ed25519.GenerateKey(nil)
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+	srv := authServer(t, signingKey)
+
+	valid := accessToken(jwt.SigningMethodEdDSA, "current", "current", signingKey)
+	deadline := time.Now().Add(time.Second)
+	for getPrivate(srv, valid) != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected a token signed with a published key to be accepted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	forged := map[string]string{
+		"unpublished key": accessToken(jwt.SigningMethodEdDSA, "current", "current", otherKey),
+		"unknown kid":     accessToken(jwt.SigningMethodEdDSA, "next", "current", otherKey),
+		// The public key must not double as an HMAC secret.
+		"HS256": accessToken(jwt.SigningMethodHS256, "current", "current", []byte(signingKey.Public().(ed25519.PublicKey))),
+	}
+	for name, token := range forged {
+		if code := getPrivate(srv, token); code != http.StatusUnauthorized {
+			t.Errorf("Expected a token with %s to be refused, got %d", name, code)
+		}
+	}
+}
+
+func TestRevokedSessionsAreRefused(t *testing.T) {
+	_, signingKey, _ := ed25519.GenerateKey(nil)
+	srv := authServer(t, signingKey)
+
+	get := func(sessionID string) int {
+		return getPrivate(srv, accessToken(jwt.SigningMethodEdDSA, "current", sessionID, signingKey))
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for get("stolen") != http.StatusUnauthorized || get("current") != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the revoked session to be refused and other sessions accepted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestUnverifiedUsersCannotCreate(t *testing.T) {
+	_, signingKey, _ := ed25519.GenerateKey(nil)
+	srv := authServer(t, signingKey)
+
+	post := func(verified bool) int {
+		token := signClaims(jwt.SigningMethodEdDSA, "current", signingKey, jwt.MapClaims{
+			"user_id": 1, "sid": "current", "email_verified": verified, "exp": time.Now().Add(time.Minute).Unix(),
+		})
+		req := httptest.NewRequest(http.MethodPost, "/api/private", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for post(true) != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected a verified user to be let through")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if code := post(false); code != http.StatusForbidden {
+		t.Errorf("Expected an unverified user to get 403, got %d", code)
+	}
+	// Other routes are open to unverified users.
+	unverified := accessToken(jwt.SigningMethodEdDSA, "current", "current", signingKey)
+	if code := getPrivate(srv, unverified); code != http.StatusOK {
+		t.Errorf("Expected an unverified user to be let through on GET, got %d", code)
+	}
+}
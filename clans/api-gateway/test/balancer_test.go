@@ -0,0 +1,78 @@
+package gateway_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AlexGuo43/clans/api-gateway/internal/balancer"
+)
+
+func TestRoundRobinRotates(t *testing.T) {
+	pool, err := balancer.NewPool("post-service", []string{"http://a", "http://b"}, balancer.RoundRobin)
+	if err != nil {
+		t.Fatalf("NewPool failed: %v", err)
+	}
+
+	first, _ := pool.Pick("")
+	second, _ := pool.Pick("")
+	if first.URL == second.URL {
+		t.Errorf("Expected consecutive picks to rotate, got %s twice", first.URL)
+	}
+}
+
+func TestLeastConnections(t *testing.T) {
+	pool, _ := balancer.NewPool("post-service", []string{"http://a", "http://b"}, balancer.LeastConnections)
+
+	busy, _ := pool.Pick("")
+	release := busy.Acquire()
+	defer release()
+
+	next, _ := pool.Pick("")
+	if next.URL == busy.URL {
+		t.Errorf("Expected the idle backend, got %s", next.URL)
+	}
+}
+
+func TestConsistentHashIsSticky(t *testing.T) {
+	pool, _ := balancer.NewPool("post-service", []string{"http://a", "http://b", "http://c"}, balancer.ConsistentHash)
+
+	first, _ := pool.Pick("user:42")
+	for i := 0; i < 10; i++ {
+		backend, _ := pool.Pick("user:42")
+		if backend.URL != first.URL {
+			t.Fatalf("Expected user:42 to stick to %s, got %s", first.URL, backend.URL)
+		}
+	}
+}
+
+func TestHealthChecksRemoveUnhealthyBackend(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	pool, _ := balancer.NewPool("post-service", []string{down.URL}, balancer.RoundRobin)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pool.RunHealthChecks(ctx, http.DefaultClient, balancer.HealthCheckSettings{
+		Path:               "/health",
+		Interval:           5 * time.Millisecond,
+		Timeout:            time.Second,
+		UnhealthyThreshold: 2,
+		HealthyThreshold:   1,
+	})
+
+	deadline := time.Now().Add(time.Second)
+	for pool.Backends()[0].Healthy() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if _, err := pool.Pick(""); !errors.Is(err, balancer.ErrNoHealthyBackend) {
+		t.Errorf("Expected ErrNoHealthyBackend, got %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package gateway_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AlexGuo43/clans/api-gateway/internal/breaker"
+)
+
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+	cb := breaker.New(breaker.Settings{FailureThreshold: 2, OpenTimeout: time.Hour, HalfOpenRequests: 1})
+
+	for i := 0; i < 2; i++ {
+		if err := cb.Allow(); err != nil {
+			t.Fatalf("Attempt %d should be allowed: %v", i+1, err)
+		}
+		cb.Failure()
+	}
+
+	if cb.State() != breaker.Open {
+		t.Fatalf("Expected open breaker, got %s", cb.State())
+	}
+	if err := cb.Allow(); !errors.Is(err, breaker.ErrOpen) {
+		t.Errorf("Expected ErrOpen, got %v", err)
+	}
+}
+
+func TestBreakerHalfOpenProbe(t *testing.T) {
+	cb := breaker.New(breaker.Settings{FailureThreshold: 1, OpenTimeout: 10 * time.Millisecond, HalfOpenRequests: 1})
+
+	cb.Allow()
+	cb.Failure()
+	time.Sleep(20 * time.Millisecond)
+
+	if cb.State() != breaker.HalfOpen {
+		t.Fatalf("Expected half-open breaker, got %s", cb.State())
+	}
+	if err := cb.Allow(); err != nil {
+		t.Fatalf("First probe should be allowed: %v", err)
+	}
+	if err := cb.Allow(); !errors.Is(err, breaker.ErrOpen) {
+		t.Errorf("Second concurrent probe should be rejected, got %v", err)
+	}
+
+	cb.Success()
+	if cb.State() != breaker.Closed {
+		t.Errorf("Expected closed breaker after successful probe, got %s", cb.State())
+	}
+}
+
+func TestBreakerReleaseFreesProbe(t *testing.T) {
+	cb := breaker.New(breaker.Settings{FailureThreshold: 1, OpenTimeout: 10 * time.Millisecond, HalfOpenRequests: 1})
+
+	cb.Allow()
+	cb.Failure()
+	time.Sleep(20 * time.Millisecond)
+
+	if err := cb.Allow(); err != nil {
+		t.Fatalf("First probe should be allowed: %v", err)
+	}
+	cb.Release()
+	if cb.State() != breaker.HalfOpen {
+		t.Errorf("Expected a released probe to leave the breaker half-open, got %s", cb.State())
+	}
+	if err := cb.Allow(); err != nil {
+		t.Errorf("Expected the released slot to be free for another probe, got %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package gateway_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AlexGuo43/clans/api-gateway/config"
+	"github.com/AlexGuo43/clans/api-gateway/internal/cache"
+	"github.com/AlexGuo43/clans/api-gateway/internal/middleware"
+	"github.com/AlexGuo43/clans/api-gateway/internal/ratelimit"
+	"github.com/AlexGuo43/clans/api-gateway/internal/server"
+)
+
+// newCachingGateway caches /api/posts/clan/{id}, tagged "clan:{id}", from a
+// service that answers with the number of the call and marks clan 99 as
+// not to be stored. POSTs to the same path purge the clan's tag; the service
+// refuses those for clan 13.
+func newCachingGateway(t *testing.T, cache config.RouteCacheConfig) (*server.Server, *atomic.Int64) {
+	t.Helper()
+
+	var calls atomic.Int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			return // health checks
+		}
+		call := calls.Add(1)
+		if r.Method == http.MethodPost && r.URL.Path == "/api/posts/clan/13" {
+			http.Error(w, "Not a member", http.StatusForbidden)
+			return
+		}
+		if r.URL.Path == "/api/posts/clan/99" {
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, call))
+		fmt.Fprintf(w, "call %d", call)
+	}))
+	t.Cleanup(backend.Close)
+
+	cache.Tags = []string{"clan:{id}"}
+	cfg := reloadConfig(backend.URL, config.RouteConfig{
+		Path: "/api/posts/clan/{id}", Methods: []string{"GET"}, Service: "post-service", Public: true, Cache: &cache,
+	}, config.RouteConfig{
+		Path: "/api/posts/clan/{id}", Methods: []string{"POST"}, Service: "post-service", Public: true, Purge: []string{"clan:{id}"},
+	})
+	cfg.CachePurgeToken = "test-purge-token"
+	srv, err := server.New(cfg, ratelimit.NewMemoryStore(), nil)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func getCached(handler http.Handler, path string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCacheServesRepeatedReads(t *testing.T) {
+	handler, calls := newCachingGateway(t, config.RouteCacheConfig{TTL: time.Minute})
+
+	if rec := getCached(handler, "/api/posts/clan/12"); rec.Header().Get("X-Cache") != "MISS" || rec.Body.String() != "call 1" {
+		t.Fatalf("Expected a miss served by the service, got %s %q", rec.Header().Get("X-Cache"), rec.Body)
+	}
+	rec := getCached(handler, "/api/posts/clan/12")
+	if rec.Header().Get("X-Cache") != "HIT" || rec.Body.String() != "call 1" {
+		t.Errorf("Expected a hit with the first response, got %s %q", rec.Header().Get("X-Cache"), rec.Body)
+	}
+	if rec := getCached(handler, "/api/posts/clan/12", "If-None-Match", `"1"`); rec.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for the cached ETag, got %d", rec.Code)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Expected the service to be called once, got %d", calls.Load())
+	}
+
+	// A different query, a signed-in caller and a no-store response all
+	// reach the service.
+	getCached(handler, "/api/posts/clan/12?page=2")
+	getCached(handler, "/api/posts/clan/12", "Authorization", "Bearer token")
+	getCached(handler, "/api/posts/clan/99")
+	getCached(handler, "/api/posts/clan/99")
+	if calls.Load() != 5 {
+		t.Errorf("Expected five service calls, got %d", calls.Load())
+	}
+}
+
+func TestCachePurgeByTag(t *testing.T) {
+	srv, calls := newCachingGateway(t, config.RouteCacheConfig{TTL: time.Minute})
+	handler := srv.Handler
+	getCached(handler, "/api/posts/clan/12")
+	getCached(handler, "/api/posts/clan/13")
+
+	purge := func(handler http.Handler, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/internal/cache/purge", strings.NewReader(`{"tags": ["clan:12"]}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := purge(handler, "test-purge-token"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected purges to be unreachable on the public port, got %d", rec.Code)
+	}
+	if rec := purge(srv.Internal, "test-internal-secret"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without the purge token, got %d", rec.Code)
+	}
+	if rec := purge(srv.Internal, "test-purge-token"); rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"purged":1}` {
+		t.Fatalf("Expected one entry purged, got %d %q", rec.Code, rec.Body)
+	}
+
+	if rec := getCached(handler, "/api/posts/clan/12"); rec.Body.String() != "call 3" {
+		t.Errorf("Expected the purged entry to be fetched again, got %q", rec.Body)
+	}
+	if rec := getCached(handler, "/api/posts/clan/13"); rec.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("Expected other tags to stay cached, got %s", rec.Header().Get("X-Cache"))
+	}
+	if calls.Load() != 3 {
+		t.Errorf("Expected three service calls, got %d", calls.Load())
+	}
+}
+
+func TestCachePurgedBySuccessfulWrites(t *testing.T) {
+	handler, calls := newCachingGateway(t, config.RouteCacheConfig{TTL: time.Minute})
+	getCached(handler, "/api/posts/clan/12")
+	getCached(handler, "/api/posts/clan/13")
+
+	write := func(path string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{}`)))
+		return rec.Code
+	}
+	if code := write("/api/posts/clan/12"); code != http.StatusOK {
+		t.Fatalf("Expected the write to succeed, got %d", code)
+	}
+	if code := write("/api/posts/clan/13"); code != http.StatusForbidden {
+		t.Fatalf("Expected the write to be refused, got %d", code)
+	}
+
+	if rec := getCached(handler, "/api/posts/clan/12"); rec.Header().Get("X-Cache") != "MISS" || rec.Body.String() != "call 5" {
+		t.Errorf("Expected the written list to be fetched again, got %s %q", rec.Header().Get("X-Cache"), rec.Body)
+	}
+	if rec := getCached(handler, "/api/posts/clan/13"); rec.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("Expected a refused write to leave the list cached, got %s", rec.Header().Get("X-Cache"))
+	}
+	if calls.Load() != 5 {
+		t.Errorf("Expected five service calls, got %d", calls.Load())
+	}
+}
+
+func TestCachePurgerFollowsRouteTable(t *testing.T) {
+	store := cache.NewMemoryStore(100, 1<<20)
+	purge := middleware.CachePurger(store, loadRoutes(t))
+	ctx := context.Background()
+	fill := func() {
+		for key, tags := range map[string][]string{"posts": {"posts"}, "clan 12": {"clan:12", "posts"}, "clans": {"clans"}} {
+			store.Set(ctx, key, &cache.Entry{Tags: tags, StoredAt: time.Now(), TTL: time.Minute})
+		}
+	}
+	cached := func() (keys []string) {
+		for _, key := range []string{"posts", "clan 12", "clans"} {
+			if entry, _ := store.Get(ctx, key); entry != nil {
+				keys = append(keys, key)
+			}
+		}
+		return keys
+	}
+
+	tests := []struct {
+		method, path string
+		want         []string
+	}{
+		{"GET", "/api/posts", []string{"posts", "clan 12", "clans"}},
+		{"POST", "/api/posts", []string{"clans"}},
+		{"POST", "/api/posts/7/vote", []string{"clans"}},
+		{"POST", "/api/clans/12/join", []string{"posts", "clan 12"}},
+		{"PUT", "/api/clans/12", []string{"posts"}},
+		{"PUT", "/api/users/me", []string{"posts", "clan 12", "clans"}},
+	}
+	for _, tt := range tests {
+		fill()
+		purge(ctx, tt.method, tt.path)
+		if got := cached(); !slices.Equal(got, tt.want) {
+			t.Errorf("%s %s: expected %v to stay cached, got %v", tt.method, tt.path, tt.want, got)
+		}
+	}
+}
+
+func TestCacheServesStaleWhileRevalidating(t *testing.T) {
+	handler, _ := newCachingGateway(t, config.RouteCacheConfig{TTL: 50 * time.Millisecond, StaleWhileRevalidate: time.Minute})
+	getCached(handler, "/api/posts/clan/12")
+	time.Sleep(100 * time.Millisecond)
+
+	rec := getCached(handler, "/api/posts/clan/12")
+	if rec.Header().Get("X-Cache") != "STALE" || rec.Body.String() != "call 1" {
+		t.Fatalf("Expected the stale response, got %s %q", rec.Header().Get("X-Cache"), rec.Body)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		rec := getCached(handler, "/api/posts/clan/12")
+		if rec.Body.String() != "call 1" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the refreshed response, got %q", rec.Body)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
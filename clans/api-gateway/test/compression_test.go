@@ -0,0 +1,135 @@
+package gateway_test
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/AlexGuo43/clans/api-gateway/config"
+	"github.com/AlexGuo43/clans/api-gateway/internal/ratelimit"
+	"github.com/AlexGuo43/clans/api-gateway/internal/server"
+	"github.com/andybalholm/brotli"
+)
+
+// newCompressingGateway proxies /api/posts to a service that tags post 7,
+// whose title is long enough to compress, with the ETag "abc" and answers
+// If-None-Match for it with 304. Other posts are short.
+func newCompressingGateway(t *testing.T) http.Handler {
+	t.Helper()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		title := "short"
+		if r.URL.Path == "/api/posts/7" {
+			title = strings.Repeat("gophers ", 500)
+		}
+		w.Header().Set("ETag", `"abc"`)
+		if strings.TrimPrefix(r.Header.Get("If-None-Match"), "W/") == `"abc"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id": 7, "title": title, "user_id": 1, "username": "ann", "clan_id": 3, "clan_name": "gophers",
+		})
+	}))
+	t.Cleanup(backend.Close)
+
+	cfg := reloadConfig(backend.URL, config.RouteConfig{
+		Path: "/api/posts/*", Service: "post-service", Public: true,
+		Transforms: map[string]string{"v2": "post-v2"},
+	})
+	cfg.APIVersions = config.APIVersionsConfig{Default: "v1", Versions: []config.VersionConfig{{Name: "v1"}, {Name: "v2"}}}
+	cfg.Compression = config.CompressionConfig{Encodings: []string{"br", "gzip"}, MinSize: 1 << 10}
+	srv, err := server.New(cfg, ratelimit.NewMemoryStore(), nil)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func getWithHeader(handler http.Handler, path, name, value string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if value != "" {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCompressionNegotiatesEncoding(t *testing.T) {
+	handler := newCompressingGateway(t)
+
+	tests := []struct {
+		acceptEncoding string
+		encoding       string
+		decode         func(io.Reader) (io.Reader, error)
+	}{
+		{"gzip, br", "br", func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil }},
+		{"br;q=0.5, gzip", "gzip", func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+		{"br;q=0, *", "gzip", func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+		{"", "", func(r io.Reader) (io.Reader, error) { return r, nil }},
+	}
+
+	for _, tt := range tests {
+		rec := getWithHeader(handler, "/api/posts/7", "Accept-Encoding", tt.acceptEncoding)
+		if got := rec.Header().Get("Content-Encoding"); got != tt.encoding {
+			t.Errorf("Accept-Encoding %q: expected encoding %q, got %q", tt.acceptEncoding, tt.encoding, got)
+			continue
+		}
+		if vary := rec.Header().Values("Vary"); !slices.Contains(vary, "Accept-Encoding") {
+			t.Errorf("Accept-Encoding %q: expected Vary: Accept-Encoding, got %q", tt.acceptEncoding, vary)
+		}
+
+		body, err := tt.decode(rec.Body)
+		if err != nil {
+			t.Fatalf("Accept-Encoding %q: failed to decode body: %v", tt.acceptEncoding, err)
+		}
+		var post struct{ Title string }
+		if err := json.NewDecoder(body).Decode(&post); err != nil || !strings.HasPrefix(post.Title, "gophers") {
+			t.Errorf("Accept-Encoding %q: expected the post, got %q (%v)", tt.acceptEncoding, post.Title, err)
+		}
+
+		wantTag := `"abc"`
+		if tt.encoding != "" {
+			wantTag = `W/"abc"`
+		}
+		if tag := rec.Header().Get("ETag"); tag != wantTag {
+			t.Errorf("Accept-Encoding %q: expected ETag %s, got %s", tt.acceptEncoding, wantTag, tag)
+		}
+	}
+
+	rec := getWithHeader(handler, "/api/posts/8", "Accept-Encoding", "gzip")
+	if rec.Header().Get("Content-Encoding") != "" || !strings.Contains(rec.Body.String(), "short") {
+		t.Errorf("Expected a small response to be sent as is, got %v %q", rec.Header(), rec.Body)
+	}
+}
+
+func TestConditionalGetAcrossVersions(t *testing.T) {
+	handler := newCompressingGateway(t)
+
+	rec := getWithHeader(handler, "/api/posts/7", "If-None-Match", `W/"abc"`)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("Expected 304 for a matching tag, got %d %q", rec.Code, rec.Body)
+	}
+
+	rec = getWithHeader(handler, "/api/v2/posts/7", "", "")
+	if tag := rec.Header().Get("ETag"); rec.Code != http.StatusOK || tag != `"abc-v2"` {
+		t.Fatalf("Expected 200 with the ETag \"abc-v2\", got %d %s", rec.Code, tag)
+	}
+	rec = getWithHeader(handler, "/api/v2/posts/7", "If-None-Match", `"abc-v2"`)
+	if tag := rec.Header().Get("ETag"); rec.Code != http.StatusNotModified || tag != `"abc-v2"` {
+		t.Errorf("Expected 304 with the ETag \"abc-v2\", got %d %s", rec.Code, tag)
+	}
+
+	// v1's representation is not v2's.
+	if rec := getWithHeader(handler, "/api/v2/posts/7", "If-None-Match", `"abc"`); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 for another version's tag, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,55 @@
+package gateway_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexGuo43/clans/api-gateway/config"
+)
+
+// loadConfigYAML loads a gateway config with one service and the given
+// extra YAML.
+func loadConfigYAML(t *testing.T, extra string) (*config.Config, error) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "gateway.yaml")
+	yaml := "services:\n  - name: post-service\n    url: http://127.0.0.1:1\n" + extra
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	t.Setenv("GATEWAY_CONFIG", path)
+	t.Setenv("INTERNAL_AUTH_SECRET", "test-internal-secret")
+	return config.LoadConfig()
+}
+
+func TestConfigDefaultsZeroDurations(t *testing.T) {
+	cfg, err := loadConfigYAML(t, "upstream:\n  timeout: 0s\nhealth_check:\n  interval: 0s\n")
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Upstream.Timeout != 10*time.Second || cfg.HealthCheck.Interval != 10*time.Second || cfg.HealthCheck.Timeout != 2*time.Second {
+		t.Errorf("Expected defaults, got upstream timeout %v and health check every %v within %v",
+			cfg.Upstream.Timeout, cfg.HealthCheck.Interval, cfg.HealthCheck.Timeout)
+	}
+}
+
+func TestConfigRejectsNegativeDurations(t *testing.T) {
+	tests := []struct {
+		name, yaml, want string
+	}{
+		{"upstream timeout", "upstream:\n  timeout: -1s\n", "upstream timeout"},
+		{"health check interval", "health_check:\n  interval: -10s\n", "health_check"},
+		{"health check timeout", "health_check:\n  timeout: -2s\n", "health_check"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadConfigYAML(t, tt.yaml)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected an error about %s, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package gateway_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AlexGuo43/clans/api-gateway/config"
+	"github.com/AlexGuo43/clans/api-gateway/internal/cors"
+	"github.com/AlexGuo43/clans/api-gateway/internal/middleware"
+	"github.com/AlexGuo43/clans/api-gateway/internal/routing"
+)
+
+func TestCORSOriginMatching(t *testing.T) {
+	policy, err := cors.NewPolicy(config.CORSConfig{
+		AllowedOrigins: []string{"https://app.example.com", "https://*.clans.dev", "http://localhost:3000"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to build policy: %v", err)
+	}
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://app.example.com", true},
+		{"https://APP.example.com", true},
+		{"http://app.example.com", false},
+		{"https://staging.clans.dev", true},
+		{"https://a.b.clans.dev", true},
+		{"https://clans.dev", false},
+		{"https://evil.com/.clans.dev", false},
+		{"http://localhost:3000", true},
+		{"http://localhost:3001", false},
+	}
+	for _, tt := range tests {
+		if got := policy.AllowOrigin(tt.origin); got != tt.want {
+			t.Errorf("AllowOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	routes := []config.RouteConfig{
+		{Path: "/api/posts/*", Methods: []string{"POST"}, Service: "post-service",
+			CORS: &config.RouteCORSConfig{AllowedHeaders: []string{"Content-Type", "Authorization", "Idempotency-Key"}}},
+		{Path: "/api/posts/*", Service: "post-service"},
+	}
+	table, err := routing.NewTable(routes)
+	if err != nil {
+		t.Fatalf("Failed to build route table: %v", err)
+	}
+	policy, err := cors.NewPolicy(config.CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		AllowedMethods:   []string{"GET", "POST"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("Failed to build policy: %v", err)
+	}
+
+	reached := false
+	handler := middleware.CorsMiddleware(policy, table)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+
+	preflight := func(origin, method, headers string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodOptions, "/api/posts", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", method)
+		if headers != "" {
+			req.Header.Set("Access-Control-Request-Headers", headers)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := preflight("https://app.example.com", "POST", "content-type, idempotency-key")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204 for allowed preflight, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("Expected echoed origin, got %q", got)
+	}
+	if got := rec.Header().Get("Access-Control-Max-Age"); got != "600" {
+		t.Errorf("Expected max age 600, got %q", got)
+	}
+	if reached {
+		t.Error("Preflight should not reach the next handler")
+	}
+
+	if rec := preflight("https://app.example.com", "GET", "Idempotency-Key"); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for header not allowed on GET route, got %d", rec.Code)
+	}
+	if rec := preflight("https://evil.example.com", "POST", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for unknown origin, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/posts", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if !reached {
+		t.Error("Actual request should reach the next handler")
+	}
+	if got := rec.Header().Get("Vary"); got != "Origin" {
+		t.Errorf("Expected Vary: Origin, got %q", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("Expected credentials to be allowed, got %q", got)
+	}
+}
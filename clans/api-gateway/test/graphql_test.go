@@ -0,0 +1,101 @@
+package gateway_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func postGraphQL(t *testing.T, handler http.Handler, query string) graphQLResponse {
+	t.Helper()
+
+	body, _ := json.Marshal(map[string]string{"query": query})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp graphQLResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return resp
+}
+
+func TestGraphQLDeduplicatesUpstreamCalls(t *testing.T) {
+	var mu sync.Mutex
+	calls := make(map[string]int)
+
+	upstream := http.NewServeMux()
+	upstream.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls[r.URL.Path]++
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/api/posts":
+			w.Write([]byte(`[{"id":1,"title":"a","user_id":1,"username":"ann","clan_id":3},{"id":2,"title":"b","user_id":2,"username":"bob","clan_id":3}]`))
+		case "/api/clans/3":
+			w.Write([]byte(`{"id":3,"name":"gophers","owner_id":1,"owner_name":"ann"}`))
+		case "/api/comments/post/1", "/api/comments/post/2":
+			w.Write([]byte(`[{"id":9,"content":"hi","user_id":2,"username":"bob","replies":[]}]`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	handler := newViewGateway(t, upstream)
+
+	resp := postGraphQL(t, handler, `{
+		posts(limit: 2) {
+			title
+			author { username }
+			clan { name owner { username } }
+			comments(limit: 5) { content author { username } }
+		}
+	}`)
+	if len(resp.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %+v", resp.Errors)
+	}
+
+	var data struct {
+		Posts []struct {
+			Title string
+			Clan  struct{ Name string }
+		}
+	}
+	json.Unmarshal(resp.Data, &data)
+	if len(data.Posts) != 2 || data.Posts[1].Clan.Name != "gophers" {
+		t.Errorf("Unexpected data: %s", resp.Data)
+	}
+
+	if calls["/api/clans/3"] != 1 {
+		t.Errorf("Expected the shared clan to be fetched once, got %d", calls["/api/clans/3"])
+	}
+	for path, n := range calls {
+		if strings.HasPrefix(path, "/api/users") || (path != "/api/clans/3" && n != 1) {
+			t.Errorf("Unexpected upstream calls to %s: %d", path, n)
+		}
+	}
+}
+
+func TestGraphQLMutationRequiresAuthentication(t *testing.T) {
+	handler := newViewGateway(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Unexpected upstream call to %s", r.URL.Path)
+	}))
+
+	resp := postGraphQL(t, handler, `mutation { joinClan(clanId: "3") { role } }`)
+	if len(resp.Errors) != 1 || resp.Errors[0].Message != "authentication required" {
+		t.Errorf("Expected an authentication error, got %+v", resp.Errors)
+	}
+}
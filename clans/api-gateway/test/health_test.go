@@ -0,0 +1,106 @@
+package gateway_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AlexGuo43/clans/api-gateway/config"
+	"github.com/AlexGuo43/clans/api-gateway/internal/proxy"
+)
+
+type healthReport struct {
+	Status   string `json:"status"`
+	Services map[string]struct {
+		Status    string   `json:"status"`
+		LatencyMS *float64 `json:"latency_ms"`
+		Backends  []struct {
+			Healthy bool   `json:"healthy"`
+			Error   string `json:"error"`
+		} `json:"backends"`
+	} `json:"services"`
+}
+
+func backendWithStatus(t *testing.T, status int) string {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+// checkHealth starts health checks against the given services and returns
+// the gateway's report once every backend has been probed enough times to
+// settle.
+func checkHealth(t *testing.T, services map[string]string) (int, healthReport) {
+	t.Helper()
+
+	cfg := &config.Config{
+		InternalAuthSecret: "test-internal-secret",
+		HealthCheck: config.HealthCheckConfig{
+			Path:               "/readyz",
+			Interval:           5 * time.Millisecond,
+			Timeout:            time.Second,
+			UnhealthyThreshold: 1,
+			HealthyThreshold:   1,
+		},
+	}
+	for name, url := range services {
+		cfg.Services = append(cfg.Services, config.ServiceConfig{
+			Name:           name,
+			URLs:           []string{url},
+			CircuitBreaker: &config.CircuitBreakerConfig{FailureThreshold: 5, OpenTimeout: time.Minute, HalfOpenRequests: 1},
+		})
+	}
+
+	gateway, err := proxy.NewGateway(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	gateway.StartHealthChecks(ctx)
+	time.Sleep(50 * time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	gateway.HealthCheck(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var report healthReport
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("Failed to decode health report: %v", err)
+	}
+	return rec.Code, report
+}
+
+func TestHealthReportsDegradedService(t *testing.T) {
+	code, report := checkHealth(t, map[string]string{
+		"post-service":    backendWithStatus(t, http.StatusOK),
+		"comment-service": backendWithStatus(t, http.StatusServiceUnavailable),
+	})
+
+	if code != http.StatusOK || report.Status != "degraded" {
+		t.Errorf("Expected 200 and degraded, got %d and %q", code, report.Status)
+	}
+	if posts := report.Services["post-service"]; posts.Status != "healthy" || posts.LatencyMS == nil {
+		t.Errorf("Expected post-service to be healthy with a latency, got %+v", posts)
+	}
+	comments := report.Services["comment-service"]
+	if comments.Status != "unhealthy" || len(comments.Backends) != 1 || comments.Backends[0].Error == "" {
+		t.Errorf("Expected comment-service to be unhealthy with an error, got %+v", comments)
+	}
+}
+
+func TestHealthUnavailableWhenEveryServiceIsDown(t *testing.T) {
+	code, report := checkHealth(t, map[string]string{
+		"post-service": backendWithStatus(t, http.StatusServiceUnavailable),
+	})
+
+	if code != http.StatusServiceUnavailable || report.Status != "unhealthy" {
+		t.Errorf("Expected 503 and unhealthy, got %d and %q", code, report.Status)
+	}
+}
@@ -0,0 +1,93 @@
+package gateway_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AlexGuo43/clans/api-gateway/internal/ratelimit"
+	"github.com/AlexGuo43/clans/api-gateway/internal/server"
+)
+
+// newIdempotentGateway proxies /api/posts to a service that answers each
+// POST with its number, failing the calls listed in fail with 503.
+func newIdempotentGateway(t *testing.T, fail ...int64) (http.Handler, *atomic.Int64) {
+	t.Helper()
+
+	var calls atomic.Int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			return // health checks
+		}
+		call := calls.Add(1)
+		for _, n := range fail {
+			if call == n {
+				http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, "post %d", call)
+	}))
+	t.Cleanup(backend.Close)
+
+	cfg := reloadConfig(backend.URL)
+	cfg.Idempotency.TTL = time.Hour
+	srv, err := server.New(cfg, ratelimit.NewMemoryStore(), nil)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func postWithKey(handler http.Handler, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/posts", strings.NewReader(body))
+	req.Header.Set("Idempotency-Key", key)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIdempotencyKeyReplaysFirstResponse(t *testing.T) {
+	handler, calls := newIdempotentGateway(t)
+	body := `{"title": "Hello", "content": "world"}`
+
+	first := postWithKey(handler, "abc", body)
+	retry := postWithKey(handler, "abc", body)
+	if first.Code != http.StatusCreated || retry.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 twice, got %d and %d", first.Code, retry.Code)
+	}
+	if retry.Body.String() != "post 1" || retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("Expected the first response replayed, got %q %v", retry.Body, retry.Header())
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Expected the service to be called once, got %d", calls.Load())
+	}
+
+	if rec := postWithKey(handler, "abc", `{"title": "Other", "content": "post"}`); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a reused key, got %d", rec.Code)
+	}
+	if rec := postWithKey(handler, "def", body); rec.Body.String() != "post 2" {
+		t.Errorf("Expected a new key to reach the service, got %q", rec.Body)
+	}
+}
+
+func TestIdempotencyKeyRetriesServerErrors(t *testing.T) {
+	handler, calls := newIdempotentGateway(t, 1)
+	body := `{"title": "Hello", "content": "world"}`
+
+	if rec := postWithKey(handler, "abc", body); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503, got %d", rec.Code)
+	}
+	if rec := postWithKey(handler, "abc", body); rec.Code != http.StatusCreated || rec.Body.String() != "post 2" {
+		t.Errorf("Expected the retry to reach the service, got %d %q", rec.Code, rec.Body)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Expected two service calls, got %d", calls.Load())
+	}
+}
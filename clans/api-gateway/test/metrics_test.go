@@ -0,0 +1,44 @@
+package gateway_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AlexGuo43/clans/api-gateway/config"
+	"github.com/AlexGuo43/clans/api-gateway/internal/metrics"
+	"github.com/AlexGuo43/clans/api-gateway/internal/middleware"
+	"github.com/AlexGuo43/clans/api-gateway/internal/routing"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsMiddlewareLabelsByRoute(t *testing.T) {
+	table, err := routing.NewTable([]config.RouteConfig{
+		{Path: "/api/posts/{id}/vote", Methods: []string{"POST"}, Service: "post-service"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to build route table: %v", err)
+	}
+
+	handler := middleware.RouteMiddleware(table)(middleware.MetricsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})))
+
+	counter := metrics.HTTPRequests.WithLabelValues("POST /api/posts/{id}/vote", "POST", "201")
+	before := testutil.ToFloat64(counter)
+
+	for _, path := range []string{"/api/posts/1/vote", "/api/posts/2/vote"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, nil))
+	}
+
+	if got := testutil.ToFloat64(counter) - before; got != 2 {
+		t.Errorf("Expected 2 requests counted under the route pattern, got %v", got)
+	}
+
+	unmatched := metrics.HTTPRequests.WithLabelValues("unmatched", "GET", "201")
+	before = testutil.ToFloat64(unmatched)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/unknown", nil))
+	if got := testutil.ToFloat64(unmatched) - before; got != 1 {
+		t.Errorf("Expected unmatched request to be counted once, got %v", got)
+	}
+}
@@ -0,0 +1,100 @@
+package gateway_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/AlexGuo43/clans/api-gateway/config"
+	"github.com/AlexGuo43/clans/api-gateway/internal/middleware"
+	"github.com/AlexGuo43/clans/api-gateway/internal/openapi"
+	"github.com/AlexGuo43/clans/api-gateway/internal/ratelimit"
+	"github.com/AlexGuo43/clans/api-gateway/internal/server"
+)
+
+func TestSpecCoversRouteTable(t *testing.T) {
+	spec, err := openapi.Load()
+	if err != nil {
+		t.Fatalf("Failed to load spec: %v", err)
+	}
+	table := loadRoutes(t)
+	params := regexp.MustCompile(`\{[^}]+\}`)
+
+	for _, operation := range spec.Operations() {
+		method, path, _ := strings.Cut(operation, " ")
+		switch path {
+		case "/health", "/livez", "/readyz", "/metrics":
+			continue
+		}
+		if table.Match(method, params.ReplaceAllString(path, "1")) == nil {
+			t.Errorf("%s is in the spec but not in the route table", operation)
+		}
+	}
+}
+
+func newValidatingGateway(t *testing.T) http.Handler {
+	t.Helper()
+
+	cfg := reloadConfig(namedBackend(t, "ok"), config.RouteConfig{Path: "/api/posts/*", Service: "post-service", Public: true})
+	srv, err := server.New(cfg, ratelimit.NewMemoryStore(), nil)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestValidationRejectsInvalidRequests(t *testing.T) {
+	handler := newValidatingGateway(t)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		errors []string
+	}{
+		{"query", http.MethodGet, "/api/posts?limit=-1&page=x", "", []string{"query page", "query limit"}},
+		{"path", http.MethodGet, "/api/posts/abc", "", []string{"path id"}},
+		{"body", http.MethodPost, "/api/posts", `{"content": 42, "extra": true}`, []string{"body content", "body ", "body title"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("Expected 400, got %d: %s", rec.Code, rec.Body)
+			}
+
+			var resp middleware.ValidationError
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode error: %v", err)
+			}
+			var got []string
+			for _, field := range resp.Errors {
+				got = append(got, field.Location+" "+field.Field)
+			}
+			if resp.Error != "invalid_request" || strings.Join(got, ",") != strings.Join(tt.errors, ",") {
+				t.Errorf("Expected errors at %v, got %+v", tt.errors, resp)
+			}
+		})
+	}
+}
+
+func TestValidationPassesValidRequests(t *testing.T) {
+	handler := newValidatingGateway(t)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/api/posts?limit=10", nil),
+		httptest.NewRequest(http.MethodPost, "/api/posts", strings.NewReader(`{"title": "Hi", "content": "there"}`)),
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || rec.Body.String() != "ok" {
+			t.Errorf("Expected %s %s to reach the service, got %d: %s", req.Method, req.URL, rec.Code, rec.Body)
+		}
+	}
+}
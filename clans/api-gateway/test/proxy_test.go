@@ -0,0 +1,240 @@
+package gateway_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AlexGuo43/clans/api-gateway/config"
+	"github.com/AlexGuo43/clans/api-gateway/internal/identity"
+	"github.com/AlexGuo43/clans/api-gateway/internal/middleware"
+	"github.com/AlexGuo43/clans/api-gateway/internal/proxy"
+	"github.com/AlexGuo43/clans/api-gateway/internal/routing"
+	"github.com/AlexGuo43/clans/api-gateway/internal/tracing"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newTestGateway(t *testing.T, upstream http.Handler) http.Handler {
+	t.Helper()
+	return newTestGatewayWith(t, upstream, nil)
+}
+
+// newTestGatewayWith lets configure adjust the config before the gateway is
+// built.
+func newTestGatewayWith(t *testing.T, upstream http.Handler, configure func(*config.Config)) http.Handler {
+	t.Helper()
+
+	backend := httptest.NewServer(upstream)
+	t.Cleanup(backend.Close)
+
+	cfg := &config.Config{
+		Services: []config.ServiceConfig{{
+			Name:           "post-service",
+			URLs:           []string{backend.URL},
+			CircuitBreaker: &config.CircuitBreakerConfig{FailureThreshold: 5, OpenTimeout: time.Minute, HalfOpenRequests: 1},
+		}},
+		Routes:             []config.RouteConfig{{Path: "/api/posts/*", Service: "post-service"}},
+		InternalAuthSecret: "test-internal-secret",
+		Upstream: config.UpstreamConfig{
+			Timeout:         time.Second,
+			MaxBodySize:     16,
+			MaxResponseSize: 32,
+		},
+	}
+
+	if configure != nil {
+		configure(cfg)
+	}
+
+	table, err := routing.NewTable(cfg.Routes)
+	if err != nil {
+		t.Fatalf("Failed to build route table: %v", err)
+	}
+	gateway, err := proxy.NewGateway(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+
+	handler := middleware.RouteMiddleware(table)(middleware.TracingMiddleware(http.HandlerFunc(gateway.RouteRequest)))
+	return middleware.ForwardedMiddleware(nil)(handler)
+}
+
+func TestProxyRejectsLargeRequestBody(t *testing.T) {
+	handler := newTestGateway(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/posts/", strings.NewReader(strings.Repeat("a", 17)))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413, got %d", rec.Code)
+	}
+}
+
+func TestProxyRejectsLargeResponse(t *testing.T) {
+	handler := newTestGateway(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("a", 64)))
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/posts/1", nil))
+
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502, got %d", rec.Code)
+	}
+}
+
+func TestProxyReplacesUntrustedForwardedFor(t *testing.T) {
+	var forwardedFor, path, assertion string
+	handler := newTestGateway(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwardedFor = r.Header.Get("X-Forwarded-For")
+		path = r.URL.Path
+		assertion = r.Header.Get(identity.Header)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/posts/1", nil)
+	req.RemoteAddr = "203.0.113.7:4321"
+	req.Header.Set("X-Forwarded-For", "10.0.0.1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	if forwardedFor != "203.0.113.7" {
+		t.Errorf("Expected X-Forwarded-For 203.0.113.7, got %q", forwardedFor)
+	}
+	if path != "/api/posts/1" {
+		t.Errorf("Expected upstream path /api/posts/1, got %q", path)
+	}
+
+	claims := &identity.Claims{}
+	_, err := jwt.ParseWithClaims(assertion, claims, func(*jwt.Token) (interface{}, error) {
+		return []byte("test-internal-secret"), nil
+	}, jwt.WithAudience("post-service"), jwt.WithIssuer(identity.Issuer))
+	if err != nil {
+		t.Fatalf("Expected a valid identity assertion, got %v", err)
+	}
+	if claims.Subject != "" {
+		t.Errorf("Expected anonymous assertion, got subject %q", claims.Subject)
+	}
+}
+
+func TestProxyPropagatesTraceContext(t *testing.T) {
+	if _, err := tracing.Setup(context.Background(), "api-gateway", "", ""); err != nil {
+		t.Fatalf("Failed to set up tracing: %v", err)
+	}
+
+	var traceparent string
+	handler := newTestGateway(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/api/posts/1", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !strings.HasPrefix(traceparent, "00-"+traceID+"-") {
+		t.Errorf("Expected upstream traceparent in trace %s, got %q", traceID, traceparent)
+	}
+}
+
+func TestProxyRetriesIdempotentRequests(t *testing.T) {
+	var calls atomic.Int64
+	handler := newTestGatewayWith(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}), func(cfg *config.Config) {
+		cfg.Upstream.Retries = 2
+		cfg.Upstream.RetryBackoff = time.Millisecond
+	})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/posts/1", nil))
+	if rec.Code != http.StatusOK || calls.Load() != 3 {
+		t.Errorf("Expected 200 after two retries, got %d after %d calls", rec.Code, calls.Load())
+	}
+
+	// A POST may not be idempotent, so it is sent once.
+	calls.Store(0)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/posts/", strings.NewReader("{}")))
+	if rec.Code != http.StatusServiceUnavailable || calls.Load() != 1 {
+		t.Errorf("Expected the 503 without retries, got %d after %d calls", rec.Code, calls.Load())
+	}
+}
+
+func TestProxyRouteTimeout(t *testing.T) {
+	handler := newTestGatewayWith(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+	}), func(cfg *config.Config) {
+		cfg.Routes = []config.RouteConfig{
+			{Path: "/api/posts/fast/*", Service: "post-service", Timeout: 20 * time.Millisecond},
+			{Path: "/api/posts/*", Service: "post-service"},
+		}
+	})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/posts/fast/1", nil))
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("Expected 504 from the route's timeout, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/posts/1", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 within the default timeout, got %d", rec.Code)
+	}
+}
+
+// A half-open probe the client cancels must not hold the breaker's only
+// probe slot, or every later request is refused although the service has
+// recovered.
+func TestProxyCancelledProbeFreesBreaker(t *testing.T) {
+	handler := newTestGatewayWith(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/posts/fail":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/api/posts/slow":
+			<-r.Context().Done()
+		}
+	}), func(cfg *config.Config) {
+		cfg.Services[0].CircuitBreaker = &config.CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: 20 * time.Millisecond, HalfOpenRequests: 1}
+	})
+	get := func(ctx context.Context, path string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil).WithContext(ctx))
+		return rec.Code
+	}
+
+	if code := get(context.Background(), "/api/posts/fail"); code != http.StatusInternalServerError {
+		t.Fatalf("Expected 500, got %d", code)
+	}
+	if code := get(context.Background(), "/api/posts/1"); code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected the open breaker to refuse requests, got %d", code)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	get(ctx, "/api/posts/slow")
+
+	if code := get(context.Background(), "/api/posts/1"); code != http.StatusOK {
+		t.Errorf("Expected the next probe to reach the recovered service, got %d", code)
+	}
+	if code := get(context.Background(), "/api/posts/1"); code != http.StatusOK {
+		t.Errorf("Expected the breaker to close, got %d", code)
+	}
+}
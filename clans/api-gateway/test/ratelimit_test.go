@@ -0,0 +1,73 @@
+package gateway_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AlexGuo43/clans/api-gateway/config"
+	"github.com/AlexGuo43/clans/api-gateway/internal/middleware"
+	"github.com/AlexGuo43/clans/api-gateway/internal/ratelimit"
+)
+
+func TestMemoryStoreBurst(t *testing.T) {
+	store := ratelimit.NewMemoryStore()
+	limit := ratelimit.PerMinute(60, 3)
+
+	for i := 0; i < 3; i++ {
+		result, err := store.Take(context.Background(), "client", limit)
+		if err != nil {
+			t.Fatalf("Take failed: %v", err)
+		}
+		if !result.Allowed {
+			t.Fatalf("Request %d should be allowed", i+1)
+		}
+		if result.Remaining != 2-i {
+			t.Errorf("Request %d: got remaining %d, want %d", i+1, result.Remaining, 2-i)
+		}
+	}
+
+	result, _ := store.Take(context.Background(), "client", limit)
+	if result.Allowed {
+		t.Fatal("Request over burst should be rejected")
+	}
+	if result.RetryAfter <= 0 {
+		t.Errorf("Expected a positive retry delay, got %v", result.RetryAfter)
+	}
+
+	other, _ := store.Take(context.Background(), "other-client", limit)
+	if !other.Allowed {
+		t.Error("Buckets should be independent per key")
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	handler := middleware.RateLimitMiddleware(
+		ratelimit.NewMemoryStore(),
+		&config.RateLimitConfig{RequestsPerMinute: 1, Burst: 1},
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("GET", "/api/posts", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("First request: got %d, want 200", rec.Code)
+	}
+	if rec.Header().Get("X-RateLimit-Limit") != "1" {
+		t.Errorf("Unexpected X-RateLimit-Limit %q", rec.Header().Get("X-RateLimit-Limit"))
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Second request: got %d, want 429", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After header on 429")
+	}
+}
@@ -0,0 +1,85 @@
+package gateway_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AlexGuo43/clans/api-gateway/config"
+	"github.com/AlexGuo43/clans/api-gateway/internal/ratelimit"
+	"github.com/AlexGuo43/clans/api-gateway/internal/server"
+)
+
+func namedBackend(t *testing.T, name string) string {
+	t.Helper()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(name))
+	}))
+	t.Cleanup(backend.Close)
+	return backend.URL
+}
+
+func reloadConfig(postServiceURL string, routes ...config.RouteConfig) *config.Config {
+	return &config.Config{
+		InternalAuthSecret: "test-internal-secret",
+		Services: []config.ServiceConfig{{
+			Name:           "post-service",
+			URLs:           []string{postServiceURL},
+			CircuitBreaker: &config.CircuitBreakerConfig{FailureThreshold: 5, OpenTimeout: time.Minute, HalfOpenRequests: 1},
+		}},
+		Routes:      append([]config.RouteConfig{{Path: "/api/posts", Service: "post-service", Public: true}}, routes...),
+		Upstream:    config.UpstreamConfig{Timeout: time.Second},
+		HealthCheck: config.HealthCheckConfig{Path: "/readyz", Interval: time.Hour, Timeout: time.Second},
+	}
+}
+
+func getBody(t *testing.T, handler http.Handler, path string) string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec.Body.String()
+}
+
+func TestReloadSwapsUpstreams(t *testing.T) {
+	next := reloadConfig(namedBackend(t, "blue"))
+	reloader, err := server.NewReloader(func() (*config.Config, error) { return next, nil }, ratelimit.NewMemoryStore())
+	if err != nil {
+		t.Fatalf("Failed to create reloader: %v", err)
+	}
+
+	if body := getBody(t, reloader, "/api/posts"); body != "blue" {
+		t.Fatalf("Expected blue, got %q", body)
+	}
+
+	next = reloadConfig(namedBackend(t, "green"))
+	if err := reloader.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if body := getBody(t, reloader, "/api/posts"); body != "green" {
+		t.Errorf("Expected green after reload, got %q", body)
+	}
+}
+
+func TestReloadKeepsConfigWhenInvalid(t *testing.T) {
+	next := reloadConfig(namedBackend(t, "blue"))
+	reloader, err := server.NewReloader(func() (*config.Config, error) { return next, nil }, ratelimit.NewMemoryStore())
+	if err != nil {
+		t.Fatalf("Failed to create reloader: %v", err)
+	}
+	previous := reloader.Config()
+
+	next = reloadConfig(namedBackend(t, "green"), config.RouteConfig{Path: "/api/feed", View: "missing"})
+	if err := reloader.Reload(); err == nil {
+		t.Fatal("Expected a route to an unknown view to be rejected")
+	}
+
+	if reloader.Config() != previous {
+		t.Error("Expected the previous config to stay active")
+	}
+	if body := getBody(t, reloader, "/api/posts"); body != "blue" {
+		t.Errorf("Expected the previous upstream, got %q", body)
+	}
+}
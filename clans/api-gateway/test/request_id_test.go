@@ -0,0 +1,51 @@
+package gateway_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AlexGuo43/clans/api-gateway/internal/middleware"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var seen string
+	handler := middleware.RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Get(middleware.RequestIDHeader)
+		if id := middleware.RequestIDFromContext(r.Context()); id != seen {
+			t.Errorf("Context ID %q does not match header %q", id, seen)
+		}
+	}))
+
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{"generated when missing", "", false},
+		{"accepted when well formed", "abc-123_x.y", true},
+		{"replaced when malformed", "bad id\nwith newline", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/posts", nil)
+			if tt.incoming != "" {
+				req.Header.Set(middleware.RequestIDHeader, tt.incoming)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			returned := rec.Header().Get(middleware.RequestIDHeader)
+			if returned == "" || returned != seen {
+				t.Fatalf("Expected response ID to match forwarded ID, got %q and %q", returned, seen)
+			}
+			if tt.keep && returned != tt.incoming {
+				t.Errorf("Expected %q to be kept, got %q", tt.incoming, returned)
+			}
+			if !tt.keep && returned == tt.incoming {
+				t.Errorf("Expected %q to be replaced", tt.incoming)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package gateway_test
+
+import (
+	"testing"
+
+	"github.com/AlexGuo43/clans/api-gateway/config"
+	"github.com/AlexGuo43/clans/api-gateway/internal/routing"
+)
+
+func loadRoutes(t *testing.T) *routing.Table {
+	t.Setenv("GATEWAY_CONFIG", "../config/gateway.yaml")
+	t.Setenv("INTERNAL_AUTH_SECRET", "test-internal-secret")
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	table, err := routing.NewTable(cfg.Routes)
+	if err != nil {
+		t.Fatalf("Failed to build route table: %v", err)
+	}
+	return table
+}
+
+func TestRouteTable(t *testing.T) {
+	table := loadRoutes(t)
+
+	tests := []struct {
+		method  string
+		path    string
+		service string
+		target  string
+		public  bool
+	}{
+		{"POST", "/api/auth/login", "user-service", "/login", true},
+		{"POST", "/api/auth/signup", "user-service", "/signup", true},
+		{"POST", "/api/auth/verify-email", "user-service", "/verify-email", true},
+		{"POST", "/api/auth/verify-email/resend", "user-service", "/verify-email/resend", false},
+		{"POST", "/api/auth/forgot-password", "user-service", "/forgot-password", true},
+		{"POST", "/api/auth/reset-password", "user-service", "/reset-password", true},
+		{"GET", "/api/users/clans", "clan-service", "/api/users/clans", false},
+		{"PUT", "/api/users/me", "user-service", "/me", false},
+		{"PUT", "/api/users/me/password", "user-service", "/me/password", false},
+		{"GET", "/api/users/gopher/posts", "post-service", "/api/users/gopher/posts", true},
+		{"GET", "/api/users/gopher/comments", "comment-service", "/api/users/gopher/comments", true},
+		{"GET", "/api/posts", "post-service", "/api/posts", true},
+		{"GET", "/api/posts/12", "post-service", "/api/posts/12", true},
+		{"POST", "/api/posts/12/vote", "post-service", "/api/posts/12/vote", false},
+		{"GET", "/api/comments/post/3", "comment-service", "/api/comments/post/3", true},
+		{"GET", "/api/clans/4/membership", "clan-service", "/api/clans/4/membership", true},
+		{"GET", "/api/clans/4", "clan-service", "/api/clans/4", true},
+		{"DELETE", "/api/clans/4", "clan-service", "/api/clans/4", false},
+	}
+
+	for _, tt := range tests {
+		match := table.Match(tt.method, tt.path)
+		if match == nil {
+			t.Errorf("%s %s: no route matched", tt.method, tt.path)
+			continue
+		}
+		if match.Route.Service != tt.service {
+			t.Errorf("%s %s: got service %s, want %s", tt.method, tt.path, match.Route.Service, tt.service)
+		}
+		if target := match.Route.TargetPath(tt.path); target != tt.target {
+			t.Errorf("%s %s: got target %s, want %s", tt.method, tt.path, target, tt.target)
+		}
+		if match.Route.Public != tt.public {
+			t.Errorf("%s %s: got public %v, want %v", tt.method, tt.path, match.Route.Public, tt.public)
+		}
+	}
+
+	for _, path := range []string{"/api/posts", "/api/comments", "/api/clans"} {
+		if match := table.Match("POST", path); match == nil || !match.Route.VerifiedEmail {
+			t.Errorf("POST %s: expected a route that needs a verified email address", path)
+		}
+	}
+
+	if match := table.Match("GET", "/api/unknown"); match != nil {
+		t.Errorf("Expected no route for /api/unknown, got %s", match.Route.Path)
+	}
+}
+
+func TestRouteParams(t *testing.T) {
+	table, err := routing.NewTable([]config.RouteConfig{
+		{Path: "/api/clans/{id}/members/{user_id}", Service: "clan-service"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to build route table: %v", err)
+	}
+
+	match := table.Match("PUT", "/api/clans/7/members/9")
+	if match == nil {
+		t.Fatal("Expected route to match")
+	}
+	if match.Params["id"] != "7" || match.Params["user_id"] != "9" {
+		t.Errorf("Unexpected params: %v", match.Params)
+	}
+
+	if table.Match("PUT", "/api/clans/7/members") != nil {
+		t.Error("Expected route without wildcard not to match a shorter path")
+	}
+}
@@ -0,0 +1,138 @@
+package gateway_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexGuo43/clans/api-gateway/config"
+)
+
+func newEventsRequest() *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/api/posts/events", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	return req
+}
+
+func TestProxyStreamsEventsPastUpstreamTimeout(t *testing.T) {
+	handler := newTestGatewayWith(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 4; i++ {
+			fmt.Fprintf(w, "data: %d\n\n", i)
+			w.(http.Flusher).Flush()
+			time.Sleep(30 * time.Millisecond)
+		}
+	}), func(cfg *config.Config) {
+		cfg.Upstream.Timeout = 50 * time.Millisecond
+		cfg.Streaming.IdleTimeout = time.Second
+	})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newEventsRequest())
+
+	if rec.Code != http.StatusOK || strings.Count(rec.Body.String(), "data:") != 4 {
+		t.Errorf("Expected 4 events with 200, got %d: %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestProxyClosesIdleStreams(t *testing.T) {
+	handler := newTestGatewayWith(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: hello\n\n")
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}), func(cfg *config.Config) {
+		cfg.Streaming.IdleTimeout = 50 * time.Millisecond
+	})
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newEventsRequest())
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the idle stream to be closed, took %s", elapsed)
+	}
+	if !strings.Contains(rec.Body.String(), "data: hello") {
+		t.Errorf("Expected the first event, got %q", rec.Body.String())
+	}
+}
+
+func TestProxyLimitsStreamsPerClient(t *testing.T) {
+	opened := make(chan struct{})
+	done := make(chan struct{})
+	handler := newTestGatewayWith(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.(http.Flusher).Flush()
+		close(opened)
+		<-done
+	}), func(cfg *config.Config) {
+		cfg.Streaming.MaxConnectionsPerClient = 1
+	})
+
+	first := make(chan struct{})
+	go func() {
+		defer close(first)
+		handler.ServeHTTP(httptest.NewRecorder(), newEventsRequest())
+	}()
+	<-opened
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newEventsRequest())
+	close(done)
+	<-first
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 for a second stream, got %d", rec.Code)
+	}
+}
+
+func TestProxyUpgradesWebSockets(t *testing.T) {
+	handler := newTestGateway(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "websocket" || r.URL.Query().Has("access_token") {
+			http.Error(w, "bad handshake", http.StatusBadRequest)
+			return
+		}
+		conn, rw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		rw.Flush()
+		io.Copy(conn, rw)
+	}))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	fmt.Fprint(conn, "GET /api/posts/live?access_token=secret HTTP/1.1\r\nHost: gateway\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("Failed to read handshake: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected 101, got %d", resp.StatusCode)
+	}
+
+	fmt.Fprint(conn, "ping")
+	echo := make([]byte, 4)
+	if _, err := io.ReadFull(reader, echo); err != nil || string(echo) != "ping" {
+		t.Errorf("Expected the backend to echo ping, got %q (%v)", echo, err)
+	}
+}
@@ -0,0 +1,137 @@
+package gateway_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AlexGuo43/clans/api-gateway/config"
+	"github.com/AlexGuo43/clans/api-gateway/internal/ratelimit"
+	"github.com/AlexGuo43/clans/api-gateway/internal/server"
+)
+
+const versionedConfig = `
+services:
+  - name: post-service
+    url: %s
+api_versions:
+  default: v1
+  versions:
+    - name: v1
+      deprecated: 2026-01-01T00:00:00Z
+      sunset: 2026-07-01T00:00:00Z
+      link: https://example.com/v2-migration
+    - name: v2
+routes:
+  - path: /api/posts/clan/*
+    versions: [v1]
+    service: post-service
+    strip_prefix: /api/posts/clan
+    rewrite_prefix: /api/posts/legacy-clan
+    public: true
+  - path: /api/posts/*
+    service: post-service
+    public: true
+    transforms:
+      v2: post-v2
+`
+
+// newVersionedGateway loads versionedConfig, with a post service that
+// echoes the path it was called with in a post.
+func newVersionedGateway(t *testing.T) http.Handler {
+	t.Helper()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id": 7, "title": r.URL.Path, "user_id": 1, "username": "ann", "clan_id": 3, "clan_name": "gophers",
+		})
+	}))
+	t.Cleanup(backend.Close)
+
+	path := filepath.Join(t.TempDir(), "gateway.yaml")
+	if err := os.WriteFile(path, []byte(fmt.Sprintf(versionedConfig, backend.URL)), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	t.Setenv("GATEWAY_CONFIG", path)
+	t.Setenv("INTERNAL_AUTH_SECRET", "test-internal-secret")
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	srv, err := server.New(cfg, ratelimit.NewMemoryStore(), nil)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestVersionPrefixSelectsTransformer(t *testing.T) {
+	handler := newVersionedGateway(t)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v2/posts/7", nil))
+
+	var post struct {
+		Title  string
+		Author struct{ ID int }
+		Clan   struct{ Name string }
+		UserID *int `json:"user_id"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&post); err != nil {
+		t.Fatalf("Failed to decode post: %v", err)
+	}
+	if post.Title != "/api/posts/7" {
+		t.Errorf("Expected the version to be stripped upstream, got %q", post.Title)
+	}
+	if post.Author.ID != 1 || post.Clan.Name != "gophers" || post.UserID != nil {
+		t.Errorf("Expected a v2 post, got %+v", post)
+	}
+	if rec.Header().Get("API-Version") != "v2" || rec.Header().Get("Deprecation") != "" {
+		t.Errorf("Unexpected version headers: %v", rec.Header())
+	}
+}
+
+func TestDeprecatedVersionHeaders(t *testing.T) {
+	handler := newVersionedGateway(t)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/posts/clan/3", nil))
+
+	var post map[string]interface{}
+	json.NewDecoder(rec.Body).Decode(&post)
+	if post["title"] != "/api/posts/legacy-clan/3" || post["user_id"] == nil {
+		t.Errorf("Expected the untransformed v1-only route, got %v", post)
+	}
+	if got := rec.Header().Get("Deprecation"); got != "@1767225600" {
+		t.Errorf("Expected Deprecation @1767225600, got %q", got)
+	}
+	if got := rec.Header().Get("Sunset"); got != "Wed, 01 Jul 2026 00:00:00 GMT" {
+		t.Errorf("Unexpected Sunset %q", got)
+	}
+}
+
+func TestAcceptVersionHeader(t *testing.T) {
+	handler := newVersionedGateway(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/posts/clan/3", nil)
+	req.Header.Set("Accept-Version", "2")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Header().Get("API-Version") != "v2" || rec.Header().Get("Sunset") != "" {
+		t.Errorf("Expected v2 from Accept-Version, got %v", rec.Header())
+	}
+
+	req.Header.Set("Accept-Version", "v9")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown version, got %d", rec.Code)
+	}
+}
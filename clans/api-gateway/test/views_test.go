@@ -0,0 +1,152 @@
+package gateway_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AlexGuo43/clans/api-gateway/config"
+	"github.com/AlexGuo43/clans/api-gateway/internal/graph"
+	"github.com/AlexGuo43/clans/api-gateway/internal/middleware"
+	"github.com/AlexGuo43/clans/api-gateway/internal/proxy"
+	"github.com/AlexGuo43/clans/api-gateway/internal/routing"
+	"github.com/AlexGuo43/clans/api-gateway/internal/views"
+)
+
+func newViewGateway(t *testing.T, upstream http.Handler) http.Handler {
+	t.Helper()
+
+	backend := httptest.NewServer(upstream)
+	t.Cleanup(backend.Close)
+
+	cfg := &config.Config{
+		Routes: []config.RouteConfig{
+			{Path: "/api/views/post/{id}", Methods: []string{"GET"}, View: "post-page"},
+			{Path: "/graphql", Methods: []string{"POST"}, View: "graphql"},
+			{Path: "/api/users/{username}", Methods: []string{"GET"}, View: "user-profile"},
+		},
+		InternalAuthSecret: "test-internal-secret",
+		Upstream:           config.UpstreamConfig{Timeout: time.Second},
+	}
+	for _, name := range []string{"user-service", "post-service", "comment-service", "clan-service"} {
+		cfg.Services = append(cfg.Services, config.ServiceConfig{
+			Name:           name,
+			URLs:           []string{backend.URL},
+			CircuitBreaker: &config.CircuitBreakerConfig{FailureThreshold: 5, OpenTimeout: time.Minute, HalfOpenRequests: 1},
+		})
+	}
+
+	table, err := routing.NewTable(cfg.Routes)
+	if err != nil {
+		t.Fatalf("Failed to build route table: %v", err)
+	}
+	gateway, err := proxy.NewGateway(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	gateway.HandleView("post-page", views.NewPostPageHandler(gateway))
+	gateway.HandleView("graphql", graph.NewHandler(gateway, nil))
+	gateway.HandleView("user-profile", views.NewUserProfileHandler(gateway))
+	if err := gateway.CheckRoutes(); err != nil {
+		t.Fatalf("Unexpected view error: %v", err)
+	}
+
+	return middleware.RouteMiddleware(table)(http.HandlerFunc(gateway.RouteRequest))
+}
+
+func TestPostPageReturnsPartialResponse(t *testing.T) {
+	upstream := http.NewServeMux()
+	upstream.HandleFunc("/api/posts/7", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":7,"title":"Hello","clan_id":3}`))
+	})
+	upstream.HandleFunc("/api/comments/post/7", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	})
+	upstream.HandleFunc("/api/clans/3", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":3,"name":"gophers"}`))
+	})
+	handler := newViewGateway(t, upstream)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/views/post/7", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var page views.PostPage
+	if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+		t.Fatalf("Failed to decode view: %v", err)
+	}
+	if page.Post == nil || page.Clan == nil {
+		t.Errorf("Expected post and clan, got %s and %s", page.Post, page.Clan)
+	}
+	if string(page.Membership) != "null" {
+		t.Errorf("Expected no membership for an anonymous caller, got %s", page.Membership)
+	}
+	if len(page.Errors) != 1 || page.Errors[0].Source != "comments" || page.Errors[0].Status != http.StatusInternalServerError {
+		t.Errorf("Expected a single comments error, got %+v", page.Errors)
+	}
+}
+
+func TestPostPageMissingPost(t *testing.T) {
+	upstream := http.NewServeMux()
+	upstream.HandleFunc("/api/comments/post/7", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	})
+	handler := newViewGateway(t, upstream)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/views/post/7", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", rec.Code)
+	}
+}
+
+func TestUserProfileAddsActivity(t *testing.T) {
+	upstream := http.NewServeMux()
+	// The profile is asked for by ID; the counts are looked up by username.
+	upstream.HandleFunc("/profiles/42", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":42,"username":"gopher","email":"gopher@example.com","bio":"Digging"}`))
+	})
+	upstream.HandleFunc("/api/users/gopher/posts/stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"count":3,"karma":10}`))
+	})
+	upstream.HandleFunc("/api/users/gopher/comments/stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"count":5,"karma":-2}`))
+	})
+	handler := newViewGateway(t, upstream)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/users/42", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var profile map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&profile); err != nil {
+		t.Fatalf("Failed to decode view: %v", err)
+	}
+	if profile["username"] != "gopher" || profile["bio"] != "Digging" {
+		t.Errorf("Expected the user's profile, got %v", profile)
+	}
+	if _, ok := profile["email"]; ok {
+		t.Error("Expected the public profile to leave out the email address")
+	}
+	if profile["post_count"] != 3.0 || profile["comment_count"] != 5.0 || profile["karma"] != 8.0 {
+		t.Errorf("Expected 3 posts, 5 comments and karma 8, got %v", profile)
+	}
+}
+
+func TestUserProfileMissingUser(t *testing.T) {
+	handler := newViewGateway(t, http.NotFoundHandler())
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/users/nobody", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", rec.Code)
+	}
+}
@@ -10,6 +10,15 @@ import (
 type Config struct {
 	Database DatabaseConfig
 	Server   ServerConfig
+	LogLevel string
+	Tracing  TracingConfig
+	// InternalAuthSecret verifies identity assertions from the gateway.
+	InternalAuthSecret string
+}
+
+type TracingConfig struct {
+	Exporter string
+	File     string
 }
 
 type DatabaseConfig struct {
@@ -41,6 +50,12 @@ func LoadConfig() *Config {
 		Server: ServerConfig{
 			Port: getEnv("PORT", "8083"),
 		},
+		LogLevel:           getEnv("LOG_LEVEL", "info"),
+		InternalAuthSecret: os.Getenv("INTERNAL_AUTH_SECRET"),
+		Tracing: TracingConfig{
+			Exporter: os.Getenv("TRACE_EXPORTER"),
+			File:     getEnv("TRACE_FILE", "traces.json"),
+		},
 	}
 }
 
@@ -49,4 +64,4 @@ func getEnv(key, defaultValue string) string {
 		return value
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/AlexGuo43/clans/clan-service/internal/etag"
 	"github.com/AlexGuo43/clans/clan-service/internal/models"
 	"github.com/AlexGuo43/clans/clan-service/internal/services"
 	"github.com/gorilla/mux"
@@ -58,8 +59,7 @@ func (h *ClanHandler) GetClan(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(clan)
+	etag.WriteJSON(w, r, clan)
 }
 
 func (h *ClanHandler) GetClanByName(w http.ResponseWriter, r *http.Request) {
@@ -72,8 +72,7 @@ func (h *ClanHandler) GetClanByName(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(clan)
+	etag.WriteJSON(w, r, clan)
 }
 
 func (h *ClanHandler) GetClans(w http.ResponseWriter, r *http.Request) {
@@ -86,8 +85,7 @@ func (h *ClanHandler) GetClans(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(clans)
+	etag.WriteJSON(w, r, clans)
 }
 
 func (h *ClanHandler) UpdateClan(w http.ResponseWriter, r *http.Request) {
@@ -261,14 +259,15 @@ func (h *ClanHandler) GetUserClans(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(clans)
+	etag.WriteJSON(w, r, clans)
 }
 
+// GetMembership returns the caller's membership of a clan. Anonymous
+// callers are not a member of any clan.
 func (h *ClanHandler) GetMembership(w http.ResponseWriter, r *http.Request) {
 	userID := getUserIDFromHeader(r)
 	if userID == 0 {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		http.Error(w, "Not a member", http.StatusNotFound)
 		return
 	}
 
@@ -299,4 +298,5 @@ func getUserIDFromHeader(r *http.Request) int {
 		return 0
 	}
 	return userID
-}
\ No newline at end of file
+}
+
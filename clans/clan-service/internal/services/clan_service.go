@@ -5,10 +5,14 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/AlexGuo43/clans/clan-service/internal/metrics"
 	"github.com/AlexGuo43/clans/clan-service/internal/models"
 	"github.com/AlexGuo43/clans/clan-service/internal/repository"
+	"go.opentelemetry.io/otel"
 )
 
+var tracer = otel.Tracer("github.com/AlexGuo43/clans/clan-service/internal/services")
+
 type ClanService struct {
 	clanRepo *repository.ClanRepository
 }
@@ -20,6 +24,9 @@ func NewClanService(clanRepo *repository.ClanRepository) *ClanService {
 }
 
 func (s *ClanService) CreateClan(ctx context.Context, req *models.ClanRequest, userID int) (*models.Clan, error) {
+	ctx, span := tracer.Start(ctx, "ClanService.CreateClan")
+	defer span.End()
+
 	req.Name = strings.ToLower(strings.TrimSpace(req.Name))
 	req.DisplayName = strings.TrimSpace(req.DisplayName)
 	req.Description = strings.TrimSpace(req.Description)
@@ -49,18 +56,33 @@ func (s *ClanService) CreateClan(ctx context.Context, req *models.ClanRequest, u
 		return nil, fmt.Errorf("clan name already exists")
 	}
 
-	return s.clanRepo.Create(ctx, req, userID)
+	clan, err := s.clanRepo.Create(ctx, req, userID)
+	if err != nil {
+		return nil, err
+	}
+	metrics.ClansCreated.Inc()
+
+	return clan, nil
 }
 
 func (s *ClanService) GetClan(ctx context.Context, id int) (*models.Clan, error) {
+	ctx, span := tracer.Start(ctx, "ClanService.GetClan")
+	defer span.End()
+
 	return s.clanRepo.GetByID(ctx, id)
 }
 
 func (s *ClanService) GetClanByName(ctx context.Context, name string) (*models.Clan, error) {
+	ctx, span := tracer.Start(ctx, "ClanService.GetClanByName")
+	defer span.End()
+
 	return s.clanRepo.GetByName(ctx, name)
 }
 
 func (s *ClanService) GetClans(ctx context.Context, limit, offset int) ([]models.Clan, error) {
+	ctx, span := tracer.Start(ctx, "ClanService.GetClans")
+	defer span.End()
+
 	if limit <= 0 || limit > 100 {
 		limit = 20
 	}
@@ -72,6 +94,9 @@ func (s *ClanService) GetClans(ctx context.Context, limit, offset int) ([]models
 }
 
 func (s *ClanService) UpdateClan(ctx context.Context, id int, req *models.ClanRequest, userID int) (*models.Clan, error) {
+	ctx, span := tracer.Start(ctx, "ClanService.UpdateClan")
+	defer span.End()
+
 	clan, err := s.clanRepo.GetByID(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("clan not found")
@@ -101,6 +126,9 @@ func (s *ClanService) UpdateClan(ctx context.Context, id int, req *models.ClanRe
 }
 
 func (s *ClanService) DeleteClan(ctx context.Context, id, userID int) error {
+	ctx, span := tracer.Start(ctx, "ClanService.DeleteClan")
+	defer span.End()
+
 	clan, err := s.clanRepo.GetByID(ctx, id)
 	if err != nil {
 		return fmt.Errorf("clan not found")
@@ -114,6 +142,9 @@ func (s *ClanService) DeleteClan(ctx context.Context, id, userID int) error {
 }
 
 func (s *ClanService) JoinClan(ctx context.Context, clanID, userID int) error {
+	ctx, span := tracer.Start(ctx, "ClanService.JoinClan")
+	defer span.End()
+
 	clan, err := s.clanRepo.GetByID(ctx, clanID)
 	if err != nil {
 		return fmt.Errorf("clan not found")
@@ -128,10 +159,18 @@ func (s *ClanService) JoinClan(ctx context.Context, clanID, userID int) error {
 		return fmt.Errorf("already a member of this clan")
 	}
 
-	return s.clanRepo.JoinClan(ctx, clanID, userID)
+	if err := s.clanRepo.JoinClan(ctx, clanID, userID); err != nil {
+		return err
+	}
+	metrics.ClansJoined.Inc()
+
+	return nil
 }
 
 func (s *ClanService) LeaveClan(ctx context.Context, clanID, userID int) error {
+	ctx, span := tracer.Start(ctx, "ClanService.LeaveClan")
+	defer span.End()
+
 	clan, err := s.clanRepo.GetByID(ctx, clanID)
 	if err != nil {
 		return fmt.Errorf("clan not found")
@@ -150,10 +189,18 @@ func (s *ClanService) LeaveClan(ctx context.Context, clanID, userID int) error {
 		return fmt.Errorf("not a member of this clan")
 	}
 
-	return s.clanRepo.LeaveClan(ctx, clanID, userID)
+	if err := s.clanRepo.LeaveClan(ctx, clanID, userID); err != nil {
+		return err
+	}
+	metrics.ClansLeft.Inc()
+
+	return nil
 }
 
 func (s *ClanService) GetMembers(ctx context.Context, clanID int, limit, offset int) ([]models.ClanMembership, error) {
+	ctx, span := tracer.Start(ctx, "ClanService.GetMembers")
+	defer span.End()
+
 	if limit <= 0 || limit > 100 {
 		limit = 20
 	}
@@ -170,6 +217,9 @@ func (s *ClanService) GetMembers(ctx context.Context, clanID int, limit, offset
 }
 
 func (s *ClanService) UpdateMemberRole(ctx context.Context, clanID, targetUserID, userID int, role models.ClanMembershipRole) error {
+	ctx, span := tracer.Start(ctx, "ClanService.UpdateMemberRole")
+	defer span.End()
+
 	clan, err := s.clanRepo.GetByID(ctx, clanID)
 	if err != nil {
 		return fmt.Errorf("clan not found")
@@ -206,10 +256,16 @@ func (s *ClanService) UpdateMemberRole(ctx context.Context, clanID, targetUserID
 }
 
 func (s *ClanService) GetUserClans(ctx context.Context, userID int) ([]models.Clan, error) {
+	ctx, span := tracer.Start(ctx, "ClanService.GetUserClans")
+	defer span.End()
+
 	return s.clanRepo.GetUserClans(ctx, userID)
 }
 
 func (s *ClanService) GetMembership(ctx context.Context, clanID, userID int) (*models.ClanMembership, error) {
+	ctx, span := tracer.Start(ctx, "ClanService.GetMembership")
+	defer span.End()
+
 	return s.clanRepo.GetMembership(ctx, clanID, userID)
 }
 
@@ -4,23 +4,46 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 
 	"github.com/AlexGuo43/clans/clan-service/internal/config"
 	"github.com/AlexGuo43/clans/clan-service/internal/handlers"
+	"github.com/AlexGuo43/clans/clan-service/internal/health"
+	"github.com/AlexGuo43/clans/clan-service/internal/metrics"
+	"github.com/AlexGuo43/clans/clan-service/internal/middleware"
 	"github.com/AlexGuo43/clans/clan-service/internal/repository"
 	"github.com/AlexGuo43/clans/clan-service/internal/services"
+	"github.com/AlexGuo43/clans/clan-service/internal/tracing"
 	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5/multitracer"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
 	cfg := config.LoadConfig()
+	slog.SetDefault(middleware.NewLogger(cfg.LogLevel))
+	if cfg.InternalAuthSecret == "" {
+		log.Fatal("INTERNAL_AUTH_SECRET is required")
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), "clan-service", cfg.Tracing.Exporter, cfg.Tracing.File)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
 
 	dbURL := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
 		cfg.Database.User, cfg.Database.Password, cfg.Database.Host, cfg.Database.Port, cfg.Database.DBName)
 
-	db, err := pgxpool.New(context.Background(), dbURL)
+	poolConfig, err := pgxpool.ParseConfig(dbURL)
+	if err != nil {
+		log.Fatal("Invalid database configuration:", err)
+	}
+	poolConfig.ConnConfig.Tracer = multitracer.New(metrics.QueryTracer{}, tracing.QueryTracer{})
+
+	db, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
@@ -38,11 +61,16 @@ func main() {
 	clanHandler := handlers.NewClanHandler(clanService)
 
 	r := mux.NewRouter()
+	r.Use(middleware.RequestIDMiddleware)
+	r.Use(middleware.TracingMiddleware)
+	r.Use(middleware.LoggingMiddleware)
+	r.Use(middleware.MetricsMiddleware)
+	r.Use(middleware.IdentityMiddleware(cfg.InternalAuthSecret, "clan-service"))
 
-	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	}).Methods("GET")
+	r.HandleFunc("/livez", health.Livez).Methods("GET")
+	r.HandleFunc("/readyz", health.Readyz(db)).Methods("GET")
+	r.HandleFunc("/health", health.Readyz(db)).Methods("GET")
+	r.Handle("/metrics", promhttp.Handler()).Methods("GET")
 
 	api := r.PathPrefix("/api").Subrouter()
 
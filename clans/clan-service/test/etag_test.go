@@ -0,0 +1,42 @@
+package clanservice_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AlexGuo43/clans/clan-service/internal/etag"
+	"github.com/AlexGuo43/clans/clan-service/internal/models"
+)
+
+func getJSON(v interface{}, ifNoneMatch string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	rec := httptest.NewRecorder()
+	etag.WriteJSON(rec, req, v)
+	return rec
+}
+
+func TestETagFollowsJoinedFields(t *testing.T) {
+	updated := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	v := []models.Clan{{ID: 1, Name: "gophers", OwnerName: "ann", UpdatedAt: updated}}
+
+	first := getJSON(v, "")
+	tag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || tag == "" {
+		t.Fatalf("Expected 200 with an ETag, got %d %q", first.Code, tag)
+	}
+	if rec := getJSON(v, `W/`+tag); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("Expected 304 for the current tag, got %d", rec.Code)
+	}
+
+	// The owner's username is joined from another table, so it changes without the clan's updated_at.
+	v[0].OwnerName = "annie"
+	rec := getJSON(v, tag)
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") == tag {
+		t.Errorf("Expected a new tag and body after a rename, got %d %q", rec.Code, rec.Header().Get("ETag"))
+	}
+}
@@ -0,0 +1,88 @@
+package clanservice_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AlexGuo43/clans/clan-service/internal/middleware"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const identitySecret = "test-internal-secret"
+
+func assertion(t *testing.T, audience, userID string, expiresAt time.Time) string {
+	t.Helper()
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, middleware.IdentityClaims{
+		Roles: []string{"user"},
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "api-gateway",
+			Subject:   userID,
+			Audience:  jwt.ClaimStrings{audience},
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}).SignedString([]byte(identitySecret))
+	if err != nil {
+		t.Fatalf("Failed to sign assertion: %v", err)
+	}
+	return signed
+}
+
+// identityServer records the X-User-ID each request reaches the handler with.
+func identityServer(userID *string) http.Handler {
+	return middleware.IdentityMiddleware(identitySecret, "clan-service")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*userID = r.Header.Get("X-User-ID")
+	}))
+}
+
+func TestIdentityMiddlewareTrustsOnlyTheAssertion(t *testing.T) {
+	var userID string
+	srv := identityServer(&userID)
+	valid := time.Now().Add(time.Minute)
+
+	tests := []struct {
+		name      string
+		assertion string
+		code      int
+		userID    string
+	}{
+		{"no assertion", "", http.StatusUnauthorized, ""},
+		{"signed-in user", assertion(t, "clan-service", "7", valid), http.StatusOK, "7"},
+		{"anonymous", assertion(t, "clan-service", "", valid), http.StatusOK, ""},
+		{"other service", assertion(t, "post-service", "7", valid), http.StatusUnauthorized, ""},
+		{"expired", assertion(t, "clan-service", "7", time.Now().Add(-time.Hour)), http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		userID = ""
+		req := httptest.NewRequest(http.MethodGet, "/api/anything", nil)
+		// A client-supplied user ID must never get through.
+		req.Header.Set("X-User-ID", "1")
+		if tt.assertion != "" {
+			req.Header.Set(middleware.IdentityHeader, tt.assertion)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+
+		if rec.Code != tt.code {
+			t.Errorf("%s: got status %d, want %d", tt.name, rec.Code, tt.code)
+		}
+		if userID != tt.userID {
+			t.Errorf("%s: handler saw X-User-ID %q, want %q", tt.name, userID, tt.userID)
+		}
+	}
+}
+
+func TestIdentityMiddlewareExemptsProbes(t *testing.T) {
+	var userID string
+	srv := identityServer(&userID)
+
+	for _, path := range []string{"/livez", "/readyz", "/health", "/metrics"} {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: got status %d without an assertion, want 200", path, rec.Code)
+		}
+	}
+}
@@ -3,30 +3,51 @@ package main
 import (
 	"context"
 	"log"
+	"log/slog"
 	"net/http"
 
 	"github.com/AlexGuo43/clans/comment-service/config"
 	"github.com/AlexGuo43/clans/comment-service/internal/handlers"
+	"github.com/AlexGuo43/clans/comment-service/internal/health"
+	"github.com/AlexGuo43/clans/comment-service/internal/middleware"
 	"github.com/AlexGuo43/clans/comment-service/internal/repository"
 	"github.com/AlexGuo43/clans/comment-service/internal/services"
+	"github.com/AlexGuo43/clans/comment-service/internal/tracing"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
 	cfg := config.LoadConfig()
+	slog.SetDefault(middleware.NewLogger(cfg.LogLevel))
+	if cfg.InternalAuthSecret == "" {
+		log.Fatal("INTERNAL_AUTH_SECRET is required")
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), "comment-service", cfg.TraceExporter, cfg.TraceFile)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	db := repository.ConnectDB(cfg)
-	defer db.Close(context.Background())
+	defer db.Close()
 
 	commentRepo := repository.NewCommentRepository(db)
 	commentService := services.NewCommentService(commentRepo)
 	commentHandler := handlers.NewCommentHandler(commentService)
 
 	r := mux.NewRouter()
+	r.Use(middleware.RequestIDMiddleware)
+	r.Use(middleware.TracingMiddleware)
+	r.Use(middleware.LoggingMiddleware)
+	r.Use(middleware.MetricsMiddleware)
+	r.Use(middleware.IdentityMiddleware(cfg.InternalAuthSecret, "comment-service"))
 
-	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{"status":"healthy"}`))
-	}).Methods("GET")
+	r.HandleFunc("/livez", health.Livez).Methods("GET")
+	r.HandleFunc("/readyz", health.Readyz(db)).Methods("GET")
+	r.HandleFunc("/health", health.Readyz(db)).Methods("GET")
+	r.Handle("/metrics", promhttp.Handler()).Methods("GET")
 
 	api := r.PathPrefix("/api/comments").Subrouter()
 	
@@ -38,6 +59,11 @@ func main() {
 	api.HandleFunc("/{id:[0-9]+}/replies", commentHandler.GetReplies).Methods("GET")
 	api.HandleFunc("/post/{post_id:[0-9]+}", commentHandler.GetCommentsByPost).Methods("GET")
 
+	// A user's comments, for their profile.
+	users := r.PathPrefix("/api/users/{username}/comments").Subrouter()
+	users.HandleFunc("", commentHandler.GetCommentsByUser).Methods("GET")
+	users.HandleFunc("/stats", commentHandler.GetAuthorStats).Methods("GET")
+
 	log.Println("Comment Service running on port 8082...")
 	log.Fatal(http.ListenAndServe(":8082", r))
 }
\ No newline at end of file
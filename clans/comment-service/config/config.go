@@ -8,12 +8,16 @@ import (
 )
 
 type Config struct {
-	DBHost     string
-	DBPort     string
-	DBUser     string
-	DBPassword string
-	DBName     string
-	JWTSecret  string
+	DBHost        string
+	DBPort        string
+	DBUser        string
+	DBPassword    string
+	DBName        string
+	LogLevel      string
+	TraceExporter string
+	TraceFile     string
+	// InternalAuthSecret verifies identity assertions from the gateway.
+	InternalAuthSecret string
 }
 
 func LoadConfig() *Config {
@@ -22,11 +26,14 @@ func LoadConfig() *Config {
 	}
 
 	return &Config{
-		DBHost:     os.Getenv("DB_HOST"),
-		DBPort:     os.Getenv("DB_PORT"),
-		DBUser:     os.Getenv("DB_USER"),
-		DBPassword: os.Getenv("DB_PASSWORD"),
-		DBName:     os.Getenv("DB_NAME"),
-		JWTSecret:  os.Getenv("JWT_SECRET"),
+		DBHost:             os.Getenv("DB_HOST"),
+		DBPort:             os.Getenv("DB_PORT"),
+		DBUser:             os.Getenv("DB_USER"),
+		DBPassword:         os.Getenv("DB_PASSWORD"),
+		DBName:             os.Getenv("DB_NAME"),
+		LogLevel:           os.Getenv("LOG_LEVEL"),
+		TraceExporter:      os.Getenv("TRACE_EXPORTER"),
+		TraceFile:          os.Getenv("TRACE_FILE"),
+		InternalAuthSecret: os.Getenv("INTERNAL_AUTH_SECRET"),
 	}
-}
\ No newline at end of file
+}
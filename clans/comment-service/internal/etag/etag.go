@@ -0,0 +1,61 @@
+package etag
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// WriteJSON answers with v encoded as JSON, tagged with a hash of the
+// encoded body, or with 304 Not Modified when If-None-Match shows the client
+// already has it. Hashing the body means every change to the response,
+// including names joined from other tables, changes the tag.
+func WriteJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	body = append(body, '\n')
+
+	if NotModified(w, r, New(body)) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// New returns a strong entity tag for body.
+func New(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// NotModified sets the ETag of the response to tag and, when If-None-Match
+// shows the client already has it, answers 304 Not Modified and returns
+// true.
+func NotModified(w http.ResponseWriter, r *http.Request, tag string) bool {
+	w.Header().Set("ETag", tag)
+	if !matches(r.Header.Get("If-None-Match"), tag) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// matches compares tags the weak way, as RFC 9110 requires for
+// If-None-Match, so a copy compressed by the gateway (whose tag it marks as
+// weak) still matches.
+func matches(header, tag string) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/AlexGuo43/clans/comment-service/internal/etag"
 	"github.com/AlexGuo43/clans/comment-service/internal/models"
 	"github.com/AlexGuo43/clans/comment-service/internal/services"
 	"github.com/gorilla/mux"
@@ -33,7 +34,7 @@ func (h *CommentHandler) CreateComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	comment, err := h.CommentService.CreateComment(req.Content, req.PostID, userID, req.ParentID)
+	comment, err := h.CommentService.CreateComment(r.Context(), req.Content, req.PostID, userID, req.ParentID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -52,14 +53,13 @@ func (h *CommentHandler) GetComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	comment, err := h.CommentService.GetComment(id)
+	comment, err := h.CommentService.GetComment(r.Context(), id)
 	if err != nil {
 		http.Error(w, "Comment not found", http.StatusNotFound)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(comment)
+	etag.WriteJSON(w, r, comment)
 }
 
 func (h *CommentHandler) GetCommentsByPost(w http.ResponseWriter, r *http.Request) {
@@ -85,14 +85,13 @@ func (h *CommentHandler) GetCommentsByPost(w http.ResponseWriter, r *http.Reques
 		}
 	}
 
-	comments, err := h.CommentService.GetCommentsByPost(postID, page, limit)
+	comments, err := h.CommentService.GetCommentsByPost(r.Context(), postID, page, limit)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(comments)
+	etag.WriteJSON(w, r, comments)
 }
 
 func (h *CommentHandler) GetReplies(w http.ResponseWriter, r *http.Request) {
@@ -118,14 +117,55 @@ func (h *CommentHandler) GetReplies(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	replies, err := h.CommentService.GetReplies(parentID, page, limit)
+	replies, err := h.CommentService.GetReplies(r.Context(), parentID, page, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	etag.WriteJSON(w, r, replies)
+}
+
+// GetCommentsByUser lists the comments of the user named in the path.
+// Unknown users have no comments.
+func (h *CommentHandler) GetCommentsByUser(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+
+	page := 1
+	limit := 10
+
+	if p := r.URL.Query().Get("page"); p != "" {
+		if parsed, err := strconv.Atoi(p); err == nil {
+			page = parsed
+		}
+	}
+
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil {
+			limit = parsed
+		}
+	}
+
+	comments, err := h.CommentService.GetCommentsByUsername(r.Context(), username, page, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	etag.WriteJSON(w, r, comments)
+}
+
+// GetAuthorStats counts the comments of the user named in the path and
+// their karma, for the gateway's profile view.
+func (h *CommentHandler) GetAuthorStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.CommentService.GetAuthorStats(r.Context(), mux.Vars(r)["username"])
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(replies)
+	json.NewEncoder(w).Encode(stats)
 }
 
 func (h *CommentHandler) UpdateComment(w http.ResponseWriter, r *http.Request) {
@@ -152,7 +192,7 @@ func (h *CommentHandler) UpdateComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.CommentService.UpdateComment(id, req.Content, userID)
+	err = h.CommentService.UpdateComment(r.Context(), id, req.Content, userID)
 	if err != nil {
 		if err.Error() == "unauthorized: can only edit your own comments" {
 			http.Error(w, err.Error(), http.StatusForbidden)
@@ -181,7 +221,7 @@ func (h *CommentHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.CommentService.DeleteComment(id, userID)
+	err = h.CommentService.DeleteComment(r.Context(), id, userID)
 	if err != nil {
 		if err.Error() == "unauthorized: can only delete your own comments" {
 			http.Error(w, err.Error(), http.StatusForbidden)
@@ -220,9 +260,9 @@ func (h *CommentHandler) VoteComment(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if req.IsUpvote == nil {
-		err = h.CommentService.RemoveVote(userID, commentID)
+		err = h.CommentService.RemoveVote(r.Context(), userID, commentID)
 	} else {
-		err = h.CommentService.VoteComment(userID, commentID, *req.IsUpvote)
+		err = h.CommentService.VoteComment(r.Context(), userID, commentID, *req.IsUpvote)
 	}
 
 	if err != nil {
@@ -232,4 +272,5 @@ func (h *CommentHandler) VoteComment(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Vote updated successfully"})
-}
\ No newline at end of file
+}
+
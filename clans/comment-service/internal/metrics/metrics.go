@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by route and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "db_query_duration_seconds",
+		Help:    "Database query latency by statement kind and table.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"query"})
+)
+
+var (
+	CommentsCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "comments_created_total",
+		Help: "Comments created, including replies.",
+	})
+
+	CommentVotes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "comment_votes_total",
+		Help: "Votes cast on comments by direction.",
+	}, []string{"direction"})
+)
+
+// QueryTracer is a pgx tracer that records every query in
+// db_query_duration_seconds.
+type QueryTracer struct{}
+
+type queryStartKey struct{}
+
+type queryStart struct {
+	name  string
+	start time.Time
+}
+
+func (QueryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, queryStartKey{}, queryStart{name: QueryName(data.SQL), start: time.Now()})
+}
+
+func (QueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryEndData) {
+	if q, ok := ctx.Value(queryStartKey{}).(queryStart); ok {
+		DBQueryDuration.WithLabelValues(q.name).Observe(time.Since(q.start).Seconds())
+	}
+}
+
+// QueryName reduces a SQL statement to a low-cardinality label such as
+// "select posts" or "insert post_votes".
+func QueryName(sql string) string {
+	fields := strings.Fields(strings.ToLower(sql))
+	if len(fields) == 0 {
+		return "unknown"
+	}
+
+	verb := fields[0]
+	keyword := map[string]string{
+		"select": "from",
+		"insert": "into",
+		"update": "update",
+		"delete": "from",
+	}[verb]
+	if keyword == "" {
+		return verb
+	}
+
+	for i := 0; i < len(fields)-1; i++ {
+		if fields[i] == keyword {
+			if table := strings.Trim(fields[i+1], "(),;"); table != "" {
+				return verb + " " + table
+			}
+		}
+	}
+	return verb
+}
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// IdentityHeader carries the identity assertion signed by the API gateway.
+const IdentityHeader = "X-Internal-Identity"
+
+const identityKey contextKey = "identity"
+
+// IdentityClaims is the identity the gateway asserts for a request. Subject
+// is the user ID and is empty for anonymous requests.
+type IdentityClaims struct {
+	Roles     []string `json:"roles,omitempty"`
+	RequestID string   `json:"rid,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func IdentityFromContext(ctx context.Context) (*IdentityClaims, bool) {
+	claims, ok := ctx.Value(identityKey).(*IdentityClaims)
+	return claims, ok
+}
+
+// IdentityMiddleware rejects requests without a valid assertion from the
+// gateway for this service (audience). X-User-ID and X-User-Roles are then
+// rebuilt from the assertion, so handlers never see client-supplied values.
+// Health probes and /metrics stay open for probes and scrapers.
+func IdentityMiddleware(secret, audience string) func(http.Handler) http.Handler {
+	key := []byte(secret)
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer("api-gateway"),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30*time.Second),
+	)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isHealthProbe(r.URL.Path) || r.URL.Path == "/metrics" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			r.Header.Del("X-User-ID")
+			r.Header.Del("X-User-Roles")
+
+			assertion := r.Header.Get(IdentityHeader)
+			if assertion == "" {
+				http.Error(w, "Missing internal identity", http.StatusUnauthorized)
+				return
+			}
+
+			claims := &IdentityClaims{}
+			if _, err := parser.ParseWithClaims(assertion, claims, func(*jwt.Token) (interface{}, error) {
+				return key, nil
+			}); err != nil {
+				http.Error(w, "Invalid internal identity", http.StatusUnauthorized)
+				return
+			}
+
+			if claims.Subject != "" {
+				r.Header.Set("X-User-ID", claims.Subject)
+			}
+			if len(claims.Roles) > 0 {
+				r.Header.Set("X-User-Roles", strings.Join(claims.Roles, ","))
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey, claims)))
+		})
+	}
+}
@@ -33,4 +33,11 @@ type CommentRequest struct {
 type CommentTree struct {
 	Comment Comment   `json:"comment"`
 	Replies []Comment `json:"replies"`
-}
\ No newline at end of file
+}
+
+// AuthorStats sums up a user's comments for their profile. Karma is the net
+// vote count of the comments.
+type AuthorStats struct {
+	Count int `json:"count"`
+	Karma int `json:"karma"`
+}
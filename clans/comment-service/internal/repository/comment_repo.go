@@ -4,18 +4,18 @@ import (
 	"context"
 
 	"github.com/AlexGuo43/clans/comment-service/internal/models"
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type CommentRepository struct {
-	db *pgx.Conn
+	db *pgxpool.Pool
 }
 
-func NewCommentRepository(db *pgx.Conn) *CommentRepository {
+func NewCommentRepository(db *pgxpool.Pool) *CommentRepository {
 	return &CommentRepository{db: db}
 }
 
-func (r *CommentRepository) CreateComment(comment *models.Comment) error {
+func (r *CommentRepository) CreateComment(ctx context.Context, comment *models.Comment) error {
 	query := `
 		INSERT INTO comments (content, post_id, user_id, parent_id, depth, created_at, updated_at) 
 		VALUES ($1, $2, $3, $4, $5, NOW(), NOW()) 
@@ -26,21 +26,21 @@ func (r *CommentRepository) CreateComment(comment *models.Comment) error {
 		// Calculate depth based on parent
 		depthQuery := `SELECT depth FROM comments WHERE id = $1`
 		var parentDepth int
-		err := r.db.QueryRow(context.Background(), depthQuery, *comment.ParentID).Scan(&parentDepth)
+		err := r.db.QueryRow(ctx, depthQuery, *comment.ParentID).Scan(&parentDepth)
 		if err != nil {
 			return err
 		}
 		depth = parentDepth + 1
 	}
 
-	err := r.db.QueryRow(context.Background(), query, 
+	err := r.db.QueryRow(ctx, query, 
 		comment.Content, comment.PostID, comment.UserID, comment.ParentID, depth).
 		Scan(&comment.ID, &comment.CreatedAt, &comment.UpdatedAt)
 	
 	return err
 }
 
-func (r *CommentRepository) GetCommentByID(id int) (*models.Comment, error) {
+func (r *CommentRepository) GetCommentByID(ctx context.Context, id int) (*models.Comment, error) {
 	query := `
 		SELECT c.id, c.content, c.post_id, c.user_id, u.username, c.parent_id, c.depth,
 			   COALESCE(SUM(CASE WHEN cv.is_upvote THEN 1 ELSE -1 END), 0) as vote_count,
@@ -53,7 +53,7 @@ func (r *CommentRepository) GetCommentByID(id int) (*models.Comment, error) {
 		GROUP BY c.id, u.username`
 
 	comment := &models.Comment{}
-	err := r.db.QueryRow(context.Background(), query, id).Scan(
+	err := r.db.QueryRow(ctx, query, id).Scan(
 		&comment.ID, &comment.Content, &comment.PostID, &comment.UserID, &comment.Username,
 		&comment.ParentID, &comment.Depth, &comment.VoteCount, &comment.ReplyCount,
 		&comment.CreatedAt, &comment.UpdatedAt)
@@ -65,7 +65,7 @@ func (r *CommentRepository) GetCommentByID(id int) (*models.Comment, error) {
 	return comment, nil
 }
 
-func (r *CommentRepository) GetCommentsByPost(postID int, limit, offset int) ([]*models.Comment, error) {
+func (r *CommentRepository) GetCommentsByPost(ctx context.Context, postID int, limit, offset int) ([]*models.Comment, error) {
 	query := `
 		SELECT c.id, c.content, c.post_id, c.user_id, u.username, c.parent_id, c.depth,
 			   COALESCE(SUM(CASE WHEN cv.is_upvote THEN 1 ELSE -1 END), 0) as vote_count,
@@ -79,7 +79,7 @@ func (r *CommentRepository) GetCommentsByPost(postID int, limit, offset int) ([]
 		ORDER BY c.depth ASC, c.created_at ASC
 		LIMIT $2 OFFSET $3`
 
-	rows, err := r.db.Query(context.Background(), query, postID, limit, offset)
+	rows, err := r.db.Query(ctx, query, postID, limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -101,7 +101,7 @@ func (r *CommentRepository) GetCommentsByPost(postID int, limit, offset int) ([]
 	return comments, nil
 }
 
-func (r *CommentRepository) GetReplies(parentID int, limit, offset int) ([]*models.Comment, error) {
+func (r *CommentRepository) GetReplies(ctx context.Context, parentID int, limit, offset int) ([]*models.Comment, error) {
 	query := `
 		SELECT c.id, c.content, c.post_id, c.user_id, u.username, c.parent_id, c.depth,
 			   COALESCE(SUM(CASE WHEN cv.is_upvote THEN 1 ELSE -1 END), 0) as vote_count,
@@ -115,7 +115,7 @@ func (r *CommentRepository) GetReplies(parentID int, limit, offset int) ([]*mode
 		ORDER BY c.created_at ASC
 		LIMIT $2 OFFSET $3`
 
-	rows, err := r.db.Query(context.Background(), query, parentID, limit, offset)
+	rows, err := r.db.Query(ctx, query, parentID, limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -137,31 +137,83 @@ func (r *CommentRepository) GetReplies(parentID int, limit, offset int) ([]*mode
 	return comments, nil
 }
 
-func (r *CommentRepository) UpdateComment(comment *models.Comment) error {
+func (r *CommentRepository) GetCommentsByUsername(ctx context.Context, username string, limit, offset int) ([]*models.Comment, error) {
+	query := `
+		SELECT c.id, c.content, c.post_id, c.user_id, u.username, c.parent_id, c.depth,
+			   COALESCE(SUM(CASE WHEN cv.is_upvote THEN 1 ELSE -1 END), 0) as vote_count,
+			   (SELECT COUNT(*) FROM comments WHERE parent_id = c.id) as reply_count,
+			   c.created_at, c.updated_at
+		FROM comments c
+		JOIN users u ON c.user_id = u.id
+		LEFT JOIN comment_votes cv ON c.id = cv.comment_id
+		WHERE u.username = $1
+		GROUP BY c.id, u.username
+		ORDER BY c.created_at DESC
+		LIMIT $2 OFFSET $3`
+
+	rows, err := r.db.Query(ctx, query, username, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []*models.Comment
+	for rows.Next() {
+		comment := &models.Comment{}
+		err := rows.Scan(
+			&comment.ID, &comment.Content, &comment.PostID, &comment.UserID, &comment.Username,
+			&comment.ParentID, &comment.Depth, &comment.VoteCount, &comment.ReplyCount,
+			&comment.CreatedAt, &comment.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+
+	return comments, nil
+}
+
+func (r *CommentRepository) GetAuthorStats(ctx context.Context, username string) (*models.AuthorStats, error) {
+	query := `
+		SELECT COUNT(DISTINCT c.id),
+			   COALESCE(SUM(CASE WHEN cv.is_upvote THEN 1 WHEN NOT cv.is_upvote THEN -1 ELSE 0 END), 0)
+		FROM comments c
+		JOIN users u ON c.user_id = u.id
+		LEFT JOIN comment_votes cv ON c.id = cv.comment_id
+		WHERE u.username = $1`
+
+	stats := &models.AuthorStats{}
+	if err := r.db.QueryRow(ctx, query, username).Scan(&stats.Count, &stats.Karma); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func (r *CommentRepository) UpdateComment(ctx context.Context, comment *models.Comment) error {
 	query := `UPDATE comments SET content = $1, updated_at = NOW() WHERE id = $2`
-	_, err := r.db.Exec(context.Background(), query, comment.Content, comment.ID)
+	_, err := r.db.Exec(ctx, query, comment.Content, comment.ID)
 	return err
 }
 
-func (r *CommentRepository) DeleteComment(id int) error {
+func (r *CommentRepository) DeleteComment(ctx context.Context, id int) error {
 	query := `DELETE FROM comments WHERE id = $1`
-	_, err := r.db.Exec(context.Background(), query, id)
+	_, err := r.db.Exec(ctx, query, id)
 	return err
 }
 
-func (r *CommentRepository) VoteComment(userID, commentID int, isUpvote bool) error {
+func (r *CommentRepository) VoteComment(ctx context.Context, userID, commentID int, isUpvote bool) error {
 	query := `
 		INSERT INTO comment_votes (comment_id, user_id, is_upvote) 
 		VALUES ($1, $2, $3)
 		ON CONFLICT (comment_id, user_id) 
 		DO UPDATE SET is_upvote = $3`
 	
-	_, err := r.db.Exec(context.Background(), query, commentID, userID, isUpvote)
+	_, err := r.db.Exec(ctx, query, commentID, userID, isUpvote)
 	return err
 }
 
-func (r *CommentRepository) RemoveVote(userID, commentID int) error {
+func (r *CommentRepository) RemoveVote(ctx context.Context, userID, commentID int) error {
 	query := `DELETE FROM comment_votes WHERE comment_id = $1 AND user_id = $2`
-	_, err := r.db.Exec(context.Background(), query, commentID, userID)
+	_, err := r.db.Exec(ctx, query, commentID, userID)
 	return err
 }
\ No newline at end of file
@@ -1,12 +1,17 @@
 package services
 
 import (
+	"context"
 	"errors"
 
+	"github.com/AlexGuo43/clans/comment-service/internal/metrics"
 	"github.com/AlexGuo43/clans/comment-service/internal/models"
 	"github.com/AlexGuo43/clans/comment-service/internal/repository"
+	"go.opentelemetry.io/otel"
 )
 
+var tracer = otel.Tracer("github.com/AlexGuo43/clans/comment-service/internal/services")
+
 type CommentService struct {
 	Repo *repository.CommentRepository
 }
@@ -15,14 +20,17 @@ func NewCommentService(repo *repository.CommentRepository) *CommentService {
 	return &CommentService{Repo: repo}
 }
 
-func (s *CommentService) CreateComment(content string, postID, userID int, parentID *int) (*models.Comment, error) {
+func (s *CommentService) CreateComment(ctx context.Context, content string, postID, userID int, parentID *int) (*models.Comment, error) {
+	ctx, span := tracer.Start(ctx, "CommentService.CreateComment")
+	defer span.End()
+
 	if content == "" {
 		return nil, errors.New("content is required")
 	}
 
 	// Validate parent comment exists and belongs to same post
 	if parentID != nil {
-		parentComment, err := s.Repo.GetCommentByID(*parentID)
+		parentComment, err := s.Repo.GetCommentByID(ctx, *parentID)
 		if err != nil {
 			return nil, errors.New("parent comment not found")
 		}
@@ -38,19 +46,26 @@ func (s *CommentService) CreateComment(content string, postID, userID int, paren
 		ParentID: parentID,
 	}
 
-	err := s.Repo.CreateComment(comment)
+	err := s.Repo.CreateComment(ctx, comment)
 	if err != nil {
 		return nil, err
 	}
+	metrics.CommentsCreated.Inc()
 
 	return comment, nil
 }
 
-func (s *CommentService) GetComment(id int) (*models.Comment, error) {
-	return s.Repo.GetCommentByID(id)
+func (s *CommentService) GetComment(ctx context.Context, id int) (*models.Comment, error) {
+	ctx, span := tracer.Start(ctx, "CommentService.GetComment")
+	defer span.End()
+
+	return s.Repo.GetCommentByID(ctx, id)
 }
 
-func (s *CommentService) GetCommentsByPost(postID, page, limit int) ([]*models.Comment, error) {
+func (s *CommentService) GetCommentsByPost(ctx context.Context, postID, page, limit int) ([]*models.Comment, error) {
+	ctx, span := tracer.Start(ctx, "CommentService.GetCommentsByPost")
+	defer span.End()
+
 	if limit <= 0 {
 		limit = 20
 	}
@@ -62,7 +77,7 @@ func (s *CommentService) GetCommentsByPost(postID, page, limit int) ([]*models.C
 	}
 
 	offset := (page - 1) * limit
-	flatComments, err := s.Repo.GetCommentsByPost(postID, limit, offset)
+	flatComments, err := s.Repo.GetCommentsByPost(ctx, postID, limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -97,7 +112,30 @@ func (s *CommentService) buildCommentTree(flatComments []*models.Comment) []*mod
 	return rootComments
 }
 
-func (s *CommentService) GetReplies(parentID, page, limit int) ([]*models.Comment, error) {
+func (s *CommentService) GetReplies(ctx context.Context, parentID, page, limit int) ([]*models.Comment, error) {
+	ctx, span := tracer.Start(ctx, "CommentService.GetReplies")
+	defer span.End()
+
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > 50 {
+		limit = 50
+	}
+	if page <= 0 {
+		page = 1
+	}
+
+	offset := (page - 1) * limit
+	return s.Repo.GetReplies(ctx, parentID, limit, offset)
+}
+
+// GetCommentsByUsername lists a user's comments newest first, flat rather
+// than threaded.
+func (s *CommentService) GetCommentsByUsername(ctx context.Context, username string, page, limit int) ([]*models.Comment, error) {
+	ctx, span := tracer.Start(ctx, "CommentService.GetCommentsByUsername")
+	defer span.End()
+
 	if limit <= 0 {
 		limit = 10
 	}
@@ -109,11 +147,21 @@ func (s *CommentService) GetReplies(parentID, page, limit int) ([]*models.Commen
 	}
 
 	offset := (page - 1) * limit
-	return s.Repo.GetReplies(parentID, limit, offset)
+	return s.Repo.GetCommentsByUsername(ctx, username, limit, offset)
+}
+
+func (s *CommentService) GetAuthorStats(ctx context.Context, username string) (*models.AuthorStats, error) {
+	ctx, span := tracer.Start(ctx, "CommentService.GetAuthorStats")
+	defer span.End()
+
+	return s.Repo.GetAuthorStats(ctx, username)
 }
 
-func (s *CommentService) UpdateComment(id int, content string, userID int) error {
-	comment, err := s.Repo.GetCommentByID(id)
+func (s *CommentService) UpdateComment(ctx context.Context, id int, content string, userID int) error {
+	ctx, span := tracer.Start(ctx, "CommentService.UpdateComment")
+	defer span.End()
+
+	comment, err := s.Repo.GetCommentByID(ctx, id)
 	if err != nil {
 		return err
 	}
@@ -126,11 +174,14 @@ func (s *CommentService) UpdateComment(id int, content string, userID int) error
 		comment.Content = content
 	}
 
-	return s.Repo.UpdateComment(comment)
+	return s.Repo.UpdateComment(ctx, comment)
 }
 
-func (s *CommentService) DeleteComment(id, userID int) error {
-	comment, err := s.Repo.GetCommentByID(id)
+func (s *CommentService) DeleteComment(ctx context.Context, id, userID int) error {
+	ctx, span := tracer.Start(ctx, "CommentService.DeleteComment")
+	defer span.End()
+
+	comment, err := s.Repo.GetCommentByID(ctx, id)
 	if err != nil {
 		return err
 	}
@@ -139,19 +190,37 @@ func (s *CommentService) DeleteComment(id, userID int) error {
 		return errors.New("unauthorized: can only delete your own comments")
 	}
 
-	return s.Repo.DeleteComment(id)
+	return s.Repo.DeleteComment(ctx, id)
 }
 
-func (s *CommentService) VoteComment(userID, commentID int, isUpvote bool) error {
-	_, err := s.Repo.GetCommentByID(commentID)
+func (s *CommentService) VoteComment(ctx context.Context, userID, commentID int, isUpvote bool) error {
+	ctx, span := tracer.Start(ctx, "CommentService.VoteComment")
+	defer span.End()
+
+	_, err := s.Repo.GetCommentByID(ctx, commentID)
 	if err != nil {
 		return errors.New("comment not found")
 	}
 
-	return s.Repo.VoteComment(userID, commentID, isUpvote)
+	if err := s.Repo.VoteComment(ctx, userID, commentID, isUpvote); err != nil {
+		return err
+	}
+	metrics.CommentVotes.WithLabelValues(voteDirection(isUpvote)).Inc()
+
+	return nil
 }
 
-func (s *CommentService) RemoveVote(userID, commentID int) error {
-	return s.Repo.RemoveVote(userID, commentID)
+func voteDirection(isUpvote bool) string {
+	if isUpvote {
+		return "up"
+	}
+	return "down"
+}
+
+func (s *CommentService) RemoveVote(ctx context.Context, userID, commentID int) error {
+	ctx, span := tracer.Start(ctx, "CommentService.RemoveVote")
+	defer span.End()
+
+	return s.Repo.RemoveVote(ctx, userID, commentID)
 }
 
@@ -3,31 +3,52 @@ package main
 import (
 	"context"
 	"log"
+	"log/slog"
 	"net/http"
 
 	"github.com/AlexGuo43/clans/post-service/config"
 	"github.com/AlexGuo43/clans/post-service/internal/handlers"
+	"github.com/AlexGuo43/clans/post-service/internal/health"
+	"github.com/AlexGuo43/clans/post-service/internal/middleware"
 	"github.com/AlexGuo43/clans/post-service/internal/repository"
 	"github.com/AlexGuo43/clans/post-service/internal/services"
+	"github.com/AlexGuo43/clans/post-service/internal/tracing"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 
 func main() {
 	cfg := config.LoadConfig()
+	slog.SetDefault(middleware.NewLogger(cfg.LogLevel))
+	if cfg.InternalAuthSecret == "" {
+		log.Fatal("INTERNAL_AUTH_SECRET is required")
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), "post-service", cfg.TraceExporter, cfg.TraceFile)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	db := repository.ConnectDB(cfg)
-	defer db.Close(context.Background())
+	defer db.Close()
 
 	postRepo := repository.NewPostRepository(db)
 	postService := services.NewPostService(postRepo)
 	postHandler := handlers.NewPostHandler(postService)
 
 	r := mux.NewRouter()
+	r.Use(middleware.RequestIDMiddleware)
+	r.Use(middleware.TracingMiddleware)
+	r.Use(middleware.LoggingMiddleware)
+	r.Use(middleware.MetricsMiddleware)
+	r.Use(middleware.IdentityMiddleware(cfg.InternalAuthSecret, "post-service"))
 
-	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{"status":"healthy"}`))
-	}).Methods("GET")
+	r.HandleFunc("/livez", health.Livez).Methods("GET")
+	r.HandleFunc("/readyz", health.Readyz(db)).Methods("GET")
+	r.HandleFunc("/health", health.Readyz(db)).Methods("GET")
+	r.Handle("/metrics", promhttp.Handler()).Methods("GET")
 
 	api := r.PathPrefix("/api/posts").Subrouter()
 	
@@ -40,6 +61,11 @@ func main() {
 	api.HandleFunc("/{id:[0-9]+}", postHandler.DeletePost).Methods("DELETE")
 	api.HandleFunc("/{id:[0-9]+}/vote", postHandler.VotePost).Methods("POST")
 
+	// A user's posts, for their profile.
+	users := r.PathPrefix("/api/users/{username}/posts").Subrouter()
+	users.HandleFunc("", postHandler.GetPostsByUser).Methods("GET")
+	users.HandleFunc("/stats", postHandler.GetAuthorStats).Methods("GET")
+
 	log.Println("Post Service running on port 8081...")
 	log.Fatal(http.ListenAndServe(":8081", r))
 }
\ No newline at end of file
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/AlexGuo43/clans/post-service/internal/etag"
 	"github.com/AlexGuo43/clans/post-service/internal/services"
 	"github.com/gorilla/mux"
 )
@@ -36,7 +37,7 @@ func (h *PostHandler) CreatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	post, err := h.PostService.CreatePost(req.Title, req.Content, userID, req.ClanID)
+	post, err := h.PostService.CreatePost(r.Context(), req.Title, req.Content, userID, req.ClanID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -55,14 +56,13 @@ func (h *PostHandler) GetPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	post, err := h.PostService.GetPost(id)
+	post, err := h.PostService.GetPost(r.Context(), id)
 	if err != nil {
 		http.Error(w, "Post not found", http.StatusNotFound)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(post)
+	etag.WriteJSON(w, r, post)
 }
 
 func (h *PostHandler) GetPosts(w http.ResponseWriter, r *http.Request) {
@@ -81,14 +81,13 @@ func (h *PostHandler) GetPosts(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	posts, err := h.PostService.GetPosts(page, limit)
+	posts, err := h.PostService.GetPosts(r.Context(), page, limit)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(posts)
+	etag.WriteJSON(w, r, posts)
 }
 
 func (h *PostHandler) GetPostsByClan(w http.ResponseWriter, r *http.Request) {
@@ -114,14 +113,55 @@ func (h *PostHandler) GetPostsByClan(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	posts, err := h.PostService.GetPostsByClan(clanID, page, limit)
+	posts, err := h.PostService.GetPostsByClan(r.Context(), clanID, page, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	etag.WriteJSON(w, r, posts)
+}
+
+// GetPostsByUser lists the posts of the user named in the path, newest
+// first. Unknown users have no posts.
+func (h *PostHandler) GetPostsByUser(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+
+	page := 1
+	limit := 10
+
+	if p := r.URL.Query().Get("page"); p != "" {
+		if parsed, err := strconv.Atoi(p); err == nil {
+			page = parsed
+		}
+	}
+
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil {
+			limit = parsed
+		}
+	}
+
+	posts, err := h.PostService.GetPostsByUsername(r.Context(), username, page, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	etag.WriteJSON(w, r, posts)
+}
+
+// GetAuthorStats counts the posts of the user named in the path and their
+// karma, for the gateway's profile view.
+func (h *PostHandler) GetAuthorStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.PostService.GetAuthorStats(r.Context(), mux.Vars(r)["username"])
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(posts)
+	json.NewEncoder(w).Encode(stats)
 }
 
 func (h *PostHandler) UpdatePost(w http.ResponseWriter, r *http.Request) {
@@ -149,7 +189,7 @@ func (h *PostHandler) UpdatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.PostService.UpdatePost(id, req.Title, req.Content, userID)
+	err = h.PostService.UpdatePost(r.Context(), id, req.Title, req.Content, userID)
 	if err != nil {
 		if err.Error() == "unauthorized: can only edit your own posts" {
 			http.Error(w, err.Error(), http.StatusForbidden)
@@ -178,7 +218,7 @@ func (h *PostHandler) DeletePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.PostService.DeletePost(id, userID)
+	err = h.PostService.DeletePost(r.Context(), id, userID)
 	if err != nil {
 		if err.Error() == "unauthorized: can only delete your own posts" {
 			http.Error(w, err.Error(), http.StatusForbidden)
@@ -217,9 +257,9 @@ func (h *PostHandler) VotePost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if req.IsUpvote == nil {
-		err = h.PostService.RemoveVote(userID, postID)
+		err = h.PostService.RemoveVote(r.Context(), userID, postID)
 	} else {
-		err = h.PostService.VotePost(userID, postID, *req.IsUpvote)
+		err = h.PostService.VotePost(r.Context(), userID, postID, *req.IsUpvote)
 	}
 
 	if err != nil {
@@ -229,4 +269,5 @@ func (h *PostHandler) VotePost(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Vote updated successfully"})
-}
\ No newline at end of file
+}
+
@@ -20,4 +20,11 @@ type PostVote struct {
 	PostID  int  `json:"post_id"`
 	UserID  int  `json:"user_id"`
 	IsUpvote bool `json:"is_upvote"`
-}
\ No newline at end of file
+}
+
+// AuthorStats sums up a user's posts for their profile. Karma is the net
+// vote count of the posts.
+type AuthorStats struct {
+	Count int `json:"count"`
+	Karma int `json:"karma"`
+}
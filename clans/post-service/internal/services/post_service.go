@@ -1,12 +1,17 @@
 package services
 
 import (
+	"context"
 	"errors"
 
+	"github.com/AlexGuo43/clans/post-service/internal/metrics"
 	"github.com/AlexGuo43/clans/post-service/internal/models"
 	"github.com/AlexGuo43/clans/post-service/internal/repository"
+	"go.opentelemetry.io/otel"
 )
 
+var tracer = otel.Tracer("github.com/AlexGuo43/clans/post-service/internal/services")
+
 type PostService struct {
 	Repo *repository.PostRepository
 }
@@ -15,7 +20,10 @@ func NewPostService(repo *repository.PostRepository) *PostService {
 	return &PostService{Repo: repo}
 }
 
-func (s *PostService) CreatePost(title, content string, userID int, clanID *int) (*models.Post, error) {
+func (s *PostService) CreatePost(ctx context.Context, title, content string, userID int, clanID *int) (*models.Post, error) {
+	ctx, span := tracer.Start(ctx, "PostService.CreatePost")
+	defer span.End()
+
 	if title == "" {
 		return nil, errors.New("title is required")
 	}
@@ -30,19 +38,44 @@ func (s *PostService) CreatePost(title, content string, userID int, clanID *int)
 		ClanID:  clanID,
 	}
 
-	err := s.Repo.CreatePost(post)
+	err := s.Repo.CreatePost(ctx, post)
 	if err != nil {
 		return nil, err
 	}
+	metrics.PostsCreated.Inc()
 
 	return post, nil
 }
 
-func (s *PostService) GetPost(id int) (*models.Post, error) {
-	return s.Repo.GetPostByID(id)
+func (s *PostService) GetPost(ctx context.Context, id int) (*models.Post, error) {
+	ctx, span := tracer.Start(ctx, "PostService.GetPost")
+	defer span.End()
+
+	return s.Repo.GetPostByID(ctx, id)
+}
+
+func (s *PostService) GetPosts(ctx context.Context, page, limit int) ([]*models.Post, error) {
+	ctx, span := tracer.Start(ctx, "PostService.GetPosts")
+	defer span.End()
+
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	if page <= 0 {
+		page = 1
+	}
+
+	offset := (page - 1) * limit
+	return s.Repo.GetPosts(ctx, limit, offset)
 }
 
-func (s *PostService) GetPosts(page, limit int) ([]*models.Post, error) {
+func (s *PostService) GetPostsByClan(ctx context.Context, clanID, page, limit int) ([]*models.Post, error) {
+	ctx, span := tracer.Start(ctx, "PostService.GetPostsByClan")
+	defer span.End()
+
 	if limit <= 0 {
 		limit = 10
 	}
@@ -54,10 +87,13 @@ func (s *PostService) GetPosts(page, limit int) ([]*models.Post, error) {
 	}
 
 	offset := (page - 1) * limit
-	return s.Repo.GetPosts(limit, offset)
+	return s.Repo.GetPostsByClan(ctx, clanID, limit, offset)
 }
 
-func (s *PostService) GetPostsByClan(clanID, page, limit int) ([]*models.Post, error) {
+func (s *PostService) GetPostsByUsername(ctx context.Context, username string, page, limit int) ([]*models.Post, error) {
+	ctx, span := tracer.Start(ctx, "PostService.GetPostsByUsername")
+	defer span.End()
+
 	if limit <= 0 {
 		limit = 10
 	}
@@ -69,11 +105,21 @@ func (s *PostService) GetPostsByClan(clanID, page, limit int) ([]*models.Post, e
 	}
 
 	offset := (page - 1) * limit
-	return s.Repo.GetPostsByClan(clanID, limit, offset)
+	return s.Repo.GetPostsByUsername(ctx, username, limit, offset)
+}
+
+func (s *PostService) GetAuthorStats(ctx context.Context, username string) (*models.AuthorStats, error) {
+	ctx, span := tracer.Start(ctx, "PostService.GetAuthorStats")
+	defer span.End()
+
+	return s.Repo.GetAuthorStats(ctx, username)
 }
 
-func (s *PostService) UpdatePost(id int, title, content string, userID int) error {
-	post, err := s.Repo.GetPostByID(id)
+func (s *PostService) UpdatePost(ctx context.Context, id int, title, content string, userID int) error {
+	ctx, span := tracer.Start(ctx, "PostService.UpdatePost")
+	defer span.End()
+
+	post, err := s.Repo.GetPostByID(ctx, id)
 	if err != nil {
 		return err
 	}
@@ -89,11 +135,14 @@ func (s *PostService) UpdatePost(id int, title, content string, userID int) erro
 		post.Content = content
 	}
 
-	return s.Repo.UpdatePost(post)
+	return s.Repo.UpdatePost(ctx, post)
 }
 
-func (s *PostService) DeletePost(id, userID int) error {
-	post, err := s.Repo.GetPostByID(id)
+func (s *PostService) DeletePost(ctx context.Context, id, userID int) error {
+	ctx, span := tracer.Start(ctx, "PostService.DeletePost")
+	defer span.End()
+
+	post, err := s.Repo.GetPostByID(ctx, id)
 	if err != nil {
 		return err
 	}
@@ -102,18 +151,36 @@ func (s *PostService) DeletePost(id, userID int) error {
 		return errors.New("unauthorized: can only delete your own posts")
 	}
 
-	return s.Repo.DeletePost(id)
+	return s.Repo.DeletePost(ctx, id)
 }
 
-func (s *PostService) VotePost(userID, postID int, isUpvote bool) error {
-	_, err := s.Repo.GetPostByID(postID)
+func (s *PostService) VotePost(ctx context.Context, userID, postID int, isUpvote bool) error {
+	ctx, span := tracer.Start(ctx, "PostService.VotePost")
+	defer span.End()
+
+	_, err := s.Repo.GetPostByID(ctx, postID)
 	if err != nil {
 		return errors.New("post not found")
 	}
 
-	return s.Repo.VotePost(userID, postID, isUpvote)
+	if err := s.Repo.VotePost(ctx, userID, postID, isUpvote); err != nil {
+		return err
+	}
+	metrics.PostVotes.WithLabelValues(voteDirection(isUpvote)).Inc()
+
+	return nil
 }
 
-func (s *PostService) RemoveVote(userID, postID int) error {
-	return s.Repo.RemoveVote(userID, postID)
+func voteDirection(isUpvote bool) string {
+	if isUpvote {
+		return "up"
+	}
+	return "down"
+}
+
+func (s *PostService) RemoveVote(ctx context.Context, userID, postID int) error {
+	ctx, span := tracer.Start(ctx, "PostService.RemoveVote")
+	defer span.End()
+
+	return s.Repo.RemoveVote(ctx, userID, postID)
 }
\ No newline at end of file
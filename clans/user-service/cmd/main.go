@@ -3,39 +3,100 @@ package main
 import (
 	"context"
 	"log"
+	"log/slog"
 	"net/http"
 
 	"github.com/AlexGuo43/clans/user-service/config"
 	"github.com/AlexGuo43/clans/user-service/internal/handlers"
+	"github.com/AlexGuo43/clans/user-service/internal/health"
+	"github.com/AlexGuo43/clans/user-service/internal/keys"
+	"github.com/AlexGuo43/clans/user-service/internal/mailer"
 	"github.com/AlexGuo43/clans/user-service/internal/middleware"
 	"github.com/AlexGuo43/clans/user-service/internal/repository"
 	"github.com/AlexGuo43/clans/user-service/internal/services"
+	"github.com/AlexGuo43/clans/user-service/internal/tracing"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 
 func main() {
 	cfg := config.LoadConfig()
+	slog.SetDefault(middleware.NewLogger(cfg.LogLevel))
+	if cfg.InternalAuthSecret == "" {
+		log.Fatal("INTERNAL_AUTH_SECRET is required")
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), "user-service", cfg.TraceExporter, cfg.TraceFile)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	signingKeys, err := keys.Load(cfg.JWTKeysDir, cfg.JWTSigningKeyID)
+	if err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
+	}
+
+	mail, err := mailer.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to set up mailer: %v", err)
+	}
+	if cfg.VerifyEmailURL == "" || cfg.ResetPasswordURL == "" {
+		log.Fatal("VERIFY_EMAIL_URL and RESET_PASSWORD_URL must be set")
+	}
+
 	db := repository.ConnectDB(cfg)
-	defer db.Close(context.Background())
+	defer db.Close()
 
 	// Initialize services and handlers
 	userRepo := &repository.UserRepository{DB: db}
 	userService := &services.UserService{Repo: userRepo}
-	userHandler := &handlers.UserHandler{UserService: userService}
+	authService := &services.AuthService{Keys: signingKeys}
+	tokenService := &services.TokenService{Repo: &repository.TokenRepository{DB: db}, Users: userRepo, Auth: authService}
+	verificationService := &services.VerificationService{Users: userRepo, Auth: authService, Mailer: mail, LinkURL: cfg.VerifyEmailURL}
+	passwordService := &services.PasswordService{Users: userRepo, Tokens: tokenService, Mailer: mail, LinkURL: cfg.ResetPasswordURL}
+	userHandler := &handlers.UserHandler{
+		UserService:         userService,
+		TokenService:        tokenService,
+		VerificationService: verificationService,
+		PasswordService:     passwordService,
+	}
 
 	// Set up routes
 	r := mux.NewRouter()
-	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{"status":"healthy"}`))
-	}).Methods("GET")
+	r.Use(middleware.RequestIDMiddleware)
+	r.Use(middleware.TracingMiddleware)
+	r.Use(middleware.LoggingMiddleware)
+	r.Use(middleware.MetricsMiddleware)
+	r.Use(middleware.IdentityMiddleware(cfg.InternalAuthSecret, "user-service"))
+	r.HandleFunc("/livez", health.Livez).Methods("GET")
+	r.HandleFunc("/readyz", health.Readyz(db)).Methods("GET")
+	r.HandleFunc("/health", health.Readyz(db)).Methods("GET")
+	r.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	r.HandleFunc("/.well-known/jwks.json", signingKeys.Handler).Methods("GET")
 	r.HandleFunc("/signup", userHandler.RegisterUser).Methods("POST")
 	r.HandleFunc("/login", userHandler.LoginUser).Methods("POST")
+	r.HandleFunc("/refresh", userHandler.RefreshToken).Methods("POST")
+	r.HandleFunc("/logout", userHandler.Logout).Methods("POST")
+	r.HandleFunc("/verify-email", userHandler.VerifyEmail).Methods("POST")
+	r.HandleFunc("/verify-email/resend", userHandler.ResendVerification).Methods("POST")
+	r.HandleFunc("/forgot-password", userHandler.ForgotPassword).Methods("POST")
+	r.HandleFunc("/reset-password", userHandler.ResetPassword).Methods("POST")
+	r.HandleFunc("/me", userHandler.GetMe).Methods("GET")
+	r.HandleFunc("/me", userHandler.UpdateMe).Methods("PUT")
+	r.HandleFunc("/me/password", userHandler.ChangePassword).Methods("PUT")
+	r.HandleFunc("/profiles/{name}", userHandler.GetUser).Methods("GET")
+	r.HandleFunc("/{name:[0-9]+}", userHandler.GetUser).Methods("GET")
+
+	// Only the gateway itself may read the revocation list.
+	internal := r.PathPrefix("/internal").Subrouter()
+	internal.Use(middleware.RequireRole("gateway"))
+	internal.HandleFunc("/revocations", userHandler.Revocations).Methods("GET")
 
 	// Protected route (requires authentication)
 	protected := r.PathPrefix("/protected").Subrouter()
-	protected.Use(middleware.AuthMiddleware)
+	protected.Use(middleware.AuthMiddleware(authService))
 	protected.HandleFunc("/dashboard", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("Welcome to the protected dashboard!"))
 	}).Methods("GET")
@@ -8,12 +8,32 @@ import (
 )
 
 type Config struct {
-	DBHost     string
-	DBPort     string
-	DBUser     string
-	DBPassword string
-	DBName     string
-	JWTSecret  string
+	DBHost        string
+	DBPort        string
+	DBUser        string
+	DBPassword    string
+	DBName        string
+	LogLevel      string
+	TraceExporter string
+	TraceFile     string
+	// InternalAuthSecret verifies identity assertions from the gateway.
+	InternalAuthSecret string
+	// JWTKeysDir holds the access token signing keys, one <kid>.pem file
+	// each. JWTSigningKeyID picks the key new tokens are signed with.
+	JWTKeysDir      string
+	JWTSigningKeyID string
+	// Mailer is "smtp", "stdout" or "file"; see mailer.New.
+	Mailer       string
+	MailFrom     string
+	MailFile     string
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	// VerifyEmailURL and ResetPasswordURL are the pages verification and
+	// password reset links point to. The token is appended as the "token"
+	// query parameter.
+	VerifyEmailURL   string
+	ResetPasswordURL string
 }
 
 func LoadConfig() *Config {
@@ -22,11 +42,24 @@ func LoadConfig() *Config {
 	}
 
 	return &Config{
-		DBHost:     os.Getenv("DB_HOST"),
-		DBPort:     os.Getenv("DB_PORT"),
-		DBUser:     os.Getenv("DB_USER"),
-		DBPassword: os.Getenv("DB_PASSWORD"),
-		DBName:     os.Getenv("DB_NAME"),
-		JWTSecret:  os.Getenv("JWT_SECRET"),
+		DBHost:             os.Getenv("DB_HOST"),
+		DBPort:             os.Getenv("DB_PORT"),
+		DBUser:             os.Getenv("DB_USER"),
+		DBPassword:         os.Getenv("DB_PASSWORD"),
+		DBName:             os.Getenv("DB_NAME"),
+		LogLevel:           os.Getenv("LOG_LEVEL"),
+		TraceExporter:      os.Getenv("TRACE_EXPORTER"),
+		TraceFile:          os.Getenv("TRACE_FILE"),
+		InternalAuthSecret: os.Getenv("INTERNAL_AUTH_SECRET"),
+		JWTKeysDir:         os.Getenv("JWT_KEYS_DIR"),
+		JWTSigningKeyID:    os.Getenv("JWT_SIGNING_KEY_ID"),
+		Mailer:             os.Getenv("MAILER"),
+		MailFrom:           os.Getenv("MAIL_FROM"),
+		MailFile:           os.Getenv("MAIL_FILE"),
+		SMTPAddr:           os.Getenv("SMTP_ADDR"),
+		SMTPUsername:       os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:       os.Getenv("SMTP_PASSWORD"),
+		VerifyEmailURL:     os.Getenv("VERIFY_EMAIL_URL"),
+		ResetPasswordURL:   os.Getenv("RESET_PASSWORD_URL"),
 	}
 }
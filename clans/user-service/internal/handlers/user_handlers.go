@@ -1,14 +1,36 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/AlexGuo43/clans/user-service/internal/models"
+	"github.com/AlexGuo43/clans/user-service/internal/repository"
 	"github.com/AlexGuo43/clans/user-service/internal/services"
+	"github.com/gorilla/mux"
 )
 
 type UserHandler struct {
-	UserService *services.UserService
+	UserService         *services.UserService
+	TokenService        *services.TokenService
+	VerificationService *services.VerificationService
+	PasswordService     *services.PasswordService
+}
+
+// forgotPasswordTimeout bounds sending a reset link, which outlives the
+// request.
+const forgotPasswordTimeout = 30 * time.Second
+
+// tokenResponse is returned by login and refresh. Token repeats the access
+// token for clients written before refresh tokens.
+type tokenResponse struct {
+	Token string `json:"token"`
+	*models.TokenPair
 }
 
 // RegisterUser handles user registration requests
@@ -24,17 +46,167 @@ func (h *UserHandler) RegisterUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.UserService.RegisterUser(req.Username, req.Email, req.Password)
+	user, err := h.UserService.RegisterUser(r.Context(), req.Username, req.Email, req.Password)
+	if errors.Is(err, services.ErrInvalidUsername) || errors.Is(err, services.ErrInvalidEmail) ||
+		errors.Is(err, services.ErrInvalidPassword) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// The account exists either way; a link that failed to send can be
+	// asked for again after logging in.
+	if err := h.VerificationService.Send(r.Context(), user); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+	}
+
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"message": "User registered successfully"})
+	json.NewEncoder(w).Encode(map[string]string{"message": "User registered successfully, check your email to verify your address"})
 }
 
-// LoginUser handles user login and returns a JWT token
+// VerifyEmail marks the address in a verification link as verified.
+func (h *UserHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	err := h.VerificationService.Verify(r.Context(), req.Token)
+	if errors.Is(err, services.ErrInvalidEmailToken) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to verify email", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email verified, refresh your access token to use it"})
+}
+
+// ResendVerification emails the caller another verification link.
+func (h *UserHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.Header.Get("X-User-ID"))
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	err = h.VerificationService.Resend(r.Context(), id)
+	if errors.Is(err, services.ErrEmailAlreadyVerified) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, repository.ErrUserNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to send verification email", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Verification email sent"})
+}
+
+// ForgotPassword emails a password reset link if the address has an
+// account. The response is the same either way, and is sent before the
+// address is looked up so that its timing gives nothing away either.
+func (h *UserHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), forgotPasswordTimeout)
+	go func() {
+		defer cancel()
+		if err := h.PasswordService.ForgotPassword(ctx, req.Email); err != nil {
+			log.Printf("Failed to send password reset email: %v", err)
+		}
+	}()
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "If the address has an account, a reset link has been sent to it"})
+}
+
+// ResetPassword sets a new password with the token from a reset link and
+// logs the user out everywhere.
+func (h *UserHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	err := h.PasswordService.ResetPassword(r.Context(), req.Token, req.Password)
+	if errors.Is(err, services.ErrInvalidResetToken) || errors.Is(err, services.ErrInvalidPassword) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to reset password", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password reset, log in with the new password"})
+}
+
+// ChangePassword replaces the caller's password, given the current one,
+// and logs them out everywhere, including this session.
+func (h *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.Header.Get("X-User-ID"))
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	err = h.PasswordService.ChangePassword(r.Context(), id, req.CurrentPassword, req.NewPassword)
+	if errors.Is(err, services.ErrWrongPassword) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, services.ErrInvalidPassword) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, repository.ErrUserNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to change password", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password changed, log in with the new password"})
+}
+
+// LoginUser handles user login and returns an access and a refresh token
 func (h *UserHandler) LoginUser(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Email    string `json:"email"`
@@ -46,17 +218,160 @@ func (h *UserHandler) LoginUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.UserService.Authenticate(req.Email, req.Password)
+	user, err := h.UserService.Authenticate(r.Context(), req.Email, req.Password)
 	if err != nil {
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
-	token, err := services.GenerateJWT(user.ID)
+	tokens, err := h.TokenService.Issue(r.Context(), user.ID)
 	if err != nil {
 		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
 		return
 	}
 
-	json.NewEncoder(w).Encode(map[string]string{"token": token})
+	writeTokens(w, tokens)
+}
+
+// RefreshToken exchanges a refresh token for a new access and refresh
+// token. Presenting a refresh token that was already exchanged revokes the
+// session.
+func (h *UserHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := h.TokenService.Refresh(r.Context(), req.RefreshToken)
+	if errors.Is(err, services.ErrInvalidRefreshToken) || errors.Is(err, services.ErrRefreshTokenReused) {
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to refresh token", http.StatusInternalServerError)
+		return
+	}
+
+	writeTokens(w, tokens)
+}
+
+// Logout revokes the session of a refresh token and its access tokens.
+func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.TokenService.Logout(r.Context(), req.RefreshToken); err != nil {
+		http.Error(w, "Failed to log out", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Revocations lists the revoked sessions for the gateway, which refuses
+// their access tokens.
+func (h *UserHandler) Revocations(w http.ResponseWriter, r *http.Request) {
+	revocations, err := h.TokenService.Revocations(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to load revocations", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{"revocations": revocations})
+}
+
+func writeTokens(w http.ResponseWriter, tokens *models.TokenPair) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(tokenResponse{Token: tokens.AccessToken, TokenPair: tokens})
+}
+
+// GetUser returns a user's public profile, looked up by username or ID. The
+// email address is only included for the user themselves.
+func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	user, err := h.UserService.GetProfile(r.Context(), mux.Vars(r)["name"])
+	if errors.Is(err, repository.ErrUserNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to load user", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Header.Get("X-User-ID") != strconv.Itoa(user.ID) {
+		user.Email = ""
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// GetMe returns the caller's own profile, including their email address.
+func (h *UserHandler) GetMe(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.Header.Get("X-User-ID"))
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := h.UserService.GetUser(r.Context(), id)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to load user", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "private, no-cache")
+	json.NewEncoder(w).Encode(user)
+}
+
+// UpdateMe replaces the caller's display name, bio and avatar URL. Fields
+// left out are cleared.
+func (h *UserHandler) UpdateMe(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.Header.Get("X-User-ID"))
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.ProfileUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.UserService.UpdateProfile(r.Context(), id, &req)
+	if errors.Is(err, services.ErrInvalidProfile) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, repository.ErrUserNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "private, no-cache")
+	json.NewEncoder(w).Encode(user)
 }
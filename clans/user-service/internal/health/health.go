@@ -0,0 +1,62 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// pingTimeout keeps a stuck database from holding up the probe past the
+// gateway's own health check timeout.
+const pingTimeout = time.Second
+
+// Pinger is implemented by *pgxpool.Pool.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+type check struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+type report struct {
+	Status string           `json:"status"`
+	Checks map[string]check `json:"checks,omitempty"`
+}
+
+// Livez reports that the process is up, without checking its dependencies.
+func Livez(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, http.StatusOK, report{Status: "alive"})
+}
+
+// Readyz reports whether the service can serve requests, which needs a
+// reachable database. It answers 503 when the ping fails.
+func Readyz(db Pinger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), pingTimeout)
+		defer cancel()
+
+		start := time.Now()
+		err := db.Ping(ctx)
+		database := check{Status: "healthy", LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+
+		status := http.StatusOK
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Database ping failed", "error", err)
+			database.Status = "unhealthy"
+			status = http.StatusServiceUnavailable
+		}
+
+		writeReport(w, status, report{Status: database.Status, Checks: map[string]check{"database": database}})
+	}
+}
+
+func writeReport(w http.ResponseWriter, status int, body report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,138 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AlexGuo43/clans/user-service/config"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends email. SMTPMailer delivers it; WriterMailer writes it to
+// stdout or a file for local development and tests.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns the mailer cfg.Mailer names: "smtp", "stdout" (the default)
+// or "file", which appends to cfg.MailFile.
+func New(cfg *config.Config) (Mailer, error) {
+	switch cfg.Mailer {
+	case "smtp":
+		if cfg.SMTPAddr == "" || cfg.MailFrom == "" {
+			return nil, errors.New("the smtp mailer needs SMTP_ADDR and MAIL_FROM")
+		}
+		return &SMTPMailer{Addr: cfg.SMTPAddr, From: cfg.MailFrom, Username: cfg.SMTPUsername, Password: cfg.SMTPPassword}, nil
+	case "", "stdout":
+		return &WriterMailer{W: os.Stdout, From: cfg.MailFrom}, nil
+	case "file":
+		if cfg.MailFile == "" {
+			return nil, errors.New("the file mailer needs MAIL_FILE")
+		}
+		f, err := os.OpenFile(cfg.MailFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		return &WriterMailer{W: f, From: cfg.MailFrom}, nil
+	default:
+		return nil, fmt.Errorf("unknown mailer %q", cfg.Mailer)
+	}
+}
+
+// SMTPMailer sends through an SMTP server, with PLAIN auth when Username is
+// set. net/smtp only sends credentials over TLS or to localhost.
+type SMTPMailer struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	data, err := format(m.From, msg)
+	if err != nil {
+		return err
+	}
+	// The envelope sender is the bare address, without a display name.
+	sender, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return fmt.Errorf("invalid MAIL_FROM: %w", err)
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, err := net.SplitHostPort(m.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+
+	// smtp.SendMail takes no context, so a cancelled request only stops
+	// waiting for it.
+	done := make(chan error, 1)
+	go func() { done <- smtp.SendMail(m.Addr, auth, sender.Address, []string{msg.To}, data) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// WriterMailer writes each message, headers and all, to W.
+type WriterMailer struct {
+	W    io.Writer
+	From string
+
+	mu sync.Mutex
+}
+
+func (m *WriterMailer) Send(ctx context.Context, msg Message) error {
+	data, err := format(m.From, msg)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err = fmt.Fprintf(m.W, "%s\n", data)
+	return err
+}
+
+// format renders msg as an RFC 5322 message.
+func format(from string, msg Message) ([]byte, error) {
+	for _, value := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, errors.New("mail headers must not contain line breaks")
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return buf.Bytes(), nil
+}
@@ -9,24 +9,26 @@ import (
 )
 
 // AuthMiddleware protects routes by requiring a valid JWT
-func AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Missing token", http.StatusUnauthorized)
-			return
-		}
+func AuthMiddleware(authService *services.AuthService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" {
+				http.Error(w, "Missing token", http.StatusUnauthorized)
+				return
+			}
 
-		token := strings.TrimPrefix(authHeader, "Bearer ")
-		userID, err := services.ValidateJWT(token)
-		if err != nil {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
-			return
-		}
+			token := strings.TrimPrefix(authHeader, "Bearer ")
+			userID, err := authService.ValidateJWT(token)
+			if err != nil {
+				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				return
+			}
 
-		// Store user ID in request context (can be retrieved in handlers)
-		ctx := r.Context()
-		ctx = context.WithValue(ctx, "userID", userID)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+			// Store user ID in request context (can be retrieved in handlers)
+			ctx := r.Context()
+			ctx = context.WithValue(ctx, "userID", userID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
 }
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type contextKey string
+
+const requestIDKey contextKey = "requestID"
+
+// RequestIDHeader carries the request ID set by the API gateway.
+const RequestIDHeader = "X-Request-ID"
+
+type responseWriter struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	rw.statusCode = code
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+// NewLogger returns a JSON logger at the given level ("debug", "info", "warn"
+// or "error"; anything else means info).
+func NewLogger(level string) *slog.Logger {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		lvl = slog.LevelInfo
+	}
+	return slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: lvl}))
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// RequestIDMiddleware reuses the gateway's X-Request-ID, or generates one for
+// requests that did not come through the gateway, and echoes it back.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			b := make([]byte, 16)
+			rand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+	})
+}
+
+// LoggingMiddleware writes one structured line per request with the request
+// ID, the user from X-User-ID, the matched route template, status and latency.
+func LoggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		wrapped := &responseWriter{
+			ResponseWriter: w,
+			statusCode:     http.StatusOK,
+		}
+
+		next.ServeHTTP(wrapped, r)
+
+		attrs := []slog.Attr{
+			slog.String("request_id", RequestIDFromContext(r.Context())),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", wrapped.statusCode),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+		}
+		if route := routeTemplate(r); route != "" {
+			attrs = append(attrs, slog.String("route", route))
+		}
+		if spanContext := trace.SpanContextFromContext(r.Context()); spanContext.IsValid() {
+			attrs = append(attrs, slog.String("trace_id", spanContext.TraceID().String()))
+		}
+		if userID := r.Header.Get("X-User-ID"); userID != "" {
+			attrs = append(attrs, slog.String("user_id", userID))
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case wrapped.statusCode >= 500:
+			level = slog.LevelError
+		case wrapped.statusCode >= 400:
+			level = slog.LevelWarn
+		case isHealthProbe(r.URL.Path):
+			// Gateway health probes would otherwise drown out real traffic.
+			level = slog.LevelDebug
+		}
+		slog.LogAttrs(r.Context(), level, "request completed", attrs...)
+	})
+}
+
+// isHealthProbe reports whether path is one of the health endpoints polled by
+// the gateway and orchestrators.
+func isHealthProbe(path string) bool {
+	return path == "/health" || path == "/livez" || path == "/readyz"
+}
+
+// routeTemplate returns the path template of the matched mux route, e.g.
+// "/api/posts/{id:[0-9]+}", so that IDs do not end up in labels.
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return ""
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// RefreshToken is a stored refresh token. Only the hash of the token is
+// kept. Tokens issued from one login share a FamilyID, which access tokens
+// carry as their session ID.
+type RefreshToken struct {
+	ID        int
+	TokenHash string
+	FamilyID  string
+	UserID    int
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+// TokenPair is what login and refresh return.
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// Revocation is an access token ID (jti) or session ID (sid) that is refused
+// until ExpiresAt, when every token it covers has expired anyway.
+type Revocation struct {
+	TokenID   string    `json:"id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
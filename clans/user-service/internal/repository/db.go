@@ -6,18 +6,30 @@ import (
 	"log"
 
 	"github.com/AlexGuo43/clans/user-service/config"
-	"github.com/jackc/pgx/v5"
+	"github.com/AlexGuo43/clans/user-service/internal/metrics"
+	"github.com/AlexGuo43/clans/user-service/internal/tracing"
+	"github.com/jackc/pgx/v5/multitracer"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func ConnectDB(cfg *config.Config) *pgx.Conn {
+func ConnectDB(cfg *config.Config) *pgxpool.Pool {
 	dbURL := fmt.Sprintf("postgres://%s:%s@%s:%s/%s",
 		cfg.DBUser, cfg.DBPassword, cfg.DBHost, cfg.DBPort, cfg.DBName)
 
-	conn, err := pgx.Connect(context.Background(), dbURL)
+	poolConfig, err := pgxpool.ParseConfig(dbURL)
 	if err != nil {
+		log.Fatalf("Invalid database configuration: %v", err)
+	}
+	poolConfig.ConnConfig.Tracer = multitracer.New(metrics.QueryTracer{}, tracing.QueryTracer{})
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
+	if err != nil {
+		log.Fatalf("Unable to connect to database: %v", err)
+	}
+	if err := pool.Ping(context.Background()); err != nil {
 		log.Fatalf("Unable to connect to database: %v", err)
 	}
 	log.Println("Connected to PostgreSQL")
 
-	return conn
+	return pool
 }
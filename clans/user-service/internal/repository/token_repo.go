@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/AlexGuo43/clans/user-service/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrTokenNotFound is returned when no refresh token has the given hash.
+var ErrTokenNotFound = errors.New("refresh token not found")
+
+type TokenRepository struct {
+	DB *pgxpool.Pool
+}
+
+func (repo *TokenRepository) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	return repo.DB.QueryRow(ctx,
+		`INSERT INTO refresh_tokens (token_hash, family_id, user_id, expires_at)
+		 VALUES ($1, $2, $3, $4) RETURNING id`,
+		token.TokenHash, token.FamilyID, token.UserID, token.ExpiresAt).Scan(&token.ID)
+}
+
+func (repo *TokenRepository) GetRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	token := &models.RefreshToken{}
+	err := repo.DB.QueryRow(ctx,
+		`SELECT id, token_hash, family_id, user_id, expires_at, used_at, revoked_at
+		 FROM refresh_tokens WHERE token_hash=$1`, tokenHash).
+		Scan(&token.ID, &token.TokenHash, &token.FamilyID, &token.UserID, &token.ExpiresAt, &token.UsedAt, &token.RevokedAt)
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrTokenNotFound
+		}
+		return nil, err
+	}
+	return token, nil
+}
+
+// UseRefreshToken marks a token as used. It reports false if the token was
+// already used or revoked, including by a concurrent request.
+func (repo *TokenRepository) UseRefreshToken(ctx context.Context, id int) (bool, error) {
+	tag, err := repo.DB.Exec(ctx,
+		`UPDATE refresh_tokens SET used_at=$2
+		 WHERE id=$1 AND used_at IS NULL AND revoked_at IS NULL`, id, time.Now().UTC())
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// RevokeFamily revokes every refresh token of a family and puts the family
+// on the revocation list until until, so that its access tokens are refused
+// as well.
+func (repo *TokenRepository) RevokeFamily(ctx context.Context, familyID string, until time.Time) error {
+	tx, err := repo.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	now := time.Now().UTC()
+	if _, err := tx.Exec(ctx,
+		`UPDATE refresh_tokens SET revoked_at=$2
+		 WHERE family_id=$1 AND revoked_at IS NULL`, familyID, now); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx,
+		`INSERT INTO revoked_tokens (token_id, expires_at) VALUES ($1, $2)
+		 ON CONFLICT (token_id) DO NOTHING`, familyID, until.UTC()); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx,
+		"DELETE FROM revoked_tokens WHERE expires_at < $1", now); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// RevokeUser revokes every session of a user, as RevokeFamily does, and
+// uses up their outstanding password reset tokens.
+func (repo *TokenRepository) RevokeUser(ctx context.Context, userID int, until time.Time) error {
+	tx, err := repo.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	now := time.Now().UTC()
+	rows, err := tx.Query(ctx,
+		`UPDATE refresh_tokens SET revoked_at=$2
+		 WHERE user_id=$1 AND revoked_at IS NULL RETURNING family_id`, userID, now)
+	if err != nil {
+		return err
+	}
+	families, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+
+	for _, familyID := range families {
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO revoked_tokens (token_id, expires_at) VALUES ($1, $2)
+			 ON CONFLICT (token_id) DO NOTHING`, familyID, until.UTC()); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(ctx,
+		`UPDATE password_reset_tokens SET used_at=$2
+		 WHERE user_id=$1 AND used_at IS NULL`, userID, now); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx,
+		"DELETE FROM revoked_tokens WHERE expires_at < $1", now); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (repo *TokenRepository) CreatePasswordResetToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	_, err := repo.DB.Exec(ctx,
+		`INSERT INTO password_reset_tokens (token_hash, user_id, expires_at)
+		 VALUES ($1, $2, $3)`, tokenHash, userID, expiresAt.UTC())
+	return err
+}
+
+// UsePasswordResetToken marks an unexpired, unused reset token as used and
+// returns its user. It reports false if there is no such token, including
+// when a concurrent request used it first.
+func (repo *TokenRepository) UsePasswordResetToken(ctx context.Context, tokenHash string) (int, bool, error) {
+	now := time.Now().UTC()
+	var userID int
+	err := repo.DB.QueryRow(ctx,
+		`UPDATE password_reset_tokens SET used_at=$2
+		 WHERE token_hash=$1 AND used_at IS NULL AND expires_at > $2
+		 RETURNING user_id`, tokenHash, now).Scan(&userID)
+	if err == pgx.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return userID, true, nil
+}
+
+// ListRevocations returns the revocations that have not expired. There are
+// few, since they only last as long as an access token.
+func (repo *TokenRepository) ListRevocations(ctx context.Context) ([]models.Revocation, error) {
+	rows, err := repo.DB.Query(ctx,
+		"SELECT token_id, expires_at FROM revoked_tokens WHERE expires_at > $1", time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revocations := []models.Revocation{}
+	for rows.Next() {
+		var revocation models.Revocation
+		if err := rows.Scan(&revocation.TokenID, &revocation.ExpiresAt); err != nil {
+			return nil, err
+		}
+		revocations = append(revocations, revocation)
+	}
+	return revocations, rows.Err()
+}
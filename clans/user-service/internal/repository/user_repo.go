@@ -3,33 +3,102 @@ package repository
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/AlexGuo43/clans/user-service/internal/models"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// ErrUserNotFound is returned when no user matches the lookup.
+var ErrUserNotFound = errors.New("user not found")
+
 type UserRepository struct {
-	DB *pgx.Conn
+	DB *pgxpool.Pool
 }
 
-func (repo *UserRepository) CreateUser(user *models.User) error {
-	_, err := repo.DB.Exec(context.Background(),
-		"INSERT INTO users (username, email, password) VALUES ($1, $2, $3)",
-		user.Username, user.Email, user.Password)
-	return err
+func (repo *UserRepository) CreateUser(ctx context.Context, user *models.User) error {
+	return repo.DB.QueryRow(ctx,
+		"INSERT INTO users (username, email, password) VALUES ($1, $2, $3) RETURNING id, created_at",
+		user.Username, user.Email, user.Password).Scan(&user.ID, &user.CreatedAt)
 }
 
-func (repo *UserRepository) GetUserByEmail(email string) (*models.User, error) {
+func (repo *UserRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	user := &models.User{}
-	err := repo.DB.QueryRow(context.Background(),
+	err := repo.DB.QueryRow(ctx,
 		"SELECT id, username, email, password FROM users WHERE email=$1", email).
 		Scan(&user.ID, &user.Username, &user.Email, &user.Password)
 
 	if err != nil {
 		if err == pgx.ErrNoRows {
-			return nil, errors.New("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, err
 	}
 	return user, nil
 }
+
+// GetPassword returns the password hash of a user.
+func (repo *UserRepository) GetPassword(ctx context.Context, id int) (string, error) {
+	var password string
+	err := repo.DB.QueryRow(ctx, "SELECT password FROM users WHERE id=$1", id).Scan(&password)
+	if err == pgx.ErrNoRows {
+		return "", ErrUserNotFound
+	}
+	return password, err
+}
+
+// UpdatePassword replaces a user's password hash.
+func (repo *UserRepository) UpdatePassword(ctx context.Context, id int, password string) error {
+	tag, err := repo.DB.Exec(ctx, "UPDATE users SET password=$2 WHERE id=$1", id, password)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// profileColumns are the columns scanProfile reads.
+const profileColumns = "id, username, email, email_verified_at IS NOT NULL, display_name, bio, avatar_url, created_at"
+
+func scanProfile(row pgx.Row) (*models.User, error) {
+	user := &models.User{}
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.EmailVerified, &user.DisplayName, &user.Bio, &user.AvatarURL, &user.CreatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+func (repo *UserRepository) GetUserByID(ctx context.Context, id int) (*models.User, error) {
+	return scanProfile(repo.DB.QueryRow(ctx,
+		"SELECT "+profileColumns+" FROM users WHERE id=$1", id))
+}
+
+func (repo *UserRepository) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	return scanProfile(repo.DB.QueryRow(ctx,
+		"SELECT "+profileColumns+" FROM users WHERE username=$1", username))
+}
+
+// UpdateProfile replaces the editable profile fields and returns the
+// updated user.
+func (repo *UserRepository) UpdateProfile(ctx context.Context, id int, update *models.ProfileUpdate) (*models.User, error) {
+	return scanProfile(repo.DB.QueryRow(ctx,
+		`UPDATE users SET display_name=$2, bio=$3, avatar_url=$4
+		 WHERE id=$1 RETURNING `+profileColumns,
+		id, update.DisplayName, update.Bio, update.AvatarURL))
+}
+
+// MarkEmailVerified records that the user owns email. It does nothing if
+// the user's address has changed since, or was already verified.
+func (repo *UserRepository) MarkEmailVerified(ctx context.Context, id int, email string) error {
+	_, err := repo.DB.Exec(ctx,
+		`UPDATE users SET email_verified_at=$3
+		 WHERE id=$1 AND email=$2 AND email_verified_at IS NULL`, id, email, time.Now().UTC())
+	return err
+}
@@ -1,39 +1,127 @@
 package services
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
 	"time"
 
+	"github.com/AlexGuo43/clans/user-service/internal/keys"
+	"github.com/AlexGuo43/clans/user-service/internal/models"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtSecret = []byte("mysecretkey")
+// AccessTokenTTL is how long an access token is valid. It is short because
+// access tokens are only refused before they expire if they are revoked,
+// which the gateway learns about with a delay.
+const AccessTokenTTL = 15 * time.Minute
 
-// GenerateJWT creates a JWT token for a user
-func GenerateJWT(userID int) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
+// EmailTokenTTL is how long an email verification link works.
+const EmailTokenTTL = 24 * time.Hour
+
+// emailAudience keeps verification tokens and access tokens apart.
+const emailAudience = "verify-email"
+
+// AccessClaims are the claims of an access token. SessionID is the refresh
+// token family the token was issued from, so that logging out or a stolen
+// refresh token can revoke every access token of the session. The gateway
+// keeps users with an unverified email address from creating content.
+type AccessClaims struct {
+	UserID        int    `json:"user_id"`
+	SessionID     string `json:"sid"`
+	EmailVerified bool   `json:"email_verified"`
+	jwt.RegisteredClaims
+}
+
+// EmailClaims are the claims of an email verification token. The address
+// is included so that a link stops working if the address changes.
+type EmailClaims struct {
+	Email string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+// AuthService signs and checks access tokens with the keys in Keys. Other
+// services verify them with the public keys at /.well-known/jwks.json.
+type AuthService struct {
+	Keys *keys.Set
+}
+
+// GenerateJWT creates an access token for a user's session.
+func (s *AuthService) GenerateJWT(user *models.User, sessionID string) (string, error) {
+	now := time.Now()
+	claims := AccessClaims{
+		UserID:        user.ID,
+		SessionID:     sessionID,
+		EmailVerified: user.EmailVerified,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        randomID(),
+			Subject:   strconv.Itoa(user.ID),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL)),
+		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	return s.Keys.Sign(claims)
 }
 
-// ValidateJWT checks the token validity and extracts the user ID
-func ValidateJWT(tokenString string) (int, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
+// ParseJWT checks an access token and returns its claims.
+func (s *AuthService) ParseJWT(tokenString string) (*AccessClaims, error) {
+	claims := &AccessClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, s.Keys.Keyfunc,
+		jwt.WithValidMethods(s.Keys.Methods()), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	if claims.UserID == 0 {
+		return nil, errors.New("token has no user_id")
+	}
+	return claims, nil
+}
 
-	if err != nil || !token.Valid {
+// ValidateJWT checks the token validity and extracts the user ID
+func (s *AuthService) ValidateJWT(tokenString string) (int, error) {
+	claims, err := s.ParseJWT(tokenString)
+	if err != nil {
 		return 0, err
 	}
+	return claims.UserID, nil
+}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return 0, err
+// GenerateEmailToken creates the token of a link that verifies a user's
+// email address.
+func (s *AuthService) GenerateEmailToken(user *models.User) (string, error) {
+	now := time.Now()
+	return s.Keys.Sign(EmailClaims{
+		Email: user.Email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(user.ID),
+			Audience:  jwt.ClaimStrings{emailAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(EmailTokenTTL)),
+		},
+	})
+}
+
+// ParseEmailToken checks an email verification token and returns the user
+// ID and address it verifies.
+func (s *AuthService) ParseEmailToken(tokenString string) (int, string, error) {
+	claims := &EmailClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, s.Keys.Keyfunc,
+		jwt.WithValidMethods(s.Keys.Methods()), jwt.WithExpirationRequired(), jwt.WithAudience(emailAudience))
+	if err != nil {
+		return 0, "", err
 	}
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil || claims.Email == "" {
+		return 0, "", errors.New("token has no user or email")
+	}
+	return userID, claims.Email, nil
+}
 
-	userID := int(claims["user_id"].(float64))
-	return userID, nil
+// randomID returns 128 random bits in hex, for token and session IDs.
+func randomID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
 }
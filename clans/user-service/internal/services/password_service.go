@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/AlexGuo43/clans/user-service/internal/mailer"
+	"github.com/AlexGuo43/clans/user-service/internal/metrics"
+	"github.com/AlexGuo43/clans/user-service/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordResetTTL is how long a password reset link works.
+const PasswordResetTTL = time.Hour
+
+var (
+	// ErrInvalidResetToken covers unknown, expired and used reset links.
+	ErrInvalidResetToken = errors.New("invalid or expired reset link")
+	// ErrWrongPassword is returned when the current password given to
+	// ChangePassword is wrong.
+	ErrWrongPassword = errors.New("current password is wrong")
+)
+
+// PasswordService resets forgotten passwords through emailed links and
+// changes the passwords of signed-in users. Either way every session of the
+// user is revoked.
+type PasswordService struct {
+	Users  UserStore
+	Tokens *TokenService
+	Mailer mailer.Mailer
+	// LinkURL is the page reset links point to, with the token in the
+	// "token" query parameter.
+	LinkURL string
+}
+
+// ForgotPassword emails a reset link to the account with the given
+// address. Unknown addresses are not an error, so callers cannot tell
+// whether an address has an account.
+func (s *PasswordService) ForgotPassword(ctx context.Context, email string) error {
+	ctx, span := tracer.Start(ctx, "PasswordService.ForgotPassword")
+	defer span.End()
+
+	user, err := s.Users.GetUserByEmail(ctx, email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		metrics.PasswordResets.WithLabelValues("unknown_email").Inc()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+	if err := s.Tokens.Repo.CreatePasswordResetToken(ctx, user.ID, hashToken(token), time.Now().Add(PasswordResetTTL)); err != nil {
+		return err
+	}
+
+	link, err := url.Parse(s.LinkURL)
+	if err != nil {
+		return fmt.Errorf("invalid reset link URL: %w", err)
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	err = s.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen this link within %d minutes to choose a new password:\n\n%s\n\n"+
+			"If you did not ask to reset your password, you can ignore this email.\n",
+			user.Username, int(PasswordResetTTL.Minutes()), link),
+	})
+	if err != nil {
+		metrics.PasswordResets.WithLabelValues("send_failed").Inc()
+		return err
+	}
+	metrics.PasswordResets.WithLabelValues("sent").Inc()
+	return nil
+}
+
+// ResetPassword sets a new password with the token from a reset link. The
+// token works once, and the user's other reset links stop working too.
+func (s *PasswordService) ResetPassword(ctx context.Context, token, password string) error {
+	ctx, span := tracer.Start(ctx, "PasswordService.ResetPassword")
+	defer span.End()
+
+	// Check the password first, so a rejected one does not use up the link.
+	hashed, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	userID, ok, err := s.Tokens.Repo.UsePasswordResetToken(ctx, hashToken(token))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		metrics.PasswordResets.WithLabelValues("invalid").Inc()
+		return ErrInvalidResetToken
+	}
+
+	if err := s.setPassword(ctx, userID, hashed); err != nil {
+		return err
+	}
+	metrics.PasswordResets.WithLabelValues("reset").Inc()
+	return nil
+}
+
+// ChangePassword replaces a signed-in user's password, given the current
+// one.
+func (s *PasswordService) ChangePassword(ctx context.Context, userID int, current, password string) error {
+	ctx, span := tracer.Start(ctx, "PasswordService.ChangePassword")
+	defer span.End()
+
+	stored, err := s.Users.GetPassword(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(stored), []byte(current)) != nil {
+		metrics.PasswordChanges.WithLabelValues("wrong_password").Inc()
+		return ErrWrongPassword
+	}
+
+	hashed, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	if err := s.setPassword(ctx, userID, hashed); err != nil {
+		return err
+	}
+	metrics.PasswordChanges.WithLabelValues("success").Inc()
+	return nil
+}
+
+// setPassword stores a new password hash and revokes every session, so
+// whoever knew the old password is logged out.
+func (s *PasswordService) setPassword(ctx context.Context, userID int, hashed string) error {
+	if err := s.Users.UpdatePassword(ctx, userID, hashed); err != nil {
+		return err
+	}
+	return s.Tokens.RevokeUser(ctx, userID)
+}
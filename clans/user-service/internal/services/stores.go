@@ -0,0 +1,41 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/AlexGuo43/clans/user-service/internal/models"
+)
+
+// TokenStore keeps refresh tokens, password reset tokens and the revocation
+// list. *repository.TokenRepository stores them in Postgres.
+type TokenStore interface {
+	CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error
+	// GetRefreshToken returns repository.ErrTokenNotFound for unknown
+	// hashes.
+	GetRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	// UseRefreshToken reports false if the token was already used or
+	// revoked.
+	UseRefreshToken(ctx context.Context, id int) (bool, error)
+	RevokeFamily(ctx context.Context, familyID string, until time.Time) error
+	// RevokeUser revokes every family of a user and uses up their reset
+	// tokens.
+	RevokeUser(ctx context.Context, userID int, until time.Time) error
+	CreatePasswordResetToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error
+	// UsePasswordResetToken reports false for unknown, used and expired
+	// tokens.
+	UsePasswordResetToken(ctx context.Context, tokenHash string) (int, bool, error)
+	ListRevocations(ctx context.Context) ([]models.Revocation, error)
+}
+
+// UserStore is the part of *repository.UserRepository that sessions,
+// passwords and email verification need.
+type UserStore interface {
+	// GetUserByID and GetUserByEmail return repository.ErrUserNotFound
+	// for unknown users.
+	GetUserByID(ctx context.Context, id int) (*models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	GetPassword(ctx context.Context, id int) (string, error)
+	UpdatePassword(ctx context.Context, id int, password string) error
+	MarkEmailVerified(ctx context.Context, id int, email string) error
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/AlexGuo43/clans/user-service/internal/metrics"
+	"github.com/AlexGuo43/clans/user-service/internal/models"
+	"github.com/AlexGuo43/clans/user-service/internal/repository"
+)
+
+// RefreshTokenTTL is how long a refresh token can be used. Every refresh
+// issues a new one, so an active session does not expire.
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+var (
+	// ErrInvalidRefreshToken covers unknown, expired and revoked tokens.
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused means a refresh token was presented again after
+	// it had been exchanged. Either the client or an attacker holds a copy,
+	// so the whole session is revoked.
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// TokenService issues access tokens with rotating refresh tokens.
+type TokenService struct {
+	Repo  TokenStore
+	Users UserStore
+	Auth  *AuthService
+}
+
+// Issue starts a new session for a user who has just logged in.
+func (s *TokenService) Issue(ctx context.Context, userID int) (*models.TokenPair, error) {
+	ctx, span := tracer.Start(ctx, "TokenService.Issue")
+	defer span.End()
+
+	return s.issue(ctx, userID, randomID())
+}
+
+// Refresh exchanges a refresh token for a new pair in the same session.
+// Each refresh token can be exchanged once.
+func (s *TokenService) Refresh(ctx context.Context, refreshToken string) (*models.TokenPair, error) {
+	ctx, span := tracer.Start(ctx, "TokenService.Refresh")
+	defer span.End()
+
+	stored, err := s.Repo.GetRefreshToken(ctx, hashToken(refreshToken))
+	if errors.Is(err, repository.ErrTokenNotFound) {
+		metrics.TokenRefreshes.WithLabelValues("invalid").Inc()
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if stored.RevokedAt != nil || time.Now().After(stored.ExpiresAt) {
+		metrics.TokenRefreshes.WithLabelValues("invalid").Inc()
+		return nil, ErrInvalidRefreshToken
+	}
+
+	fresh, err := s.Repo.UseRefreshToken(ctx, stored.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		metrics.TokenRefreshes.WithLabelValues("reused").Inc()
+		log.Printf("Refresh token reused for user %d, revoking session", stored.UserID)
+		if err := s.revokeSession(ctx, stored.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	metrics.TokenRefreshes.WithLabelValues("success").Inc()
+	return s.issue(ctx, stored.UserID, stored.FamilyID)
+}
+
+// Logout revokes the session of a refresh token, including the access
+// tokens issued in it. Unknown tokens are ignored, so logging out twice
+// succeeds.
+func (s *TokenService) Logout(ctx context.Context, refreshToken string) error {
+	ctx, span := tracer.Start(ctx, "TokenService.Logout")
+	defer span.End()
+
+	stored, err := s.Repo.GetRefreshToken(ctx, hashToken(refreshToken))
+	if errors.Is(err, repository.ErrTokenNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.revokeSession(ctx, stored.FamilyID)
+}
+
+// Revocations lists the revoked sessions whose access tokens may not have
+// expired yet.
+func (s *TokenService) Revocations(ctx context.Context) ([]models.Revocation, error) {
+	ctx, span := tracer.Start(ctx, "TokenService.Revocations")
+	defer span.End()
+
+	return s.Repo.ListRevocations(ctx)
+}
+
+// issue loads the user afresh, so that a new access token reflects a
+// verified email address.
+func (s *TokenService) issue(ctx context.Context, userID int, familyID string) (*models.TokenPair, error) {
+	user, err := s.Users.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := s.Auth.GenerateJWT(user, familyID)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.Repo.CreateRefreshToken(ctx, &models.RefreshToken{
+		TokenHash: hashToken(refreshToken),
+		FamilyID:  familyID,
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(RefreshTokenTTL).UTC(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// RevokeUser revokes every session of a user, with their access tokens,
+// and their outstanding password reset links.
+func (s *TokenService) RevokeUser(ctx context.Context, userID int) error {
+	ctx, span := tracer.Start(ctx, "TokenService.RevokeUser")
+	defer span.End()
+
+	return s.Repo.RevokeUser(ctx, userID, time.Now().Add(AccessTokenTTL))
+}
+
+// revokeSession revokes a token family. Its access tokens were all issued
+// less than AccessTokenTTL ago, so it stays on the revocation list that
+// long.
+func (s *TokenService) revokeSession(ctx context.Context, familyID string) error {
+	return s.Repo.RevokeFamily(ctx, familyID, time.Now().Add(AccessTokenTTL))
+}
+
+// randomToken returns 256 random bits for a refresh or reset token.
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,21 +1,70 @@
 package services
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
+	"github.com/AlexGuo43/clans/user-service/internal/metrics"
 	"github.com/AlexGuo43/clans/user-service/internal/models"
 	"github.com/AlexGuo43/clans/user-service/internal/repository"
+	"go.opentelemetry.io/otel"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var tracer = otel.Tracer("github.com/AlexGuo43/clans/user-service/internal/services")
+
+var (
+	// ErrInvalidUsername, ErrInvalidEmail, ErrInvalidPassword and
+	// ErrInvalidProfile wrap messages that are safe to show the user.
+	ErrInvalidUsername = errors.New("invalid username")
+	ErrInvalidEmail    = errors.New("invalid email")
+	ErrInvalidPassword = errors.New("invalid password")
+	ErrInvalidProfile  = errors.New("invalid profile")
+)
+
+// usernamePattern is what usernames may look like. All-digit names are
+// refused as well, since profiles are looked up by username or user ID.
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{3,30}$`)
+
+// reservedUsernames are path segments under /api/users that are not
+// profiles.
+var reservedUsernames = []string{"me", "clans"}
+
+// Limits on the email address and the editable profile fields.
+const (
+	maxEmail       = 100
+	maxDisplayName = 50
+	maxBio         = 500
+	maxAvatarURL   = 2048
+)
+
 type UserService struct {
 	Repo *repository.UserRepository
 }
 
-func (s *UserService) RegisterUser(username, email, password string) error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// RegisterUser creates an account whose email address is not verified yet.
+func (s *UserService) RegisterUser(ctx context.Context, username, email, password string) (*models.User, error) {
+	ctx, span := tracer.Start(ctx, "UserService.RegisterUser")
+	defer span.End()
+
+	if err := validateUsername(username); err != nil {
+		return nil, err
+	}
+	if err := validateEmail(email); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := hashPassword(password)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	user := &models.User{
@@ -23,18 +72,116 @@ func (s *UserService) RegisterUser(username, email, password string) error {
 		Email:    email,
 		Password: string(hashedPassword),
 	}
-	return s.Repo.CreateUser(user)
+	if err := s.Repo.CreateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	metrics.UsersRegistered.Inc()
+
+	return user, nil
 }
 
-func (s *UserService) Authenticate(email, password string) (*models.User, error) {
-	user, err := s.Repo.GetUserByEmail(email)
+func (s *UserService) Authenticate(ctx context.Context, email, password string) (*models.User, error) {
+	ctx, span := tracer.Start(ctx, "UserService.Authenticate")
+	defer span.End()
+
+	user, err := s.Repo.GetUserByEmail(ctx, email)
 	if err != nil {
+		metrics.Logins.WithLabelValues("failure").Inc()
 		return nil, err
 	}
 
 	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		metrics.Logins.WithLabelValues("failure").Inc()
 		return nil, errors.New("invalid credentials")
 	}
+	metrics.Logins.WithLabelValues("success").Inc()
 
 	return user, nil
 }
+
+func (s *UserService) GetUser(ctx context.Context, id int) (*models.User, error) {
+	ctx, span := tracer.Start(ctx, "UserService.GetUser")
+	defer span.End()
+
+	return s.Repo.GetUserByID(ctx, id)
+}
+
+// GetProfile looks a user up by username, or by ID if name is a number.
+func (s *UserService) GetProfile(ctx context.Context, name string) (*models.User, error) {
+	ctx, span := tracer.Start(ctx, "UserService.GetProfile")
+	defer span.End()
+
+	if id, err := strconv.Atoi(name); err == nil {
+		return s.Repo.GetUserByID(ctx, id)
+	}
+	return s.Repo.GetUserByUsername(ctx, name)
+}
+
+// UpdateProfile replaces a user's display name, bio and avatar URL.
+func (s *UserService) UpdateProfile(ctx context.Context, id int, update *models.ProfileUpdate) (*models.User, error) {
+	ctx, span := tracer.Start(ctx, "UserService.UpdateProfile")
+	defer span.End()
+
+	update.DisplayName = strings.TrimSpace(update.DisplayName)
+	update.Bio = strings.TrimSpace(update.Bio)
+	update.AvatarURL = strings.TrimSpace(update.AvatarURL)
+	if err := validateProfile(update); err != nil {
+		return nil, err
+	}
+	return s.Repo.UpdateProfile(ctx, id, update)
+}
+
+func validateUsername(username string) error {
+	if !usernamePattern.MatchString(username) {
+		return fmt.Errorf("%w: use 3 to 30 letters, digits, _ or -", ErrInvalidUsername)
+	}
+	if _, err := strconv.Atoi(username); err == nil {
+		return fmt.Errorf("%w: must not be a number", ErrInvalidUsername)
+	}
+	if slices.Contains(reservedUsernames, strings.ToLower(username)) {
+		return fmt.Errorf("%w: %q is reserved", ErrInvalidUsername, username)
+	}
+	return nil
+}
+
+// hashPassword checks a new password and hashes it. bcrypt only reads the
+// first 72 bytes, so longer passwords are refused rather than truncated.
+func hashPassword(password string) (string, error) {
+	if password == "" || len(password) > 72 {
+		return "", fmt.Errorf("%w: use 1 to 72 bytes", ErrInvalidPassword)
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+// validateEmail accepts bare addresses, without a display name.
+func validateEmail(email string) error {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || len(email) > maxEmail {
+		return fmt.Errorf("%w: not a valid email address", ErrInvalidEmail)
+	}
+	return nil
+}
+
+func validateProfile(update *models.ProfileUpdate) error {
+	if utf8.RuneCountInString(update.DisplayName) > maxDisplayName {
+		return fmt.Errorf("%w: display_name is longer than %d characters", ErrInvalidProfile, maxDisplayName)
+	}
+	if utf8.RuneCountInString(update.Bio) > maxBio {
+		return fmt.Errorf("%w: bio is longer than %d characters", ErrInvalidProfile, maxBio)
+	}
+	if update.AvatarURL == "" {
+		return nil
+	}
+	if len(update.AvatarURL) > maxAvatarURL {
+		return fmt.Errorf("%w: avatar_url is longer than %d characters", ErrInvalidProfile, maxAvatarURL)
+	}
+	u, err := url.Parse(update.AvatarURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("%w: avatar_url must be an http or https URL", ErrInvalidProfile)
+	}
+	return nil
+}
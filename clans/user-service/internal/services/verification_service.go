@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/AlexGuo43/clans/user-service/internal/mailer"
+	"github.com/AlexGuo43/clans/user-service/internal/metrics"
+	"github.com/AlexGuo43/clans/user-service/internal/models"
+	"github.com/AlexGuo43/clans/user-service/internal/repository"
+)
+
+var (
+	// ErrInvalidEmailToken covers malformed, expired and outdated links.
+	ErrInvalidEmailToken = errors.New("invalid or expired verification link")
+	// ErrEmailAlreadyVerified is returned when asking for another link
+	// after verifying.
+	ErrEmailAlreadyVerified = errors.New("email address already verified")
+)
+
+// VerificationService emails users a signed link that verifies their
+// address, and checks the links.
+type VerificationService struct {
+	Users  UserStore
+	Auth   *AuthService
+	Mailer mailer.Mailer
+	// LinkURL is the page links point to, with the token in the "token"
+	// query parameter.
+	LinkURL string
+}
+
+// Send emails user a verification link.
+func (s *VerificationService) Send(ctx context.Context, user *models.User) error {
+	ctx, span := tracer.Start(ctx, "VerificationService.Send")
+	defer span.End()
+
+	token, err := s.Auth.GenerateEmailToken(user)
+	if err != nil {
+		return err
+	}
+	link, err := url.Parse(s.LinkURL)
+	if err != nil {
+		return fmt.Errorf("invalid verification link URL: %w", err)
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	err = s.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen this link within %d hours to verify your email address:\n\n%s\n\n"+
+			"If you did not sign up, you can ignore this email.\n",
+			user.Username, int(EmailTokenTTL.Hours()), link),
+	})
+	if err != nil {
+		metrics.EmailVerifications.WithLabelValues("send_failed").Inc()
+		return err
+	}
+	metrics.EmailVerifications.WithLabelValues("sent").Inc()
+	return nil
+}
+
+// Resend emails a user another link, unless their address is verified.
+func (s *VerificationService) Resend(ctx context.Context, userID int) error {
+	ctx, span := tracer.Start(ctx, "VerificationService.Resend")
+	defer span.End()
+
+	user, err := s.Users.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return ErrEmailAlreadyVerified
+	}
+	return s.Send(ctx, user)
+}
+
+// Verify marks the address in a verification link as verified. Using a link
+// again succeeds. Access tokens issued before only say the address is
+// verified once they are refreshed.
+func (s *VerificationService) Verify(ctx context.Context, token string) error {
+	ctx, span := tracer.Start(ctx, "VerificationService.Verify")
+	defer span.End()
+
+	userID, email, err := s.Auth.ParseEmailToken(token)
+	if err != nil {
+		metrics.EmailVerifications.WithLabelValues("invalid").Inc()
+		return ErrInvalidEmailToken
+	}
+	user, err := s.Users.GetUserByID(ctx, userID)
+	if errors.Is(err, repository.ErrUserNotFound) || (err == nil && user.Email != email) {
+		metrics.EmailVerifications.WithLabelValues("invalid").Inc()
+		return ErrInvalidEmailToken
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.Users.MarkEmailVerified(ctx, userID, email); err != nil {
+		return err
+	}
+	metrics.EmailVerifications.WithLabelValues("verified").Inc()
+	return nil
+}
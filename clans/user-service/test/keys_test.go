@@ -0,0 +1,158 @@
+package userservice_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AlexGuo43/clans/user-service/internal/keys"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func rsaKey(t *testing.T, bits int) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	return key
+}
+
+func TestLoadKeysNamedByFile(t *testing.T) {
+	dir := t.TempDir()
+	rsaPrivate := rsaKey(t, 2048)
+	edPublic, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	writePEM(t, filepath.Join(dir, "2024-rsa.pem"), "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaPrivate))
+	writePEM(t, filepath.Join(dir, "2025-ed.pem"), "PRIVATE KEY", mustPKCS8(t, edPrivate))
+	retired, _ := x509.MarshalPKIXPublicKey(edPublic)
+	writePEM(t, filepath.Join(dir, "2023-old.pem"), "PUBLIC KEY", retired)
+	writePEM(t, filepath.Join(dir, "notes.txt"), "PUBLIC KEY", retired)
+
+	set, err := keys.Load(dir, "2025-ed")
+	if err != nil {
+		t.Fatalf("Failed to load keys: %v", err)
+	}
+
+	var kids []string
+	for _, jwk := range set.JWKS() {
+		kids = append(kids, jwk.KeyID)
+	}
+	if strings.Join(kids, ",") != "2023-old,2024-rsa,2025-ed" {
+		t.Errorf("Expected the three .pem files by name, got %v", kids)
+	}
+
+	token, err := set.Sign(jwt.MapClaims{"sub": "7"})
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	parsed, err := jwt.Parse(token, set.Keyfunc, jwt.WithValidMethods(set.Methods()))
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+	if parsed.Header["kid"] != "2025-ed" || parsed.Method.Alg() != "EdDSA" {
+		t.Errorf("Expected an EdDSA token from 2025-ed, got %s from %v", parsed.Method.Alg(), parsed.Header["kid"])
+	}
+}
+
+func TestLoadKeysChoosesSigningKey(t *testing.T) {
+	dir := t.TempDir()
+	_, first, _ := ed25519.GenerateKey(rand.Reader)
+	_, second, _ := ed25519.GenerateKey(rand.Reader)
+	writePEM(t, filepath.Join(dir, "a.pem"), "PRIVATE KEY", mustPKCS8(t, first))
+
+	if set, err := keys.Load(dir, ""); err != nil {
+		t.Errorf("Expected the only private key to sign, got %v", err)
+	} else if token, _ := set.Sign(jwt.MapClaims{}); !strings.Contains(decodeHeader(t, token), `"kid":"a"`) {
+		t.Errorf("Expected tokens signed with a, got header %s", decodeHeader(t, token))
+	}
+
+	writePEM(t, filepath.Join(dir, "b.pem"), "PRIVATE KEY", mustPKCS8(t, second))
+	if _, err := keys.Load(dir, ""); err == nil {
+		t.Error("Expected an error choosing between two private keys")
+	}
+	if _, err := keys.Load(dir, "c"); err == nil {
+		t.Error("Expected an error for a missing signing key")
+	}
+	if _, err := keys.Load(t.TempDir(), ""); err == nil {
+		t.Error("Expected an error for a directory without keys")
+	}
+}
+
+func TestLoadKeysRejectsWeakAndUnsupportedKeys(t *testing.T) {
+	weak := t.TempDir()
+	writePEM(t, filepath.Join(weak, "weak.pem"), "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey(t, 1024)))
+	if _, err := keys.Load(weak, ""); err == nil || !strings.Contains(err.Error(), "2048") {
+		t.Errorf("Expected a 1024-bit RSA key to be refused, got %v", err)
+	}
+
+	ec := t.TempDir()
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	writePEM(t, filepath.Join(ec, "p256.pem"), "PRIVATE KEY", mustPKCS8(t, ecKey))
+	if _, err := keys.Load(ec, ""); err == nil {
+		t.Error("Expected a P-256 key to be refused")
+	}
+}
+
+func TestJWKSEncodesPublicKeys(t *testing.T) {
+	dir := t.TempDir()
+	rsaPrivate := rsaKey(t, 2048)
+	edPublic, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	writePEM(t, filepath.Join(dir, "rsa.pem"), "PRIVATE KEY", mustPKCS8(t, rsaPrivate))
+	writePEM(t, filepath.Join(dir, "ed.pem"), "PRIVATE KEY", mustPKCS8(t, edPrivate))
+	set, err := keys.Load(dir, "rsa")
+	if err != nil {
+		t.Fatalf("Failed to load keys: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	set.Handler(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	var body struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode JWKS: %v", err)
+	}
+	if len(body.Keys) != 2 {
+		t.Fatalf("Expected two keys, got %v", body.Keys)
+	}
+
+	ed, rsaJWK := body.Keys[0], body.Keys[1]
+	if ed["kid"] != "ed" || ed["kty"] != "OKP" || ed["crv"] != "Ed25519" || ed["alg"] != "EdDSA" || ed["use"] != "sig" {
+		t.Errorf("Unexpected Ed25519 key: %v", ed)
+	}
+	if x, err := base64.RawURLEncoding.DecodeString(ed["x"]); err != nil || !ed25519.PublicKey(x).Equal(edPublic) {
+		t.Errorf("Expected x to be the base64url public key, got %q", ed["x"])
+	}
+
+	if rsaJWK["kid"] != "rsa" || rsaJWK["kty"] != "RSA" || rsaJWK["alg"] != "RS256" || rsaJWK["use"] != "sig" {
+		t.Errorf("Unexpected RSA key: %v", rsaJWK)
+	}
+	n, errN := base64.RawURLEncoding.DecodeString(rsaJWK["n"])
+	e, errE := base64.RawURLEncoding.DecodeString(rsaJWK["e"])
+	if errN != nil || errE != nil || new(big.Int).SetBytes(n).Cmp(rsaPrivate.N) != 0 || new(big.Int).SetBytes(e).Int64() != int64(rsaPrivate.E) {
+		t.Errorf("Expected n and e to be the base64url modulus and exponent, got %q and %q", rsaJWK["n"], rsaJWK["e"])
+	}
+	if _, private := rsaJWK["d"]; private {
+		t.Error("Expected no private key material")
+	}
+}
+
+func decodeHeader(t *testing.T, token string) string {
+	t.Helper()
+	header, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[0])
+	if err != nil {
+		t.Fatalf("Failed to decode header: %v", err)
+	}
+	return string(header)
+}
@@ -0,0 +1,151 @@
+package userservice_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexGuo43/clans/user-service/internal/mailer"
+	"github.com/AlexGuo43/clans/user-service/internal/models"
+	"github.com/AlexGuo43/clans/user-service/internal/services"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type passwordFixture struct {
+	passwords *services.PasswordService
+	tokens    *memoryTokens
+	users     *memoryUsers
+	mail      *bytes.Buffer
+}
+
+// newPasswordService has user 7, ann@example.com, with the password "old".
+func newPasswordService(t *testing.T) *passwordFixture {
+	t.Helper()
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("old"), bcrypt.MinCost)
+	users := newMemoryUsers(&models.User{ID: 7, Username: "ann", Email: "ann@example.com", Password: string(hashed)})
+	tokens := newMemoryTokens()
+	var mail bytes.Buffer
+	return &passwordFixture{
+		passwords: &services.PasswordService{
+			Users:   users,
+			Tokens:  &services.TokenService{Repo: tokens, Users: users, Auth: &services.AuthService{Keys: testKeys(t, "test")}},
+			Mailer:  &mailer.WriterMailer{W: &mail, From: "noreply@example.com"},
+			LinkURL: "https://clans.example.com/reset-password",
+		},
+		tokens: tokens,
+		users:  users,
+		mail:   &mail,
+	}
+}
+
+// resetLink asks for a reset link and returns its token.
+func (f *passwordFixture) resetLink(t *testing.T) string {
+	t.Helper()
+	if err := f.passwords.ForgotPassword(context.Background(), "ann@example.com"); err != nil {
+		t.Fatalf("Failed to send reset link: %v", err)
+	}
+	return mailedToken(t, f.mail)
+}
+
+func (f *passwordFixture) hasPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(f.users.users[7].Password), []byte(password)) == nil
+}
+
+func TestResetTokenWorksOnce(t *testing.T) {
+	f := newPasswordService(t)
+	ctx := context.Background()
+
+	token := f.resetLink(t)
+	if err := f.passwords.ResetPassword(ctx, token, "new"); err != nil {
+		t.Fatalf("Failed to reset: %v", err)
+	}
+	if !f.hasPassword("new") {
+		t.Error("Expected the new password to be set")
+	}
+	if err := f.passwords.ResetPassword(ctx, token, "newer"); !errors.Is(err, services.ErrInvalidResetToken) {
+		t.Errorf("Expected the link to work once, got %v", err)
+	}
+	if !f.hasPassword("new") {
+		t.Error("Expected a used link not to change the password")
+	}
+
+	f.mail.Reset()
+	if err := f.passwords.ForgotPassword(ctx, "nobody@example.com"); err != nil || f.mail.Len() != 0 {
+		t.Errorf("Expected unknown addresses to succeed without mail, got %v and %q", err, f.mail)
+	}
+}
+
+func TestResetTokenExpires(t *testing.T) {
+	f := newPasswordService(t)
+
+	token := f.resetLink(t)
+	if lifetime := time.Until(f.tokens.resets[0].expiresAt); lifetime < services.PasswordResetTTL-time.Minute || lifetime > services.PasswordResetTTL {
+		t.Errorf("Expected the link to last %v, got %v", services.PasswordResetTTL, lifetime)
+	}
+	f.tokens.expire()
+
+	if err := f.passwords.ResetPassword(context.Background(), token, "new"); !errors.Is(err, services.ErrInvalidResetToken) {
+		t.Errorf("Expected an expired link to be refused, got %v", err)
+	}
+	if !f.hasPassword("old") {
+		t.Error("Expected the password to be unchanged")
+	}
+}
+
+func TestResetPasswordValidatesBeforeUsingToken(t *testing.T) {
+	f := newPasswordService(t)
+	ctx := context.Background()
+
+	token := f.resetLink(t)
+	if err := f.passwords.ResetPassword(ctx, token, strings.Repeat("x", 73)); !errors.Is(err, services.ErrInvalidPassword) {
+		t.Fatalf("Expected ErrInvalidPassword, got %v", err)
+	}
+	if err := f.passwords.ResetPassword(ctx, token, ""); !errors.Is(err, services.ErrInvalidPassword) {
+		t.Fatalf("Expected ErrInvalidPassword, got %v", err)
+	}
+	if err := f.passwords.ResetPassword(ctx, token, "new"); err != nil {
+		t.Errorf("Expected the link to survive rejected passwords, got %v", err)
+	}
+}
+
+func TestPasswordChangeRevokesSessionsAndResetLinks(t *testing.T) {
+	f := newPasswordService(t)
+	ctx := context.Background()
+	sessions := f.passwords.Tokens
+
+	first, _ := sessions.Issue(ctx, 7)
+	second, _ := sessions.Issue(ctx, 7)
+	token := f.resetLink(t)
+
+	if err := f.passwords.ChangePassword(ctx, 7, "wrong", "new"); !errors.Is(err, services.ErrWrongPassword) {
+		t.Fatalf("Expected ErrWrongPassword, got %v", err)
+	}
+	first, err := sessions.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Expected a refused change to keep sessions, got %v", err)
+	}
+
+	if err := f.passwords.ChangePassword(ctx, 7, "old", "new"); err != nil {
+		t.Fatalf("Failed to change password: %v", err)
+	}
+	if !f.hasPassword("new") {
+		t.Error("Expected the new password to be set")
+	}
+
+	revoked := revokedSessions(t, sessions)
+	for _, pair := range []*models.TokenPair{first, second} {
+		if _, err := sessions.Refresh(ctx, pair.RefreshToken); !errors.Is(err, services.ErrInvalidRefreshToken) {
+			t.Errorf("Expected every session to be revoked, got %v", err)
+		}
+		claims, _ := sessions.Auth.ParseJWT(pair.AccessToken)
+		if !revoked[claims.SessionID] {
+			t.Errorf("Expected session %s on the revocation list", claims.SessionID)
+		}
+	}
+	if err := f.passwords.ResetPassword(ctx, token, "newer"); !errors.Is(err, services.ErrInvalidResetToken) {
+		t.Errorf("Expected pending reset links to stop working, got %v", err)
+	}
+}
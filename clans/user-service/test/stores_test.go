@@ -0,0 +1,252 @@
+package userservice_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AlexGuo43/clans/user-service/internal/keys"
+	"github.com/AlexGuo43/clans/user-service/internal/models"
+	"github.com/AlexGuo43/clans/user-service/internal/repository"
+	"github.com/AlexGuo43/clans/user-service/internal/services"
+)
+
+// memoryTokens keeps tokens the way TokenRepository does, in memory.
+type memoryTokens struct {
+	mu      sync.Mutex
+	refresh []*models.RefreshToken
+	resets  []*resetToken
+	revoked map[string]time.Time
+}
+
+type resetToken struct {
+	hash      string
+	userID    int
+	expiresAt time.Time
+	used      bool
+}
+
+var _ services.TokenStore = (*memoryTokens)(nil)
+
+func newMemoryTokens() *memoryTokens {
+	return &memoryTokens{revoked: make(map[string]time.Time)}
+}
+
+func (m *memoryTokens) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := *token
+	stored.ID = len(m.refresh) + 1
+	token.ID = stored.ID
+	m.refresh = append(m.refresh, &stored)
+	return nil
+}
+
+func (m *memoryTokens) GetRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, token := range m.refresh {
+		if token.TokenHash == tokenHash {
+			copied := *token
+			return &copied, nil
+		}
+	}
+	return nil, repository.ErrTokenNotFound
+}
+
+func (m *memoryTokens) UseRefreshToken(ctx context.Context, id int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	token := m.refresh[id-1]
+	if token.UsedAt != nil || token.RevokedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	token.UsedAt = &now
+	return true, nil
+}
+
+func (m *memoryTokens) RevokeFamily(ctx context.Context, familyID string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.revoke(func(token *models.RefreshToken) bool { return token.FamilyID == familyID }, until)
+	m.revoked[familyID] = until
+	return nil
+}
+
+func (m *memoryTokens) RevokeUser(ctx context.Context, userID int, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.revoke(func(token *models.RefreshToken) bool { return token.UserID == userID }, until)
+	for _, reset := range m.resets {
+		if reset.userID == userID {
+			reset.used = true
+		}
+	}
+	return nil
+}
+
+// revoke revokes the unrevoked tokens that match and puts their families on
+// the revocation list.
+func (m *memoryTokens) revoke(match func(*models.RefreshToken) bool, until time.Time) {
+	now := time.Now()
+	for _, token := range m.refresh {
+		if match(token) && token.RevokedAt == nil {
+			token.RevokedAt = &now
+			m.revoked[token.FamilyID] = until
+		}
+	}
+}
+
+func (m *memoryTokens) CreatePasswordResetToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.resets = append(m.resets, &resetToken{hash: tokenHash, userID: userID, expiresAt: expiresAt})
+	return nil
+}
+
+func (m *memoryTokens) UsePasswordResetToken(ctx context.Context, tokenHash string) (int, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, reset := range m.resets {
+		if reset.hash == tokenHash && !reset.used && time.Now().Before(reset.expiresAt) {
+			reset.used = true
+			return reset.userID, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+func (m *memoryTokens) ListRevocations(ctx context.Context) ([]models.Revocation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	revocations := []models.Revocation{}
+	for id, until := range m.revoked {
+		if time.Now().Before(until) {
+			revocations = append(revocations, models.Revocation{TokenID: id, ExpiresAt: until})
+		}
+	}
+	return revocations, nil
+}
+
+// expire moves the expiry of every stored token into the past.
+func (m *memoryTokens) expire() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	past := time.Now().Add(-time.Second)
+	for _, token := range m.refresh {
+		token.ExpiresAt = past
+	}
+	for _, reset := range m.resets {
+		reset.expiresAt = past
+	}
+}
+
+// memoryUsers keeps users the way UserRepository does, in memory.
+type memoryUsers struct {
+	mu    sync.Mutex
+	users map[int]*models.User
+}
+
+var _ services.UserStore = (*memoryUsers)(nil)
+
+func newMemoryUsers(users ...*models.User) *memoryUsers {
+	m := &memoryUsers{users: make(map[int]*models.User)}
+	for _, user := range users {
+		m.users[user.ID] = user
+	}
+	return m
+}
+
+func (m *memoryUsers) GetUserByID(ctx context.Context, id int) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[id]
+	if !ok {
+		return nil, repository.ErrUserNotFound
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (m *memoryUsers) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, user := range m.users {
+		if user.Email == email {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, repository.ErrUserNotFound
+}
+
+func (m *memoryUsers) GetPassword(ctx context.Context, id int) (string, error) {
+	user, err := m.GetUserByID(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return user.Password, nil
+}
+
+func (m *memoryUsers) UpdatePassword(ctx context.Context, id int, password string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[id]
+	if !ok {
+		return repository.ErrUserNotFound
+	}
+	user.Password = password
+	return nil
+}
+
+func (m *memoryUsers) MarkEmailVerified(ctx context.Context, id int, email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if user, ok := m.users[id]; ok && user.Email == email {
+		user.EmailVerified = true
+	}
+	return nil
+}
+
+// testKeys writes an Ed25519 signing key named kid to a new directory and
+// loads it.
+func testKeys(t *testing.T, kid string) *keys.Set {
+	t.Helper()
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	dir := t.TempDir()
+	writePEM(t, filepath.Join(dir, kid+".pem"), "PRIVATE KEY", mustPKCS8(t, private))
+
+	set, err := keys.Load(dir, "")
+	if err != nil {
+		t.Fatalf("Failed to load keys: %v", err)
+	}
+	return set
+}
+
+func mustPKCS8(t *testing.T, key interface{}) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to encode key: %v", err)
+	}
+	return der
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+}
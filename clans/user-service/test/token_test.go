@@ -0,0 +1,136 @@
+package userservice_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AlexGuo43/clans/user-service/internal/models"
+	"github.com/AlexGuo43/clans/user-service/internal/services"
+)
+
+func newTokenService(t *testing.T) (*services.TokenService, *memoryTokens) {
+	t.Helper()
+	tokens := newMemoryTokens()
+	return &services.TokenService{
+		Repo:  tokens,
+		Users: newMemoryUsers(&models.User{ID: 7, Username: "ann", Email: "ann@example.com"}),
+		Auth:  &services.AuthService{Keys: testKeys(t, "test")},
+	}, tokens
+}
+
+// revokedSessions returns the IDs on the revocation list.
+func revokedSessions(t *testing.T, s *services.TokenService) map[string]bool {
+	t.Helper()
+	revocations, err := s.Revocations(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to list revocations: %v", err)
+	}
+	ids := make(map[string]bool)
+	for _, revocation := range revocations {
+		ids[revocation.TokenID] = true
+	}
+	return ids
+}
+
+func TestRefreshRotatesToken(t *testing.T) {
+	s, _ := newTokenService(t)
+	ctx := context.Background()
+
+	first, err := s.Issue(ctx, 7)
+	if err != nil {
+		t.Fatalf("Failed to issue tokens: %v", err)
+	}
+	second, err := s.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Failed to refresh: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken || second.AccessToken == first.AccessToken {
+		t.Error("Expected a new token pair")
+	}
+
+	firstClaims, _ := s.Auth.ParseJWT(first.AccessToken)
+	secondClaims, err := s.Auth.ParseJWT(second.AccessToken)
+	if err != nil {
+		t.Fatalf("Failed to parse the new access token: %v", err)
+	}
+	if secondClaims.UserID != 7 || secondClaims.SessionID != firstClaims.SessionID {
+		t.Errorf("Expected user 7 in the same session, got user %d in %q", secondClaims.UserID, secondClaims.SessionID)
+	}
+
+	if _, err := s.Refresh(ctx, second.RefreshToken); err != nil {
+		t.Errorf("Expected the new refresh token to work, got %v", err)
+	}
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	s, _ := newTokenService(t)
+	ctx := context.Background()
+
+	first, _ := s.Issue(ctx, 7)
+	other, _ := s.Issue(ctx, 7)
+	second, err := s.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Failed to refresh: %v", err)
+	}
+
+	if _, err := s.Refresh(ctx, first.RefreshToken); !errors.Is(err, services.ErrRefreshTokenReused) {
+		t.Fatalf("Expected ErrRefreshTokenReused, got %v", err)
+	}
+	if _, err := s.Refresh(ctx, second.RefreshToken); !errors.Is(err, services.ErrInvalidRefreshToken) {
+		t.Errorf("Expected the rest of the session to be revoked, got %v", err)
+	}
+
+	claims, _ := s.Auth.ParseJWT(second.AccessToken)
+	otherClaims, _ := s.Auth.ParseJWT(other.AccessToken)
+	revoked := revokedSessions(t, s)
+	if !revoked[claims.SessionID] || revoked[otherClaims.SessionID] {
+		t.Errorf("Expected only the reused session on the revocation list, got %v", revoked)
+	}
+	if _, err := s.Refresh(ctx, other.RefreshToken); err != nil {
+		t.Errorf("Expected other sessions to keep working, got %v", err)
+	}
+}
+
+func TestRefreshTokenExpires(t *testing.T) {
+	s, tokens := newTokenService(t)
+	ctx := context.Background()
+
+	pair, _ := s.Issue(ctx, 7)
+	if lifetime := time.Until(tokens.refresh[0].ExpiresAt); lifetime < services.RefreshTokenTTL-time.Minute || lifetime > services.RefreshTokenTTL {
+		t.Errorf("Expected the refresh token to last %v, got %v", services.RefreshTokenTTL, lifetime)
+	}
+	tokens.expire()
+
+	if _, err := s.Refresh(ctx, pair.RefreshToken); !errors.Is(err, services.ErrInvalidRefreshToken) {
+		t.Errorf("Expected ErrInvalidRefreshToken, got %v", err)
+	}
+	if _, err := s.Refresh(ctx, "unknown"); !errors.Is(err, services.ErrInvalidRefreshToken) {
+		t.Errorf("Expected ErrInvalidRefreshToken for an unknown token, got %v", err)
+	}
+}
+
+func TestLogoutRevokesSession(t *testing.T) {
+	s, _ := newTokenService(t)
+	ctx := context.Background()
+
+	pair, _ := s.Issue(ctx, 7)
+	if err := s.Logout(ctx, pair.RefreshToken); err != nil {
+		t.Fatalf("Failed to log out: %v", err)
+	}
+	if _, err := s.Refresh(ctx, pair.RefreshToken); !errors.Is(err, services.ErrInvalidRefreshToken) {
+		t.Errorf("Expected the refresh token to stop working, got %v", err)
+	}
+	claims, _ := s.Auth.ParseJWT(pair.AccessToken)
+	if !revokedSessions(t, s)[claims.SessionID] {
+		t.Error("Expected the session's access tokens to be revoked")
+	}
+
+	if err := s.Logout(ctx, pair.RefreshToken); err != nil {
+		t.Errorf("Expected logging out again to succeed, got %v", err)
+	}
+	if err := s.Logout(ctx, "unknown"); err != nil {
+		t.Errorf("Expected an unknown token to be ignored, got %v", err)
+	}
+}
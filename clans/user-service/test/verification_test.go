@@ -0,0 +1,192 @@
+package userservice_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexGuo43/clans/user-service/config"
+	"github.com/AlexGuo43/clans/user-service/internal/mailer"
+	"github.com/AlexGuo43/clans/user-service/internal/models"
+	"github.com/AlexGuo43/clans/user-service/internal/services"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var linkPattern = regexp.MustCompile(`https://\S+`)
+
+// mailedToken returns the token in the last link mailed to out.
+func mailedToken(t *testing.T, out *bytes.Buffer) string {
+	t.Helper()
+	links := linkPattern.FindAllString(out.String(), -1)
+	if len(links) == 0 {
+		t.Fatalf("Expected a link in the mail, got %q", out)
+	}
+	link, err := url.Parse(links[len(links)-1])
+	if err != nil {
+		t.Fatalf("Failed to parse link: %v", err)
+	}
+	return link.Query().Get("token")
+}
+
+func TestEmailTokenAudience(t *testing.T) {
+	auth := &services.AuthService{Keys: testKeys(t, "test")}
+	user := &models.User{ID: 7, Email: "ann@example.com"}
+
+	token, err := auth.GenerateEmailToken(user)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	userID, email, err := auth.ParseEmailToken(token)
+	if err != nil || userID != 7 || email != "ann@example.com" {
+		t.Errorf("Expected user 7 and ann@example.com, got %d %q %v", userID, email, err)
+	}
+
+	claims := &services.EmailClaims{}
+	jwt.NewParser().ParseUnverified(token, claims)
+	if aud, _ := claims.GetAudience(); len(aud) != 1 || aud[0] != "verify-email" {
+		t.Errorf("Expected the verify-email audience, got %v", aud)
+	}
+
+	// Neither kind of token passes for the other.
+	if _, err := auth.ParseJWT(token); err == nil {
+		t.Error("Expected an email token to be refused as an access token")
+	}
+	access, _ := auth.GenerateJWT(user, "session")
+	if _, _, err := auth.ParseEmailToken(access); err == nil {
+		t.Error("Expected an access token to be refused as an email token")
+	}
+}
+
+func TestEmailTokenExpires(t *testing.T) {
+	set := testKeys(t, "test")
+	auth := &services.AuthService{Keys: set}
+
+	token, _ := auth.GenerateEmailToken(&models.User{ID: 7, Email: "ann@example.com"})
+	claims := &services.EmailClaims{}
+	jwt.NewParser().ParseUnverified(token, claims)
+	if lifetime := claims.ExpiresAt.Sub(claims.IssuedAt.Time); lifetime != services.EmailTokenTTL {
+		t.Errorf("Expected the token to last %v, got %v", services.EmailTokenTTL, lifetime)
+	}
+
+	issued := time.Now().Add(-services.EmailTokenTTL - time.Minute)
+	expired, _ := set.Sign(services.EmailClaims{
+		Email: "ann@example.com",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(7),
+			Audience:  jwt.ClaimStrings{"verify-email"},
+			IssuedAt:  jwt.NewNumericDate(issued),
+			ExpiresAt: jwt.NewNumericDate(issued.Add(services.EmailTokenTTL)),
+		},
+	})
+	if _, _, err := auth.ParseEmailToken(expired); err == nil {
+		t.Error("Expected an expired token to be refused")
+	}
+}
+
+func TestVerifyEmailIsBoundToAddress(t *testing.T) {
+	users := newMemoryUsers(&models.User{ID: 7, Username: "ann", Email: "ann@example.com"})
+	var out bytes.Buffer
+	s := &services.VerificationService{
+		Users:   users,
+		Auth:    &services.AuthService{Keys: testKeys(t, "test")},
+		Mailer:  &mailer.WriterMailer{W: &out, From: "Clans <noreply@example.com>"},
+		LinkURL: "https://clans.example.com/verify-email",
+	}
+	ctx := context.Background()
+
+	if err := s.Resend(ctx, 7); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	token := mailedToken(t, &out)
+
+	users.users[7].Email = "ann@example.org"
+	if err := s.Verify(ctx, token); !errors.Is(err, services.ErrInvalidEmailToken) {
+		t.Errorf("Expected the link to stop working after an email change, got %v", err)
+	}
+	if users.users[7].EmailVerified {
+		t.Fatal("Expected the new address to stay unverified")
+	}
+
+	if err := s.Resend(ctx, 7); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if err := s.Verify(ctx, mailedToken(t, &out)); err != nil {
+		t.Fatalf("Expected a link for the new address to work, got %v", err)
+	}
+	if !users.users[7].EmailVerified {
+		t.Error("Expected the address to be verified")
+	}
+	if err := s.Resend(ctx, 7); !errors.Is(err, services.ErrEmailAlreadyVerified) {
+		t.Errorf("Expected ErrEmailAlreadyVerified, got %v", err)
+	}
+	if err := s.Verify(ctx, "not-a-token"); !errors.Is(err, services.ErrInvalidEmailToken) {
+		t.Errorf("Expected ErrInvalidEmailToken, got %v", err)
+	}
+}
+
+func TestWriterMailerFormatsMessage(t *testing.T) {
+	var out bytes.Buffer
+	m := &mailer.WriterMailer{W: &out, From: "Clans <noreply@example.com>"}
+
+	err := m.Send(context.Background(), mailer.Message{To: "ann@example.com", Subject: "Héllo", Body: "line one\nline two\n"})
+	if err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	header, body, ok := strings.Cut(out.String(), "\r\n\r\n")
+	if !ok {
+		t.Fatalf("Expected headers and a body, got %q", out.String())
+	}
+	for _, want := range []string{
+		"From: Clans <noreply@example.com>", "To: ann@example.com", "Subject: =?utf-8?q?H=C3=A9llo?=",
+		"MIME-Version: 1.0", "Content-Type: text/plain; charset=utf-8",
+	} {
+		if !strings.Contains(header+"\r\n", want+"\r\n") {
+			t.Errorf("Expected header %q in %q", want, header)
+		}
+	}
+	if body != "line one\r\nline two\r\n\n" {
+		t.Errorf("Expected the body with CRLF line endings, got %q", body)
+	}
+
+	err = m.Send(context.Background(), mailer.Message{To: "ann@example.com\r\nBcc: eve@example.com", Subject: "Hi"})
+	if err == nil {
+		t.Error("Expected headers with line breaks to be refused")
+	}
+}
+
+func TestFileMailerAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.log")
+	m, err := mailer.New(&config.Config{Mailer: "file", MailFile: path, MailFrom: "noreply@example.com"})
+	if err != nil {
+		t.Fatalf("Failed to create mailer: %v", err)
+	}
+	for _, to := range []string{"ann@example.com", "bob@example.com"} {
+		if err := m.Send(context.Background(), mailer.Message{To: to, Subject: "Hi", Body: "Hello"}); err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read mail file: %v", err)
+	}
+	if strings.Count(string(data), "From: noreply@example.com\r\n") != 2 ||
+		!strings.Contains(string(data), "To: ann@example.com\r\n") || !strings.Contains(string(data), "To: bob@example.com\r\n") {
+		t.Errorf("Expected both messages in the file, got %q", data)
+	}
+
+	if _, err := mailer.New(&config.Config{Mailer: "file"}); err == nil {
+		t.Error("Expected an error without MAIL_FILE")
+	}
+	if _, err := mailer.New(&config.Config{Mailer: "pigeon"}); err == nil {
+		t.Error("Expected an error for an unknown mailer")
+	}
+}